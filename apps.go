@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -206,9 +208,16 @@ func appsDestroy(db *gorm.DB, app *App) error {
 type scaler struct {
 	store     *store
 	scheduler scheduler.Scheduler
+	locker    *appLocker
 }
 
 func (s *scaler) Scale(ctx context.Context, app *App, t ProcessType, quantity int, c *Constraints) (*Process, error) {
+	unlock, err := s.locker.Lock(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app})
 	if err != nil {
 		return nil, err
@@ -247,10 +256,81 @@ type restarter struct {
 	releaser  *releaser
 }
 
+// Restart restarts processes for the app. The id can be one of:
+//
+//	""            Restarts every process by re-releasing the app.
+//	"web"         Restarts every instance of the process type, with a rolling
+//	              restart if the scheduler supports it.
+//	"web.3"       Stops the third instance of the process type.
+//	"v1.web.<id>" Stops the named instance.
+//	"<id>"        Stops the instance with the given id.
+//
+// The scheduler replaces any instances that are stopped.
 func (s *restarter) Restart(ctx context.Context, app *App, id string) error {
-	if id != "" {
+	if id == "" {
+		if err := s.releaser.store.canaryRunning(app); err != nil {
+			return err
+		}
+		return s.releaser.ReleaseApp(ctx, app)
+	}
+
+	release, err := s.releaser.store.ReleasesFirst(ReleasesQuery{App: app})
+	if err != nil && err != gorm.RecordNotFound {
+		return err
+	}
+
+	if err == nil {
+		if _, ok := release.Formation()[ProcessType(id)]; ok {
+			return scheduler.Restart(ctx, s.scheduler, app.ID, id)
+		}
+	}
+
+	parts := strings.Split(id, ".")
+	if len(parts) < 2 {
 		return s.scheduler.Stop(ctx, id)
 	}
 
-	return s.releaser.ReleaseApp(ctx, app)
+	instances, err := s.scheduler.Instances(ctx, app.ID)
+	if err != nil {
+		return err
+	}
+
+	i, err := findInstance(instances, parts[len(parts)-2], parts[len(parts)-1])
+	if err != nil {
+		return err
+	}
+
+	return s.scheduler.Stop(ctx, i.ID)
 }
+
+// findInstance finds the instance of the process type with the given id. If
+// no instance has that id, and the id is a number, the instance at that
+// position (starting at 1) is returned, with instances ordered by id.
+func findInstance(instances []*scheduler.Instance, ptype, id string) (*scheduler.Instance, error) {
+	var matches []*scheduler.Instance
+	for _, i := range instances {
+		if i.Process.Type != ptype {
+			continue
+		}
+
+		if i.ID == id {
+			return i, nil
+		}
+
+		matches = append(matches, i)
+	}
+
+	if n, err := strconv.Atoi(id); err == nil && n > 0 && n <= len(matches) {
+		sort.Sort(instancesByID(matches))
+		return matches[n-1], nil
+	}
+
+	return nil, &ValidationError{Err: fmt.Errorf("no %s instance matching %s", ptype, id)}
+}
+
+// instancesByID sorts instances by their id.
+type instancesByID []*scheduler.Instance
+
+func (s instancesByID) Len() int           { return len(s) }
+func (s instancesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+func (s instancesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
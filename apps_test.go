@@ -2,6 +2,8 @@ package empire
 
 import (
 	"testing"
+
+	"github.com/remind101/empire/scheduler"
 )
 
 func TestIsValid(t *testing.T) {
@@ -36,3 +38,43 @@ func TestAppsQuery(t *testing.T) {
 
 	tests.Run(t)
 }
+
+func TestFindInstance(t *testing.T) {
+	web := &scheduler.Process{Type: "web"}
+	worker := &scheduler.Process{Type: "worker"}
+
+	instances := []*scheduler.Instance{
+		{ID: "c", Process: web},
+		{ID: "a", Process: web},
+		{ID: "b", Process: worker},
+		{ID: "d", Process: web},
+	}
+
+	tests := []struct {
+		ptype, id string
+		out       string
+	}{
+		{"web", "d", "d"},
+		{"web", "1", "a"},
+		{"web", "2", "c"},
+		{"web", "3", "d"},
+		{"worker", "1", "b"},
+	}
+
+	for _, tt := range tests {
+		i, err := findInstance(instances, tt.ptype, tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := i.ID, tt.out; got != want {
+			t.Errorf("findInstance(%s, %s) => %s; want %s", tt.ptype, tt.id, got, want)
+		}
+	}
+
+	for _, id := range []string{"4", "0", "b", "abcd"} {
+		if _, err := findInstance(instances, "web", id); err == nil {
+			t.Errorf("findInstance(web, %s) => expected an error", id)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package empire
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+// RollbackError is returned when a release failed health checks and was
+// automatically rolled back to the previous release.
+type RollbackError struct {
+	// The release that failed.
+	Release *Release
+
+	// The release that was created by rolling back.
+	Rollback *Release
+
+	// The reason that the release was rolled back.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("release v%d failed health checks and was rolled back to v%d (v%d): %v", e.Release.Version, e.Release.Version-1, e.Rollback.Version, e.Err)
+}
+
+// autoRollbackEnabled returns true if the config enables automatic rollbacks.
+func autoRollbackEnabled(config *Config) bool {
+	if config == nil {
+		return false
+	}
+
+	v := config.Vars[AutoRollbackVar]
+	if v == nil {
+		return false
+	}
+
+	enabled, _ := strconv.ParseBool(*v)
+	return enabled
+}
+
+// autoRollback rolls back to the release before r, because r failed health
+// checks. Nothing is done if r isn't the current release anymore, since it's
+// already been replaced. The app is locked while rolling back.
+func (s *deployerService) autoRollback(ctx context.Context, r *Release, cause error, enc *json.Encoder) error {
+	if r.Version <= 1 {
+		return cause
+	}
+
+	unlock, err := s.rollbackLocker().Lock(ctx, r.App)
+	if err != nil {
+		return fmt.Errorf("release v%d failed health checks, but wasn't rolled back: %v: %v", r.Version, err, cause)
+	}
+	defer unlock()
+
+	current, err := s.store.ReleasesFirst(ReleasesQuery{App: r.App})
+	if err != nil {
+		return err
+	}
+
+	if current.ID != r.ID {
+		return cause
+	}
+
+	version := r.Version - 1
+
+	msg := jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Release v%d failed health checks, rolling back to v%d", r.Version, version)}
+	if err := enc.Encode(&msg); err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("automatic, v%d failed health checks: %v", r.Version, cause)
+	rollback, err := s.rollback(ctx, r.App, version, reason, RollbackOpts{})
+	if err != nil {
+		return fmt.Errorf("release v%d failed health checks, and rolling back to v%d failed: %v", r.Version, version, err)
+	}
+
+	return &RollbackError{Release: r, Rollback: rollback, Err: cause}
+}
+
+// rollbackLockTimeout is the minimum amount of time to wait for the app lock
+// before rolling back a release that failed.
+const rollbackLockTimeout = 5 * time.Minute
+
+// rollbackLocker returns the appLocker to use when rolling back a release that
+// failed. Another operation (e.g. the next deploy) may be holding the lock, so
+// it waits for a while, instead of failing right away like the configured
+// LockTimeout might.
+func (s *deployerService) rollbackLocker() *appLocker {
+	l := &appLocker{store: s.locker.store, timeout: s.locker.timeout}
+	if l.timeout < rollbackLockTimeout {
+		l.timeout = rollbackLockTimeout
+	}
+	return l
+}
+
+// monitor waits for the release to stabilize in the background, and rolls
+// back if it fails health checks. The deployment is marked as failed if it's
+// rolled back, or if it couldn't be rolled back. Errors are reported, since
+// there's no one waiting for the result.
+func (s *deployerService) monitor(ctx context.Context, d *Deployment, r *Release) {
+	if _, ok := s.scheduler.(scheduler.Stabilizer); !ok {
+		return
+	}
+
+	go func() {
+		// Status updates and the rollback are appended to the
+		// deployment's output, so that there's a record of them.
+		output := newDeploymentOutput(ctx, s.store, d)
+		defer output.Flush()
+
+		enc := json.NewEncoder(output)
+
+		err := s.wait(context.Background(), r, enc)
+		if _, ok := err.(*scheduler.UnhealthyError); !ok {
+			return
+		}
+
+		err = s.autoRollback(context.Background(), r, err, enc)
+
+		msg := newJSONMessageError(err)
+		if eerr := enc.Encode(&msg); eerr != nil {
+			reporter.Report(ctx, eerr)
+		}
+
+		d.Finish(r, err)
+		if uerr := s.store.DeploymentsUpdate(d); uerr != nil {
+			reporter.Report(ctx, uerr)
+		}
+
+		reporter.Report(ctx, err)
+	}()
+}
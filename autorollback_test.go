@@ -0,0 +1,39 @@
+package empire
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAutoRollbackEnabled(t *testing.T) {
+	enabled, disabled, invalid := "true", "0", "sure"
+
+	tests := []struct {
+		config *Config
+		out    bool
+	}{
+		{nil, false},
+		{&Config{}, false},
+		{&Config{Vars: Vars{AutoRollbackVar: &enabled}}, true},
+		{&Config{Vars: Vars{AutoRollbackVar: &disabled}}, false},
+		{&Config{Vars: Vars{AutoRollbackVar: &invalid}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := autoRollbackEnabled(tt.config); got != tt.out {
+			t.Errorf("autoRollbackEnabled(%v) => %v; want %v", tt.config, got, tt.out)
+		}
+	}
+}
+
+func TestRollbackError(t *testing.T) {
+	err := &RollbackError{
+		Release:  &Release{Version: 5},
+		Rollback: &Release{Version: 6},
+		Err:      errors.New("web is unhealthy"),
+	}
+
+	if got, want := err.Error(), "release v5 failed health checks and was rolled back to v4 (v6): web is unhealthy"; got != want {
+		t.Fatalf("Error() => %q; want %q", got, want)
+	}
+}
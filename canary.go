@@ -0,0 +1,206 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+// CanarySuffix is appended to a process type to get the process type of its
+// canary (e.g. web-canary).
+const CanarySuffix = "-canary"
+
+// ErrCanaryAborted is the error recorded on a canary deployment that was
+// aborted.
+var ErrCanaryAborted = errors.New("canary was aborted")
+
+// CanaryOpts controls how many instances of a new release are run as a canary
+// alongside the existing release.
+type CanaryOpts struct {
+	// The number of canary instances to run for each process type.
+	Instances int
+
+	// The percentage of each process type's instances to run as canaries.
+	// The number of instances is rounded up, so there's always at least
+	// one canary instance.
+	Percent int
+
+	// If provided, the canary will be promoted automatically after this
+	// amount of time, unless it was promoted or aborted already.
+	BakeTime time.Duration
+}
+
+// Validate validates the options.
+func (o CanaryOpts) Validate() error {
+	if o.Instances < 0 || o.Percent < 0 || o.BakeTime < 0 {
+		return &ValidationError{Err: errors.New("canary options can't be negative")}
+	}
+
+	if (o.Instances == 0) == (o.Percent == 0) {
+		return &ValidationError{Err: errors.New("exactly one of canary instances or percent must be provided")}
+	}
+
+	if o.Percent > 100 {
+		return &ValidationError{Err: errors.New("canary percent must be between 1 and 100")}
+	}
+
+	return nil
+}
+
+// instances returns the number of canary instances to run for a process with
+// n instances.
+func (o CanaryOpts) instances(n uint) uint {
+	if o.Percent > 0 {
+		return (n*uint(o.Percent) + 99) / 100
+	}
+
+	return uint(o.Instances)
+}
+
+// canaryProcesses returns canaries of the processes that are scaled up.
+func canaryProcesses(processes []*scheduler.Process, opts CanaryOpts) []*scheduler.Process {
+	var canaries []*scheduler.Process
+
+	for _, p := range processes {
+		if p.Instances == 0 {
+			continue
+		}
+
+		c := *p
+		c.Type = p.Type + CanarySuffix
+		c.CanaryOf = p.Type
+		c.Instances = opts.instances(p.Instances)
+		canaries = append(canaries, &c)
+	}
+
+	return canaries
+}
+
+// canaryService provides methods for promoting and aborting canary
+// deployments.
+type canaryService struct {
+	store    *store
+	releaser *releaser
+	releases *releasesService
+	locker   *appLocker
+}
+
+// Promote replaces all of the processes with the release that's being
+// canaried, which also removes the canaries.
+func (s *canaryService) Promote(ctx context.Context, d *Deployment) error {
+	unlock, err := s.locker.Lock(ctx, d.App)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := s.canaryRelease(d)
+	if err != nil {
+		return err
+	}
+
+	err = s.releaser.Release(ctx, r)
+
+	d.Finish(r, err)
+	if uerr := s.store.DeploymentsUpdate(d); uerr != nil && err == nil {
+		err = uerr
+	}
+
+	return err
+}
+
+// Abort rolls back to the release before the canary, which also removes the
+// canaries.
+func (s *canaryService) Abort(ctx context.Context, d *Deployment) error {
+	unlock, err := s.locker.Lock(ctx, d.App)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := s.canaryRelease(d)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.releases.rollback(ctx, d.App, r.Version-1, "", RollbackOpts{}); err != nil {
+		return err
+	}
+
+	d.Finish(r, ErrCanaryAborted)
+	return s.store.DeploymentsUpdate(d)
+}
+
+// bake promotes the canary after the bake time, unless it was promoted or
+// aborted in the meantime. Errors are reported, since there's no one waiting
+// for the result.
+func (s *canaryService) bake(ctx context.Context, id string, bakeTime time.Duration) {
+	time.AfterFunc(bakeTime, func() {
+		d, err := s.store.DeploymentsFirst(DeploymentsQuery{ID: &id})
+		if err != nil {
+			reporter.Report(ctx, err)
+			return
+		}
+
+		if d.Status != StatusCanary {
+			return
+		}
+
+		if err := s.Promote(context.Background(), d); err != nil {
+			reporter.Report(ctx, err)
+		}
+	})
+}
+
+// canaryRelease returns the release that's being canaried by the deployment.
+// An error is returned if the deployment isn't a canary, or if a newer
+// release has been created since. The deployment is reloaded, since it may
+// have been promoted or aborted since it was read, so this should be called
+// with the app locked.
+func (s *canaryService) canaryRelease(d *Deployment) (*Release, error) {
+	current, err := s.store.DeploymentsFirst(DeploymentsQuery{ID: &d.ID})
+	if err != nil {
+		return nil, err
+	}
+	*d = *current
+
+	if d.Status != StatusCanary || d.Release == nil {
+		return nil, &ValidationError{Err: fmt.Errorf("deployment %s is not a running canary", d.ID)}
+	}
+
+	r, err := s.store.ReleasesFirst(ReleasesQuery{App: d.App})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ID != d.Release.ID {
+		return nil, &ValidationError{Err: fmt.Errorf("v%d has been superseded by v%d", d.Release.Version, r.Version)}
+	}
+
+	return r, nil
+}
+
+// canaryRunning returns a ValidationError if a canary is running for the app.
+// The canary's release is the app's latest release until it's promoted or
+// aborted, so releasing the app in the meantime would replace the existing
+// processes with the canary's slug, and leave the canary deployment
+// unfinished.
+func (s *store) canaryRunning(app *App) error {
+	d, err := s.DeploymentsFirst(ComposedScope{
+		DeploymentsQuery{App: app},
+		FieldEquals("status", StatusCanary),
+	})
+	if err == gorm.RecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return &ValidationError{Err: fmt.Errorf("%s has a running canary (deployment %s), which needs to be promoted or aborted first", app.Name, d.ID)}
+}
@@ -0,0 +1,69 @@
+package empire
+
+import (
+	"testing"
+
+	"github.com/remind101/empire/scheduler"
+)
+
+func TestCanaryOpts_Validate(t *testing.T) {
+	tests := []struct {
+		opts  CanaryOpts
+		valid bool
+	}{
+		{CanaryOpts{Instances: 1}, true},
+		{CanaryOpts{Percent: 10}, true},
+		{CanaryOpts{Percent: 100}, true},
+		{CanaryOpts{}, false},
+		{CanaryOpts{Instances: 1, Percent: 10}, false},
+		{CanaryOpts{Percent: 101}, false},
+		{CanaryOpts{Instances: -1}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.opts.Validate()
+		if got, want := err == nil, tt.valid; got != want {
+			t.Errorf("Validate(%#v) => %v", tt.opts, err)
+		}
+	}
+}
+
+func TestCanaryProcesses(t *testing.T) {
+	processes := []*scheduler.Process{
+		{Type: "web", Instances: 10},
+		{Type: "worker", Instances: 3},
+		{Type: "scheduler", Instances: 0},
+	}
+
+	tests := []struct {
+		opts      CanaryOpts
+		instances map[string]uint
+	}{
+		{CanaryOpts{Instances: 2}, map[string]uint{"web-canary": 2, "worker-canary": 2}},
+		{CanaryOpts{Percent: 10}, map[string]uint{"web-canary": 1, "worker-canary": 1}},
+		{CanaryOpts{Percent: 50}, map[string]uint{"web-canary": 5, "worker-canary": 2}},
+	}
+
+	for _, tt := range tests {
+		canaries := canaryProcesses(processes, tt.opts)
+
+		if got, want := len(canaries), len(tt.instances); got != want {
+			t.Fatalf("len(canaries) => %d; want %d", got, want)
+		}
+
+		for _, c := range canaries {
+			if got, want := c.Instances, tt.instances[c.Type]; got != want {
+				t.Errorf("%s: Instances => %d; want %d", c.Type, got, want)
+			}
+
+			if got, want := c.Type, c.CanaryOf+CanarySuffix; got != want {
+				t.Errorf("Type => %s; want %s", got, want)
+			}
+		}
+	}
+
+	// The original processes shouldn't be modified.
+	if got, want := processes[0].Type, "web"; got != want {
+		t.Fatalf("Type => %s; want %s", got, want)
+	}
+}
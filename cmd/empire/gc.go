@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/remind101/empire"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+func runGC(c *cli.Context) {
+	e, err := newEmpire(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Errors for individual apps are reported, rather than returned.
+	ctx := reporter.WithReporter(context.Background(), e.Reporter)
+
+	result, err := e.GC(ctx, retentionPolicy(c))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Deleted %d releases, %d configs and %d slugs\n", result.Releases, result.Configs, result.Slugs)
+
+	if len(result.Skipped) > 0 {
+		fmt.Printf("Skipped %s, since another operation was in progress\n", strings.Join(result.Skipped, ", "))
+	}
+}
+
+func retentionPolicy(c *cli.Context) empire.RetentionPolicy {
+	return empire.RetentionPolicy{
+		Keep:   c.Int(FlagGCKeep),
+		MaxAge: c.Duration(FlagGCMaxAge),
+	}
+}
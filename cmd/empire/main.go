@@ -32,9 +32,11 @@ const (
 	FlagDBPath = "path"
 	FlagDB     = "db"
 
-	FlagDockerSocket = "docker.socket"
-	FlagDockerCert   = "docker.cert"
-	FlagDockerAuth   = "docker.auth"
+	FlagDockerSocket           = "docker.socket"
+	FlagDockerCert             = "docker.cert"
+	FlagDockerAuth             = "docker.auth"
+	FlagDockerRegistry         = "docker.registry"
+	FlagDockerRegistryInsecure = "docker.registry.insecure"
 
 	FlagAWSDebug       = "aws.debug"
 	FlagECSCluster     = "ecs.cluster"
@@ -52,6 +54,18 @@ const (
 	FlagReporter     = "reporter"
 	FlagRunner       = "runner"
 	FlagLogsStreamer = "logs.streamer"
+	FlagScheduler    = "scheduler"
+
+	FlagKubernetesURL       = "kubernetes.url"
+	FlagKubernetesNamespace = "kubernetes.namespace"
+	FlagKubernetesToken     = "kubernetes.token"
+
+	FlagDeployTimeout = "deploy.timeout"
+	FlagLockTimeout   = "lock.timeout"
+
+	FlagGCKeep     = "gc.keep"
+	FlagGCMaxAge   = "gc.max-age"
+	FlagGCInterval = "gc.interval"
 )
 
 // Commands are the subcommands that are available.
@@ -119,9 +133,21 @@ var Commands = []cli.Command{
 				Usage:  "If provided, logs from deployments triggered via GitHub deployments will be sent to this tugboat instance.",
 				EnvVar: "EMPIRE_TUGBOAT_URL",
 			},
-		}, append(EmpireFlags, DBFlags...)...),
+			cli.DurationFlag{
+				Name:   FlagGCInterval,
+				Value:  0,
+				Usage:  "If provided, old releases will be garbage collected in the background at this interval, using the gc.keep and gc.max-age retention policy",
+				EnvVar: "EMPIRE_GC_INTERVAL",
+			},
+		}, append(GCFlags, append(EmpireFlags, DBFlags...)...)...),
 		Action: runServer,
 	},
+	{
+		Name:   "gc",
+		Usage:  "Delete old releases, along with their configs and slugs, and deregister unused task definitions",
+		Flags:  append(GCFlags, append(EmpireFlags, DBFlags...)...),
+		Action: runGC,
+	},
 	{
 		Name:   "migrate",
 		Usage:  "Migrate the database",
@@ -130,6 +156,21 @@ var Commands = []cli.Command{
 	},
 }
 
+var GCFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:   FlagGCKeep,
+		Value:  0,
+		Usage:  "The number of most recent releases to keep for each app when garbage collecting",
+		EnvVar: "EMPIRE_GC_KEEP",
+	},
+	cli.DurationFlag{
+		Name:   FlagGCMaxAge,
+		Value:  0,
+		Usage:  "Releases newer than this are kept when garbage collecting",
+		EnvVar: "EMPIRE_GC_MAX_AGE",
+	},
+}
+
 var DBFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:  FlagDBPath,
@@ -163,6 +204,16 @@ var EmpireFlags = []cli.Flag{
 		Usage:  "Path to a docker registry auth file (~/.dockercfg)",
 		EnvVar: "DOCKER_AUTH_PATH",
 	},
+	cli.BoolFlag{
+		Name:   FlagDockerRegistry,
+		Usage:  "Resolve images and extract Procfiles using the Docker Registry API, instead of the docker daemon",
+		EnvVar: "EMPIRE_DOCKER_REGISTRY",
+	},
+	cli.BoolFlag{
+		Name:   FlagDockerRegistryInsecure,
+		Usage:  "Access registries over http instead of https when using the Docker Registry API",
+		EnvVar: "EMPIRE_DOCKER_REGISTRY_INSECURE",
+	},
 	cli.BoolFlag{
 		Name:   FlagAWSDebug,
 		Usage:  "Enable verbose debug output for AWS integration.",
@@ -234,6 +285,42 @@ var EmpireFlags = []cli.Flag{
 		Usage:  "The location of the logs to stream",
 		EnvVar: "EMPIRE_LOGS_STREAMER",
 	},
+	cli.StringFlag{
+		Name:   FlagScheduler,
+		Value:  "ecs",
+		Usage:  "The scheduler backend to use (ecs, cloudformation, docker or kubernetes)",
+		EnvVar: "EMPIRE_SCHEDULER",
+	},
+	cli.StringFlag{
+		Name:   FlagKubernetesURL,
+		Value:  "http://localhost:8080",
+		Usage:  "The location of the Kubernetes API server",
+		EnvVar: "EMPIRE_KUBERNETES_URL",
+	},
+	cli.StringFlag{
+		Name:   FlagKubernetesNamespace,
+		Value:  "default",
+		Usage:  "The Kubernetes namespace to create resources within",
+		EnvVar: "EMPIRE_KUBERNETES_NAMESPACE",
+	},
+	cli.StringFlag{
+		Name:   FlagKubernetesToken,
+		Value:  "",
+		Usage:  "A bearer token to authenticate with the Kubernetes API server",
+		EnvVar: "EMPIRE_KUBERNETES_TOKEN",
+	},
+	cli.DurationFlag{
+		Name:   FlagDeployTimeout,
+		Value:  empire.DefaultDeployTimeout,
+		Usage:  "The maximum amount of time to wait for a deployment to stabilize, when waiting",
+		EnvVar: "EMPIRE_DEPLOY_TIMEOUT",
+	},
+	cli.DurationFlag{
+		Name:   FlagLockTimeout,
+		Value:  0,
+		Usage:  "The amount of time to wait for another operation on an app to finish. By default, conflicting operations fail immediately",
+		EnvVar: "EMPIRE_LOCK_TIMEOUT",
+	},
 }
 
 func main() {
@@ -251,6 +338,8 @@ func newEmpire(c *cli.Context) (*empire.Empire, error) {
 
 	opts.Docker.Socket = c.String(FlagDockerSocket)
 	opts.Docker.CertPath = c.String(FlagDockerCert)
+	opts.Docker.Registry = c.Bool(FlagDockerRegistry)
+	opts.Docker.RegistryInsecure = c.Bool(FlagDockerRegistryInsecure)
 	opts.AWSConfig = aws.NewConfig()
 	if c.Bool(FlagAWSDebug) {
 		opts.AWSConfig.WithLogLevel(1)
@@ -265,6 +354,12 @@ func newEmpire(c *cli.Context) (*empire.Empire, error) {
 	opts.DB = c.String(FlagDB)
 	opts.Secret = c.String(FlagSecret)
 	opts.LogsStreamer = c.String(FlagLogsStreamer)
+	opts.Scheduler = c.String(FlagScheduler)
+	opts.Kubernetes.URL = c.String(FlagKubernetesURL)
+	opts.Kubernetes.Namespace = c.String(FlagKubernetesNamespace)
+	opts.Kubernetes.Token = c.String(FlagKubernetesToken)
+	opts.DeployTimeout = c.Duration(FlagDeployTimeout)
+	opts.LockTimeout = c.Duration(FlagLockTimeout)
 
 	auth, err := dockerAuth(c.String(FlagDockerAuth))
 	if err != nil {
@@ -7,6 +7,8 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/remind101/empire"
 	"github.com/remind101/empire/server"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
 )
 
 func runServer(c *cli.Context) {
@@ -21,6 +23,16 @@ func runServer(c *cli.Context) {
 		log.Fatal(err)
 	}
 
+	if interval := c.Duration(FlagGCInterval); interval > 0 {
+		policy := retentionPolicy(c)
+		if err := policy.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := reporter.WithReporter(context.Background(), e.Reporter)
+		e.RunGC(ctx, policy, interval)
+	}
+
 	s := newServer(c, e)
 	log.Printf("Starting on port %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, s))
@@ -121,9 +121,20 @@ func configsCreate(db *gorm.DB, config *Config) (*Config, error) {
 type configsService struct {
 	store    *store
 	releases *releasesService
+	locker   *appLocker
 }
 
 func (s *configsService) ConfigsApply(ctx context.Context, app *App, vars Vars) (*Config, error) {
+	unlock, err := s.locker.Lock(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.store.canaryRunning(app); err != nil {
+		return nil, err
+	}
+
 	old, err := s.ConfigsCurrent(app)
 	if err != nil {
 		return nil, err
@@ -143,36 +154,85 @@ func (s *configsService) ConfigsApply(ctx context.Context, app *App, vars Vars)
 		return c, err
 	}
 
-	keys := make([]string, 0, len(vars))
-	for k := range vars {
-		keys = append(keys, string(k))
-	}
-
-	desc := fmt.Sprintf("Set %s config vars", strings.Join(keys, ","))
+	desc := configsDescription(vars)
 
 	// Create new release based on new config and old slug
 	_, err = s.releases.ReleasesCreate(ctx, &Release{
-		App:         release.App,
-		Config:      c,
-		Slug:        release.Slug,
-		Description: desc,
+		App:            release.App,
+		Config:         c,
+		Slug:           release.Slug,
+		RequestedImage: release.RequestedImage,
+		Description:    desc,
 	})
 	return c, err
 }
 
+// ConfigsApplyPlan returns what applying the vars would do, without doing it.
+func (s *configsService) ConfigsApplyPlan(ctx context.Context, app *App, vars Vars) (*Plan, error) {
+	old, err := s.latest(app)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewConfig(old, vars)
+
+	release, err := s.store.ReleasesFirstPlan(ReleasesQuery{App: app})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			// Without a release, only the config would change.
+			return &Plan{Diff: &ReleaseDiff{Vars: diffVars(old.Vars, c.Vars)}}, nil
+		}
+
+		return nil, err
+	}
+
+	return s.releases.plan(ctx, &Release{
+		App:            release.App,
+		Config:         c,
+		Slug:           release.Slug,
+		RequestedImage: release.RequestedImage,
+		Description:    configsDescription(vars),
+	}, nil)
+}
+
+// configsDescription returns the description of a release that applies the
+// vars.
+func configsDescription(vars Vars) string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, string(k))
+	}
+
+	return fmt.Sprintf("Set %s config vars", strings.Join(keys, ","))
+}
+
 // Returns configs for latest release or the latest configs if there are no releases.
 func (s *configsService) ConfigsCurrent(app *App) (*Config, error) {
-	r, err := s.store.ReleasesFirst(ReleasesQuery{App: app})
+	c, err := s.latest(app)
+	if err != nil || c.ID != "" {
+		return c, err
+	}
+
+	return s.store.ConfigsCreate(c)
+}
+
+// latest returns the config for the latest release, or the latest config if
+// there are no releases. If the app has no config, a new empty Config is
+// returned, which isn't persisted. Nothing is persisted, so it can be used when
+// planning.
+func (s *configsService) latest(app *App) (*Config, error) {
+	r, err := s.store.ReleasesFirstPlan(ReleasesQuery{App: app})
 	if err != nil {
 		if err == gorm.RecordNotFound {
 			// It's possible to have config without releases, this handles that.
 			c, err := s.store.ConfigsFirst(ConfigsQuery{App: app})
 			if err != nil {
 				if err == gorm.RecordNotFound {
-					return s.store.ConfigsCreate(&Config{
-						App:  app,
-						Vars: make(Vars),
-					})
+					return &Config{
+						AppID: app.ID,
+						App:   app,
+						Vars:  make(Vars),
+					}, nil
 				}
 				return nil, err
 			}
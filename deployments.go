@@ -1,22 +1,242 @@
 package empire
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/pkg/headerutil"
 	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
 	"golang.org/x/net/context"
 )
 
+// DefaultDeployTimeout is the default amount of time to wait for a deployment
+// to stabilize, when waiting.
+var DefaultDeployTimeout = 10 * time.Minute
+
+// ErrWaitNotSupported is returned when waiting for a deployment, but the
+// scheduler doesn't support it.
+var ErrWaitNotSupported = errors.New("waiting for deployments is not supported by the scheduler")
+
 // Deployment statuses.
 const (
 	StatusPending = "pending"
 	StatusFailed  = "failed"
 	StatusSuccess = "success"
+
+	// StatusCanary is the status of a deployment whose release is running
+	// as a canary, until it's promoted or aborted.
+	StatusCanary = "canary"
 )
 
+// Deployment sources, which describe what triggered a deployment.
+const (
+	SourceAPI      = "api"
+	SourceGitHub   = "github"
+	SourceRollback = "rollback"
+
+	// SourcePromotion is the source of a deployment that promoted a
+	// release from another app.
+	SourcePromotion = "promotion"
+
+	// SourceAppSetup is the source of the first deployment of an app that
+	// was set up from an image's app.json manifest.
+	SourceAppSetup = "app-setup"
+)
+
+// Deployment is a record of an image being deployed to an app, and the outcome
+// of the deployment.
+type Deployment struct {
+	ID string
+
+	AppID string
+	App   *App
+
+	// The image that was deployed.
+	Image image.Image
+
+	// The name of the user that triggered the deployment.
+	UserName string
+
+	// What triggered the deployment. See the Source constants.
+	Source string
+
+	// The status of the deployment. See the Status constants.
+	Status string
+
+	// If the deployment failed, the error message.
+	Error *string
+
+	// The release that was created by the deployment, if it got that far.
+	ReleaseID *string
+	Release   *Release
+
+	CreatedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// newDeployment returns a new pending Deployment.
+func newDeployment(app *App, img image.Image, user *User, source string) *Deployment {
+	d := &Deployment{
+		AppID:  app.ID,
+		Image:  img,
+		Source: source,
+		Status: StatusPending,
+	}
+
+	if user != nil {
+		d.UserName = user.Name
+	}
+
+	return d
+}
+
+// BeforeCreate sets created_at before inserting.
+func (d *Deployment) BeforeCreate() error {
+	t := timex.Now()
+	d.CreatedAt = &t
+	return nil
+}
+
+// Finish marks the deployment as finished. If err is non-nil, the deployment
+// is marked as failed.
+func (d *Deployment) Finish(r *Release, err error) {
+	t := timex.Now()
+	d.FinishedAt = &t
+
+	if r != nil && r.ID != "" {
+		d.ReleaseID = &r.ID
+		d.Release = r
+	}
+
+	if err != nil {
+		msg := err.Error()
+		d.Status = StatusFailed
+		d.Error = &msg
+	} else {
+		d.Status = StatusSuccess
+	}
+}
+
+// Canary marks the deployment as running a canary of the release.
+func (d *Deployment) Canary(r *Release) {
+	d.Status = StatusCanary
+	d.ReleaseID = &r.ID
+	d.Release = r
+}
+
+// DeploymentsQuery is a Scope implementation for common things to filter
+// deployments by.
+type DeploymentsQuery struct {
+	// If provided, finds the deployment with the given id.
+	ID *string
+
+	// If provided, filters deployments belonging to the given app.
+	App *App
+
+	// If provided, uses the limit and sorting parameters specified in the range.
+	Range headerutil.Range
+}
+
+// Scope implements the Scope interface.
+func (q DeploymentsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.ID != nil {
+		scope = append(scope, ID(*q.ID))
+	}
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	scope = append(scope, Range(q.Range.WithDefaults(q.DefaultRange())))
+
+	scope = append(scope, Preload("App", "Release"))
+
+	return scope.Scope(db)
+}
+
+// DefaultRange returns the default headerutil.Range used if values aren't
+// provided.
+func (q DeploymentsQuery) DefaultRange() headerutil.Range {
+	sort, order := "created_at", "desc"
+	return headerutil.Range{
+		Sort:  &sort,
+		Order: &order,
+	}
+}
+
+// DeploymentsFirst returns the first matching deployment.
+func (s *store) DeploymentsFirst(scope Scope) (*Deployment, error) {
+	var deployment Deployment
+	return &deployment, s.First(scope, &deployment)
+}
+
+// Deployments returns all deployments matching the scope.
+func (s *store) Deployments(scope Scope) ([]*Deployment, error) {
+	var deployments []*Deployment
+	return deployments, s.Find(scope, &deployments)
+}
+
+// DeploymentsCreate persists the Deployment.
+func (s *store) DeploymentsCreate(d *Deployment) (*Deployment, error) {
+	return deploymentsCreate(s.db, d)
+}
+
+// DeploymentsUpdate updates the status of the Deployment.
+func (s *store) DeploymentsUpdate(d *Deployment) error {
+	return deploymentsUpdate(s.db, d)
+}
+
+// DeploymentsOutput returns the output of the Deployment so far.
+func (s *store) DeploymentsOutput(d *Deployment) (string, error) {
+	return deploymentsOutput(s.db, d)
+}
+
+// DeploymentsAppendOutput appends to the output of the Deployment.
+func (s *store) DeploymentsAppendOutput(d *Deployment, p []byte) error {
+	return deploymentsAppendOutput(s.db, d, p)
+}
+
+func deploymentsCreate(db *gorm.DB, d *Deployment) (*Deployment, error) {
+	return d, db.Create(d).Error
+}
+
+// deploymentsUpdate only updates the columns that change when a deployment
+// finishes, so that associations aren't saved.
+func deploymentsUpdate(db *gorm.DB, d *Deployment) error {
+	return db.Model(d).UpdateColumns(map[string]interface{}{
+		"status":      d.Status,
+		"error":       d.Error,
+		"release_id":  d.ReleaseID,
+		"finished_at": d.FinishedAt,
+	}).Error
+}
+
+// The output is stored separately from the Deployment, since it can be large
+// and is only needed when it's asked for.
+func deploymentsOutput(db *gorm.DB, d *Deployment) (string, error) {
+	var output string
+	return output, db.Raw(`select output from deployments where id = ?`, d.ID).Row().Scan(&output)
+}
+
+func deploymentsAppendOutput(db *gorm.DB, d *Deployment, p []byte) error {
+	return db.Exec(`update deployments set output = output || ? where id = ?`, string(p), d.ID).Error
+}
+
 // DeploymentsCreateOpts represents options that can be passed when creating a
 // new Deployment.
 type DeploymentsCreateOpts struct {
@@ -29,15 +249,48 @@ type DeploymentsCreateOpts struct {
 	// User the user that is triggering the deployment.
 	User *User
 
+	// Source is what triggered the deployment. The zero value is
+	// SourceAPI.
+	Source string
+
 	// Output is an io.Writer where deployment output and events will be
-	// streamed in jsonmessage format.
+	// streamed in jsonmessage format. The output is also stored with the
+	// Deployment, so it can be optional when deploying asynchronously.
 	Output io.Writer
+
+	// Wait controls whether the deployment waits for the new release to
+	// become stable, streaming progress to Output. If the release doesn't
+	// become stable within the timeout, the deployment fails.
+	//
+	// If automatic rollbacks are enabled for the app (see
+	// AutoRollbackVar), and the release fails health checks, it's rolled
+	// back to the previous release. Without Wait, this happens in the
+	// background.
+	Wait bool
+
+	// If provided, the new release is run as a canary alongside the
+	// existing release, until it's promoted or aborted.
+	Canary *CanaryOpts
+
+	// If provided, config vars to set (or unset, if the value is nil) in
+	// the same release as the new image.
+	Vars Vars
+
+	// If provided, changes to the formation to apply in the same release
+	// as the new image.
+	Formation []*FormationUpdate
 }
 
 // deployer is an interface that represents something that can perform a
 // deployment.
 type deployer interface {
 	Deploy(context.Context, DeploymentsCreateOpts) (*Release, error)
+
+	// DeployAsync performs the deployment in the background.
+	DeployAsync(context.Context, DeploymentsCreateOpts) (*Deployment, error)
+
+	// Plan returns what the deployment would do, without doing it.
+	Plan(context.Context, DeploymentsCreateOpts) (*Plan, error)
 }
 
 // deployerService is an implementation of the deployer interface that performs
@@ -47,30 +300,63 @@ type deployerService struct {
 	*configsService
 	*slugsService
 	*releasesService
+
+	store *store
+
+	// Used to automatically promote canaries after the bake time.
+	canaries *canaryService
+
+	locker *appLocker
+
+	// The scheduler to use to wait for a deployment to stabilize.
+	scheduler scheduler.Scheduler
+
+	// The maximum amount of time to wait for a deployment to stabilize.
+	// The zero value is DefaultDeployTimeout.
+	timeout time.Duration
 }
 
-// doDeploy does the actual deployment
-func (s *deployerService) doDeploy(ctx context.Context, opts DeploymentsCreateOpts) (*Release, error) {
+// findApp returns the app that the image should be deployed to.
+func (s *deployerService) findApp(opts DeploymentsCreateOpts) (*App, error) {
 	app, img := opts.App, opts.Image
 
 	// If no app is specified, attempt to find the app that relates to this
 	// images repository, or create it if not found.
 	if app == nil {
-		var err error
-		app, err = s.appsService.AppsFindOrCreateByRepo(img.Repository)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// If the app doesn't already have a repo attached to it, we'll attach
-		// this image's repo.
-		if err := s.appsService.AppsEnsureRepo(app, img.Repository); err != nil {
-			return nil, err
-		}
+		return s.appsService.AppsFindOrCreateByRepo(img.Repository)
+	}
+
+	// If the app doesn't already have a repo attached to it, we'll attach
+	// this image's repo.
+	if err := s.appsService.AppsEnsureRepo(app, img.Repository); err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// doDeploy does the actual deployment
+func (s *deployerService) doDeploy(ctx context.Context, app *App, opts DeploymentsCreateOpts) (*Release, error) {
+	img := opts.Image
+
+	if err := s.store.canaryRunning(app); err != nil {
+		return nil, err
 	}
 
-	// Grab the latest config.
-	config, err := s.ConfigsCurrent(app)
+	first, err := s.firstDeploy(app)
+	if err != nil {
+		return nil, err
+	}
+
+	// A canary is run alongside the existing release, so there needs to
+	// be one.
+	if opts.Canary != nil && first {
+		return nil, &ValidationError{Err: fmt.Errorf("%s has no releases to run a canary alongside", app.Name)}
+	}
+
+	// Grab the latest config. If the app doesn't have one yet, a new one
+	// is inserted along with the release.
+	config, err := s.latest(app)
 	if err != nil {
 		return nil, err
 	}
@@ -81,34 +367,455 @@ func (s *deployerService) doDeploy(ctx context.Context, opts DeploymentsCreateOp
 		return nil, err
 	}
 
+	if first {
+		if opts, err = setupOpts(config, slug, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Apply any config changes, so that they're released along with the
+	// new image. The new config is inserted in the same transaction as the
+	// release, so it isn't left behind if the deployment fails.
+	if len(opts.Vars) > 0 {
+		config = NewConfig(config, opts.Vars)
+	}
+
 	// Create a new release for the Config
 	// and Slug.
+	r := &Release{
+		App:            app,
+		Config:         config,
+		Slug:           slug,
+		RequestedImage: img,
+		Description:    deployDescription(img, opts),
+	}
+
+	if opts.Canary != nil {
+		return s.ReleasesCreateCanary(ctx, r, *opts.Canary, opts.Formation...)
+	}
+
+	r, err = s.ReleasesCreate(ctx, r, opts.Formation...)
+	if err != nil || !first || slug.Manifest.Scripts.Postdeploy == "" {
+		return r, err
+	}
+
+	if opts.Output != nil {
+		msg := jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Running postdeploy script `%s`", slug.Manifest.Scripts.Postdeploy)}
+		if err := json.NewEncoder(opts.Output).Encode(&msg); err != nil {
+			return r, err
+		}
+	}
+
+	return r, s.runPostdeploy(ctx, r)
+}
+
+// firstDeploy returns true if the app doesn't have any releases yet.
+func (s *deployerService) firstDeploy(app *App) (bool, error) {
+	_, err := s.store.ReleasesFirstPlan(ReleasesQuery{App: app})
+	if err == gorm.RecordNotFound {
+		return true, nil
+	}
+	return false, err
+}
+
+// setupOpts returns the options for the first deployment of an app, which
+// include the config vars and formation from the app.json manifest of the
+// slug. Config vars and formation changes from the deployment take
+// precedence. A ValidationError is returned if the manifest requires config
+// vars that aren't set.
+func setupOpts(config *Config, slug *Slug, opts DeploymentsCreateOpts) (DeploymentsCreateOpts, error) {
+	m := slug.Manifest
+	if m.IsZero() {
+		return opts, nil
+	}
+
+	vars, err := m.configVars(config, opts.Vars)
+	if err != nil {
+		return opts, err
+	}
+
+	updates, err := m.formationUpdates(NewFormation(nil, slug.ProcessTypes, slug.Procfile))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Vars = vars
+	opts.Formation = append(updates, opts.Formation...)
+
+	return opts, nil
+}
+
+// deployDescription returns the description for a release created by a
+// deployment, including any config or formation changes.
+func deployDescription(img image.Image, opts DeploymentsCreateOpts) string {
 	desc := fmt.Sprintf("Deploy %s", img.String())
 
-	r, err := s.ReleasesCreate(ctx, &Release{
-		App:         app,
-		Config:      config,
-		Slug:        slug,
-		Description: desc,
-	})
+	if len(opts.Vars) > 0 {
+		var keys []string
+		for k := range opts.Vars {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+
+		desc += fmt.Sprintf(", set %s config vars", strings.Join(keys, ","))
+	}
+
+	if len(opts.Formation) > 0 {
+		var updates []string
+		for _, up := range opts.Formation {
+			updates = append(updates, fmt.Sprintf("%s=%d", up.Process, up.Quantity))
+		}
+
+		desc += fmt.Sprintf(", scale %s", strings.Join(updates, ","))
+	}
+
+	return desc
+}
+
+// begin validates the options, and records a pending Deployment for the app
+// that the image is being deployed to.
+func (s *deployerService) begin(opts DeploymentsCreateOpts) (*Deployment, error) {
+	if opts.Canary != nil {
+		if err := opts.Canary.Validate(); err != nil {
+			return nil, err
+		}
+
+		// Check up front, so that nothing is created for a canary
+		// that can't be run.
+		if !scheduler.CanariesSupported(s.scheduler) {
+			return nil, &ValidationError{Err: scheduler.ErrCanaryNotSupported}
+		}
+	}
+
+	app, err := s.findApp(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	source := opts.Source
+	if source == "" {
+		source = SourceAPI
+	}
+
+	d, err := s.store.DeploymentsCreate(newDeployment(app, opts.Image, opts.User, source))
+	if err != nil {
+		return d, err
+	}
+	d.App = app
+
+	return d, nil
+}
+
+// deploy performs a recorded Deployment, and optionally waits for it to
+// stabilize. The app is only locked until the release has been created and
+// submitted, so that other operations (including rolling back) aren't blocked
+// while waiting.
+func (s *deployerService) deploy(ctx context.Context, d *Deployment, opts DeploymentsCreateOpts, enc *json.Encoder) (*Release, error) {
+	app := d.App
+
+	unlock, err := s.locker.Lock(ctx, app)
+	if err != nil {
+		d.Finish(nil, err)
+		if uerr := s.store.DeploymentsUpdate(d); uerr != nil {
+			return nil, uerr
+		}
+		return nil, err
+	}
+
+	r, err := s.doDeploy(ctx, app, opts)
+
+	// Once the canary is running, the deployment stays in the canary
+	// state until it's promoted or aborted. It's marked before the lock
+	// is released, so that nothing else is released in the meantime.
+	if err == nil && opts.Canary != nil {
+		d.Canary(r)
+		err = s.store.DeploymentsUpdate(d)
+	}
+
+	unlock()
+
+	// Canaries are never rolled back automatically, since they can be
+	// aborted.
+	autoRollback := err == nil && opts.Canary == nil && autoRollbackEnabled(r.Config)
+
+	if err == nil && opts.Wait {
+		created := jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Created new release v%d for %s, waiting for it to become stable", r.Version, r.App.Name)}
+		err = enc.Encode(&created)
+		if err == nil {
+			err = s.wait(ctx, r, enc)
+		}
+		if _, ok := err.(*scheduler.UnhealthyError); ok && autoRollback {
+			err = s.autoRollback(ctx, r, err, enc)
+		}
+	}
+
+	// If the canary failed after it was scheduled (e.g. it didn't become
+	// stable), roll back to the release it was running alongside, which
+	// removes the canaries.
+	if err != nil && r != nil && r.ID != "" && opts.Canary != nil {
+		if rerr := s.rollbackCanary(ctx, r, err); rerr != nil {
+			err = fmt.Errorf("%v (and rolling back to v%d failed: %v)", err, r.Version-1, rerr)
+		}
+	}
+
+	if err == nil && opts.Canary != nil {
+		if opts.Canary.BakeTime > 0 {
+			s.canaries.bake(ctx, d.ID, opts.Canary.BakeTime)
+		}
+
+		return r, nil
+	}
+
+	d.Finish(r, err)
+	if uerr := s.store.DeploymentsUpdate(d); uerr != nil && err == nil {
+		err = uerr
+	}
+
+	// If we didn't wait for the release to stabilize, keep an eye on it in
+	// the background so that it can still be rolled back.
+	if err == nil && autoRollback && !opts.Wait {
+		s.monitor(ctx, d, r)
+	}
 
 	return r, err
 }
 
-// Deploy is a thin wrapper around doDeploy to handle errors & output more cleanly
-func (s *deployerService) Deploy(ctx context.Context, opts DeploymentsCreateOpts) (*Release, error) {
-	var msg jsonmessage.JSONMessage
+// rollbackCanary rolls back to the release before the canary's release, with
+// the app locked. Nothing is done if the canary's release isn't the current
+// release anymore (e.g. it was aborted while waiting).
+func (s *deployerService) rollbackCanary(ctx context.Context, r *Release, cause error) error {
+	unlock, err := s.rollbackLocker().Lock(ctx, r.App)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	r, err := s.doDeploy(ctx, opts)
+	current, err := s.store.ReleasesFirst(ReleasesQuery{App: r.App})
+	if err != nil {
+		return err
+	}
+
+	if current.ID != r.ID {
+		return nil
+	}
+
+	reason := fmt.Sprintf("canary of v%d failed: %v", r.Version, cause)
+	_, err = s.rollback(ctx, r.App, r.Version-1, reason, RollbackOpts{})
+	return err
+}
+
+// run performs the Deployment, writing output to both opts.Output and the
+// deployment's stored output, and finishes with a status message.
+func (s *deployerService) run(ctx context.Context, d *Deployment, opts DeploymentsCreateOpts) (*Release, error) {
+	output := newDeploymentOutput(ctx, s.store, d)
+	defer output.Flush()
+
+	// The stored output comes first, since it never fails, so that it
+	// still gets everything if writing to opts.Output fails.
+	var w io.Writer = output
+	if opts.Output != nil {
+		w = io.MultiWriter(w, opts.Output)
+	}
+	opts.Output = w
+
+	enc := json.NewEncoder(w)
+
+	r, err := s.deploy(ctx, d, opts, enc)
+
+	var msg jsonmessage.JSONMessage
 	if err != nil {
 		msg = newJSONMessageError(err)
+	} else if opts.Canary != nil {
+		msg = jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Created canary of release v%d for %s, promote or abort deployment %s", r.Version, r.App.Name, d.ID)}
+	} else if opts.Wait {
+		msg = jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Release v%d for %s is stable", r.Version, r.App.Name)}
 	} else {
 		msg = jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Created new release v%d for %s", r.Version, r.App.Name)}
 	}
 
-	if err := json.NewEncoder(opts.Output).Encode(&msg); err != nil {
+	if err := enc.Encode(&msg); err != nil {
 		return r, err
 	}
 
 	return r, nil
 }
+
+// Deploy is a thin wrapper around deploy to handle errors & output more cleanly
+func (s *deployerService) Deploy(ctx context.Context, opts DeploymentsCreateOpts) (*Release, error) {
+	d, err := s.begin(opts)
+	if err != nil {
+		msg := newJSONMessageError(err)
+		return nil, json.NewEncoder(opts.Output).Encode(&msg)
+	}
+
+	return s.run(ctx, d, opts)
+}
+
+// DeployAsync records the Deployment and returns it immediately, performing
+// it in the background. The output can be retrieved later with
+// DeploymentsOutput, and the status by polling the Deployment. Errors that
+// happen before the Deployment is recorded are returned.
+func (s *deployerService) DeployAsync(ctx context.Context, opts DeploymentsCreateOpts) (*Deployment, error) {
+	d, err := s.begin(opts)
+	if err != nil {
+		return d, err
+	}
+
+	go s.run(ctx, d, opts)
+
+	return d, nil
+}
+
+// Plan returns what deploying the image would do, without persisting anything
+// or changing the scheduler. Unlike Deploy, the app must already exist.
+func (s *deployerService) Plan(ctx context.Context, opts DeploymentsCreateOpts) (*Plan, error) {
+	if opts.Canary != nil {
+		return nil, &ValidationError{Err: errors.New("canary deployments can't be planned")}
+	}
+
+	app := opts.App
+	if app == nil {
+		name := AppNameFromRepo(opts.Image.Repository)
+		a, err := s.store.AppsFirst(AppsQuery{Name: &name})
+		if err != nil {
+			if err == gorm.RecordNotFound {
+				return nil, &ValidationError{Err: fmt.Errorf("%s doesn't exist yet, so deploying to it can't be planned", name)}
+			}
+			return nil, err
+		}
+		app = a
+	}
+
+	config, err := s.configsService.latest(app)
+	if err != nil {
+		return nil, err
+	}
+
+	out := opts.Output
+	if out == nil {
+		out = ioutil.Discard
+	}
+
+	slug, err := s.SlugsPlanByImage(ctx, opts.Image, out)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := s.firstDeploy(app)
+	if err != nil {
+		return nil, err
+	}
+
+	if first {
+		if opts, err = setupOpts(config, slug, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.Vars) > 0 {
+		config = NewConfig(config, opts.Vars)
+	}
+
+	return s.releasesService.plan(ctx, &Release{
+		App:            app,
+		Config:         config,
+		Slug:           slug,
+		RequestedImage: opts.Image,
+		Description:    deployDescription(opts.Image, opts),
+	}, opts.Formation)
+}
+
+// deploymentOutputFlushInterval is the minimum amount of time between appends
+// to the stored output of a Deployment.
+var deploymentOutputFlushInterval = 5 * time.Second
+
+// deploymentOutput is an io.Writer that appends to the stored output of a
+// Deployment, so that it can be retrieved after the fact. Output is buffered
+// and appended in batches, since every append rewrites the whole column.
+// Flush must be called when finished.
+//
+// Errors storing the output are reported instead of returned, so that they
+// don't fail the deployment.
+type deploymentOutput struct {
+	ctx        context.Context
+	store      *store
+	deployment *Deployment
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	flushed time.Time
+}
+
+func newDeploymentOutput(ctx context.Context, s *store, d *Deployment) *deploymentOutput {
+	return &deploymentOutput{
+		ctx:        ctx,
+		store:      s,
+		deployment: d,
+		flushed:    time.Now(),
+	}
+}
+
+// Write implements the io.Writer interface.
+func (w *deploymentOutput) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+
+	if time.Since(w.flushed) >= deploymentOutputFlushInterval {
+		w.flush()
+	}
+
+	return len(p), nil
+}
+
+// Flush appends any buffered output to the stored output.
+func (w *deploymentOutput) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.flush()
+}
+
+func (w *deploymentOutput) flush() {
+	w.flushed = time.Now()
+
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	// If appending fails, the output stays buffered, and is retried on
+	// the next flush.
+	if err := w.store.DeploymentsAppendOutput(w.deployment, w.buf.Bytes()); err != nil {
+		reporter.Report(w.ctx, err)
+		return
+	}
+
+	w.buf.Reset()
+}
+
+// wait waits for the release to become stable, streaming status updates from
+// the scheduler to enc as jsonmessages.
+func (s *deployerService) wait(ctx context.Context, r *Release, enc *json.Encoder) error {
+	st, ok := s.scheduler.(scheduler.Stabilizer)
+	if !ok {
+		return ErrWaitNotSupported
+	}
+
+	timeout := s.timeout
+	if timeout == 0 {
+		timeout = DefaultDeployTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := st.Stabilize(ctx, r.App.ID, scheduler.StatusStreamFunc(func(status scheduler.Status) error {
+		return enc.Encode(&jsonmessage.JSONMessage{Status: status.Message})
+	}))
+	if err == context.DeadlineExceeded {
+		return fmt.Errorf("release v%d did not become stable within %v", r.Version, timeout)
+	}
+
+	return err
+}
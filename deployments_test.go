@@ -0,0 +1,204 @@
+package empire
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+func TestDeploymentsQuery(t *testing.T) {
+	var (
+		app = &App{ID: "1234"}
+		id  = "abcd"
+	)
+
+	tests := scopeTests{
+		{DeploymentsQuery{}, "ORDER BY created_at desc", []interface{}{}},
+		{DeploymentsQuery{App: app}, "WHERE (app_id = $1) ORDER BY created_at desc", []interface{}{"1234"}},
+		{DeploymentsQuery{ID: &id}, "WHERE (id = $1) ORDER BY created_at desc", []interface{}{"abcd"}},
+	}
+
+	tests.Run(t)
+}
+
+func TestDeployment_Finish(t *testing.T) {
+	d := newDeployment(&App{ID: "1234"}, image.Image{Repository: "remind101/acme-inc", Tag: "latest"}, &User{Name: "ejholmes"}, SourceAPI)
+
+	if got, want := d.Status, StatusPending; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := d.UserName, "ejholmes"; got != want {
+		t.Fatalf("UserName => %s; want %s", got, want)
+	}
+
+	d.Finish(&Release{ID: "5678"}, nil)
+
+	if got, want := d.Status, StatusSuccess; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if d.ReleaseID == nil || *d.ReleaseID != "5678" {
+		t.Fatalf("ReleaseID => %v; want 5678", d.ReleaseID)
+	}
+
+	if d.FinishedAt == nil {
+		t.Fatal("expected FinishedAt to be set")
+	}
+
+	d = newDeployment(&App{ID: "1234"}, image.Image{Repository: "remind101/acme-inc", Tag: "latest"}, nil, SourceRollback)
+	d.Finish(nil, errors.New("boom"))
+
+	if got, want := d.Status, StatusFailed; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if d.Error == nil || *d.Error != "boom" {
+		t.Fatalf("Error => %v; want boom", d.Error)
+	}
+
+	if d.ReleaseID != nil {
+		t.Fatalf("ReleaseID => %v; want nil", *d.ReleaseID)
+	}
+}
+
+func TestDeployDescription(t *testing.T) {
+	img := image.Image{Repository: "remind101/acme-inc", Tag: "latest"}
+	production := "production"
+
+	tests := []struct {
+		opts DeploymentsCreateOpts
+		out  string
+	}{
+		{DeploymentsCreateOpts{}, "Deploy remind101/acme-inc:latest"},
+		{DeploymentsCreateOpts{Vars: Vars{"RAILS_ENV": &production, "DEBUG": nil}}, "Deploy remind101/acme-inc:latest, set DEBUG,RAILS_ENV config vars"},
+		{DeploymentsCreateOpts{Formation: []*FormationUpdate{{Process: "web", Quantity: 2}}}, "Deploy remind101/acme-inc:latest, scale web=2"},
+	}
+
+	for _, tt := range tests {
+		if got := deployDescription(img, tt.opts); got != tt.out {
+			t.Errorf("deployDescription => %q; want %q", got, tt.out)
+		}
+	}
+}
+
+func TestSetupOpts(t *testing.T) {
+	var (
+		DATABASE_URL = "postgres://"
+		two          = 2
+	)
+
+	slug := &Slug{
+		ProcessTypes: CommandMap{"web": "./bin/web", "worker": "./bin/worker"},
+		Manifest: AppManifest{
+			Env:       map[string]*AppManifestEnv{"DATABASE_URL": {}},
+			Formation: map[ProcessType]*AppManifestFormation{"web": {Quantity: &two}},
+		},
+	}
+
+	if _, err := setupOpts(&Config{}, slug, DeploymentsCreateOpts{}); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("err => %T; want *ValidationError", err)
+	}
+
+	opts, err := setupOpts(&Config{}, slug, DeploymentsCreateOpts{
+		Vars:      Vars{"DATABASE_URL": &DATABASE_URL},
+		Formation: []*FormationUpdate{{Process: "worker", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := opts.Vars, (Vars{"DATABASE_URL": &DATABASE_URL}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars => %v; want %v", got, want)
+	}
+
+	// Formation changes from the deployment are applied after the
+	// manifest's.
+	want := []*FormationUpdate{{Process: "web", Quantity: 2}, {Process: "worker", Quantity: 1}}
+	if got := opts.Formation; !reflect.DeepEqual(got, want) {
+		t.Errorf("Formation => %v; want %v", got, want)
+	}
+
+	// Without a manifest, the options are unchanged.
+	slug.Manifest = AppManifest{}
+	if opts, err := setupOpts(&Config{}, slug, DeploymentsCreateOpts{}); err != nil || opts.Vars != nil {
+		t.Fatalf("setupOpts() => %v, %v; want no changes", opts.Vars, err)
+	}
+}
+
+func TestDeployerService_Wait(t *testing.T) {
+	s := &deployerService{
+		scheduler: &fakeStabilizer{
+			statuses: []string{"web: 1/2 running, 1 pending", "web: 2/2 running, 0 pending"},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := s.wait(context.Background(), &Release{Version: 1, App: &App{ID: "1234"}}, json.NewEncoder(buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"status":"web: 1/2 running, 1 pending"}
+{"status":"web: 2/2 running, 0 pending"}
+`
+
+	if got, want := buf.String(), expected; got != want {
+		t.Fatalf("Output => %q; want %q", got, want)
+	}
+}
+
+func TestDeployerService_Wait_Timeout(t *testing.T) {
+	s := &deployerService{
+		scheduler: &fakeStabilizer{block: true},
+		timeout:   time.Millisecond,
+	}
+
+	err := s.wait(context.Background(), &Release{Version: 1, App: &App{ID: "1234"}}, json.NewEncoder(new(bytes.Buffer)))
+	if err == nil || !strings.Contains(err.Error(), "did not become stable") {
+		t.Fatalf("err => %v; want a timeout error", err)
+	}
+}
+
+func TestDeployerService_Wait_NotSupported(t *testing.T) {
+	s := &deployerService{
+		scheduler: struct{ scheduler.Scheduler }{scheduler.NewFakeScheduler()},
+	}
+
+	err := s.wait(context.Background(), &Release{Version: 1, App: &App{ID: "1234"}}, json.NewEncoder(new(bytes.Buffer)))
+	if err != ErrWaitNotSupported {
+		t.Fatalf("err => %v; want %v", err, ErrWaitNotSupported)
+	}
+}
+
+// fakeStabilizer is a scheduler.Scheduler that publishes the given statuses
+// when stabilizing. If block is true, it waits for the context to be done.
+type fakeStabilizer struct {
+	*scheduler.FakeScheduler
+	statuses []string
+	block    bool
+}
+
+func (s *fakeStabilizer) Stabilize(ctx context.Context, app string, ss scheduler.StatusStream) error {
+	for _, status := range s.statuses {
+		if err := ss.Publish(scheduler.Status{Message: status}); err != nil {
+			return err
+		}
+	}
+
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return nil
+}
@@ -1,20 +1,27 @@
 package empire // import "github.com/remind101/empire"
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/inconshreveable/log15"
 	"github.com/mattes/migrate/migrate"
 	"github.com/remind101/empire/pkg/dockerutil"
+	"github.com/remind101/empire/pkg/registry"
 	"github.com/remind101/empire/pkg/runner"
 	"github.com/remind101/empire/pkg/sslcert"
 	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/empire/scheduler/cloudformation"
+	dockerscheduler "github.com/remind101/empire/scheduler/docker"
 	"github.com/remind101/empire/scheduler/ecs"
+	"github.com/remind101/empire/scheduler/kubernetes"
 	"github.com/remind101/pkg/reporter"
 	"golang.org/x/net/context"
 )
@@ -34,6 +41,26 @@ const (
 
 	// WebProcessType is the process type we assume are web server processes.
 	WebProcessType = "web"
+
+	// ReleaseProcessType is the process type that's run as a one off
+	// process before a new release is created. If it fails, the release is
+	// aborted. It's never run as a long running process.
+	ReleaseProcessType = "release"
+
+	// PostdeployProcessType is the process type of the postdeploy script
+	// from an app.json manifest, which is run as a one off process after
+	// an app is first deployed.
+	PostdeployProcessType = "postdeploy"
+
+	// ExposedProcessesVar is the config var that can be set to a comma
+	// separated list of process types, other than web, that should be
+	// assigned a port and exposed behind a load balancer.
+	ExposedProcessesVar = "EMPIRE_EXPOSED_PROCESSES"
+
+	// AutoRollbackVar is the config var that can be set to true to
+	// automatically roll back to the previous release when a new release
+	// fails health checks.
+	AutoRollbackVar = "EMPIRE_AUTO_ROLLBACK"
 )
 
 // DockerOptions is a set of options to configure a docker api client.
@@ -46,6 +73,14 @@ type DockerOptions struct {
 
 	// A set of docker registry credentials.
 	Auth *docker.AuthConfigurations
+
+	// If true, images are resolved, and their Procfiles are extracted,
+	// using the Docker Registry API, instead of the docker daemon.
+	Registry bool
+
+	// If true, registries are accessed over http instead of https when
+	// using the Docker Registry API.
+	RegistryInsecure bool
 }
 
 // ECSOptions is a set of options to configure ECS.
@@ -72,12 +107,26 @@ type ELBOptions struct {
 	InternalZoneID string
 }
 
+// KubernetesOptions is a set of options to configure the Kubernetes scheduler.
+type KubernetesOptions struct {
+	// The location of the Kubernetes API server.
+	URL string
+
+	// The namespace to create resources within.
+	Namespace string
+
+	// A bearer token to authenticate with the API server.
+	Token string
+}
+
 // Options is provided to New to configure the Empire services.
 type Options struct {
 	Docker DockerOptions
 	ECS    ECSOptions
 	ELB    ELBOptions
 
+	Kubernetes KubernetesOptions
+
 	// AWS Configuration
 	AWSConfig *aws.Config
 
@@ -88,6 +137,19 @@ type Options struct {
 
 	// Location of the app logs
 	LogsStreamer string
+
+	// The scheduler backend to use. Valid values are "ecs" (the default,
+	// also used when empty), "cloudformation", "docker" and "kubernetes".
+	Scheduler string
+
+	// The maximum amount of time to wait for a deployment to stabilize,
+	// when waiting. The zero value is DefaultDeployTimeout.
+	DeployTimeout time.Duration
+
+	// The amount of time to wait for another operation on an app (e.g. a
+	// deploy) to finish, before failing with ErrAppLocked. The zero value
+	// fails immediately.
+	LockTimeout time.Duration
 }
 
 // Empire is a context object that contains a collection of services.
@@ -103,15 +165,19 @@ type Empire struct {
 
 	accessTokens *accessTokensService
 	apps         *appsService
+	canaries     *canaryService
 	certs        *certificatesService
 	configs      *configsService
 	domains      *domainsService
+	gc           *gcService
 	jobStates    *processStatesService
+	promotions   *promotionsService
 	releases     *releasesService
 	deployer     deployer
 	scaler       *scaler
 	restarter    *restarter
 	runner       *runnerService
+	setups       *appSetupsService
 	logs         LogsStreamer
 }
 
@@ -139,16 +205,16 @@ func New(options Options) (*Empire, error) {
 		return nil, err
 	}
 
-	scheduler, err := newManager(
-		runner,
-		options.ECS,
-		options.ELB,
-		options.AWSConfig,
-	)
+	scheduler, err := newScheduler(options, runner)
 	if err != nil {
 		return nil, err
 	}
 
+	locker := &appLocker{
+		store:   store,
+		timeout: options.LockTimeout,
+	}
+
 	accessTokens := &accessTokensService{
 		Secret: []byte(options.Secret),
 	}
@@ -165,6 +231,7 @@ func New(options Options) (*Empire, error) {
 	scaler := &scaler{
 		store:     store,
 		scheduler: scheduler,
+		locker:    locker,
 	}
 
 	releaser := &releaser{
@@ -178,13 +245,16 @@ func New(options Options) (*Empire, error) {
 	}
 
 	releases := &releasesService{
-		store:    store,
-		releaser: releaser,
+		store:     store,
+		releaser:  releaser,
+		scheduler: scheduler,
+		locker:    locker,
 	}
 
 	configs := &configsService{
 		store:    store,
 		releases: releases,
+		locker:   locker,
 	}
 
 	domains := &domainsService{
@@ -197,11 +267,23 @@ func New(options Options) (*Empire, error) {
 		resolver:  resolver,
 	}
 
+	canaries := &canaryService{
+		store:    store,
+		releaser: releaser,
+		releases: releases,
+		locker:   locker,
+	}
+
 	deployer := &deployerService{
 		appsService:     apps,
 		configsService:  configs,
 		slugsService:    slugs,
 		releasesService: releases,
+		store:           store,
+		canaries:        canaries,
+		locker:          locker,
+		scheduler:       scheduler,
+		timeout:         options.DeployTimeout,
 	}
 
 	certs := &certificatesService{
@@ -215,6 +297,25 @@ func New(options Options) (*Empire, error) {
 		scheduler: scheduler,
 	}
 
+	promotions := &promotionsService{
+		store:    store,
+		configs:  configs,
+		releases: releases,
+		locker:   locker,
+	}
+
+	setups := &appSetupsService{
+		store:    store,
+		slugs:    slugs,
+		deployer: deployer,
+	}
+
+	gc := &gcService{
+		store:     store,
+		scheduler: scheduler,
+		locker:    locker,
+	}
+
 	logs := newLogStreamer(options.LogsStreamer)
 
 	return &Empire{
@@ -222,15 +323,19 @@ func New(options Options) (*Empire, error) {
 		store:        store,
 		accessTokens: accessTokens,
 		apps:         apps,
+		canaries:     canaries,
 		certs:        certs,
 		configs:      configs,
 		deployer:     deployer,
 		domains:      domains,
+		gc:           gc,
 		jobStates:    jobStates,
+		promotions:   promotions,
 		scaler:       scaler,
 		restarter:    restarter,
 		runner:       runnerService,
 		releases:     releases,
+		setups:       setups,
 		logs:         logs,
 	}, nil
 }
@@ -290,6 +395,11 @@ func (e *Empire) ConfigsCurrent(app *App) (*Config, error) {
 	return e.configs.ConfigsCurrent(app)
 }
 
+// ConfigsApplyPlan returns what applying the vars would do, without doing it.
+func (e *Empire) ConfigsApplyPlan(ctx context.Context, app *App, vars Vars) (*Plan, error) {
+	return e.configs.ConfigsApplyPlan(ctx, app, vars)
+}
+
 // ConfigsApply applies the new config vars to the apps current Config,
 // returning a new Config. If the app has a running release, a new release will
 // be created and run.
@@ -322,14 +432,16 @@ func (e *Empire) JobStatesByApp(ctx context.Context, app *App) ([]*ProcessState,
 	return e.jobStates.JobStatesByApp(ctx, app)
 }
 
-// ProcessesRestart restarts processes matching the given prefix for the given Release.
-// If the prefix is empty, it will match all processes for the release.
+// ProcessesRestart restarts processes for the given App. The id can be empty,
+// which restarts all processes, a process type (e.g. "web"), which does a
+// rolling restart of that process type, or a single instance (e.g. "web.3").
 func (e *Empire) ProcessesRestart(ctx context.Context, app *App, id string) error {
 	return e.restarter.Restart(ctx, app, id)
 }
 
-// ProcessesRun runs a one-off process for a given App and command.
-func (e *Empire) ProcessesRun(ctx context.Context, app *App, opts ProcessRunOpts) error {
+// ProcessesRun runs a one-off process for a given App and command. If the
+// process is run detached, the state of the started process is returned.
+func (e *Empire) ProcessesRun(ctx context.Context, app *App, opts ProcessRunOpts) (*ProcessState, error) {
 	return e.runner.Run(ctx, app, opts)
 }
 
@@ -350,8 +462,48 @@ func (e *Empire) ReleasesLast(app *App) (*Release, error) {
 
 // ReleasesRollback rolls an app back to a specific release version. Returns a
 // new release.
-func (e *Empire) ReleasesRollback(ctx context.Context, app *App, version int) (*Release, error) {
-	return e.releases.ReleasesRollback(ctx, app, version)
+func (e *Empire) ReleasesRollback(ctx context.Context, app *App, version int, opts RollbackOpts) (*Release, error) {
+	return e.releases.ReleasesRollback(ctx, app, version, opts)
+}
+
+// ReleasesRollbackPlan returns what rolling back to a specific release version
+// would do, without doing it.
+func (e *Empire) ReleasesRollbackPlan(ctx context.Context, app *App, version int, opts RollbackOpts) (*Plan, error) {
+	return e.releases.ReleasesRollbackPlan(ctx, app, version, opts)
+}
+
+// ReleasesPin pins or unpins a release, so that it's never garbage collected.
+func (e *Empire) ReleasesPin(ctx context.Context, r *Release, pinned bool) error {
+	return e.store.ReleasesPin(r, pinned)
+}
+
+// GC deletes releases that aren't retained by the policy, along with the
+// configs and slugs that only they used.
+func (e *Empire) GC(ctx context.Context, policy RetentionPolicy) (*GCResult, error) {
+	return e.gc.GC(ctx, policy)
+}
+
+// RunGC runs GC every interval in the background, until the context is
+// canceled.
+func (e *Empire) RunGC(ctx context.Context, policy RetentionPolicy, interval time.Duration) {
+	go e.gc.Run(ctx, policy, interval)
+}
+
+// ReleasesDiff returns what changed between two versions of an app.
+func (e *Empire) ReleasesDiff(app *App, from, to int) (*ReleaseDiff, error) {
+	return e.releases.ReleasesDiff(app, from, to)
+}
+
+// Promote promotes a release from one app to another, keeping the target
+// app's config.
+func (e *Empire) Promote(ctx context.Context, opts PromotionsCreateOpts) (*Release, error) {
+	return e.promotions.Promote(ctx, opts)
+}
+
+// AppSetup creates a new app from an image, and deploys the image to it in the
+// background, using the image's app.json manifest to set up the app.
+func (e *Empire) AppSetup(ctx context.Context, opts AppSetupOpts) (*Deployment, error) {
+	return e.setups.Setup(ctx, opts)
 }
 
 // Deploy deploys an image and streams the output to w.
@@ -359,6 +511,44 @@ func (e *Empire) Deploy(ctx context.Context, opts DeploymentsCreateOpts) (*Relea
 	return e.deployer.Deploy(ctx, opts)
 }
 
+// DeployPlan returns what deploying an image would do, without doing it.
+func (e *Empire) DeployPlan(ctx context.Context, opts DeploymentsCreateOpts) (*Plan, error) {
+	return e.deployer.Plan(ctx, opts)
+}
+
+// DeployAsync records a deployment of an image, and performs it in the
+// background.
+func (e *Empire) DeployAsync(ctx context.Context, opts DeploymentsCreateOpts) (*Deployment, error) {
+	return e.deployer.DeployAsync(ctx, opts)
+}
+
+// DeploymentsOutput returns the jsonmessage output of a deployment so far.
+func (e *Empire) DeploymentsOutput(d *Deployment) (string, error) {
+	return e.store.DeploymentsOutput(d)
+}
+
+// Deployments returns a list of deployments.
+func (e *Empire) Deployments(q DeploymentsQuery) ([]*Deployment, error) {
+	return e.store.Deployments(q)
+}
+
+// DeploymentsFirst returns the first deployment matching the query.
+func (e *Empire) DeploymentsFirst(q DeploymentsQuery) (*Deployment, error) {
+	return e.store.DeploymentsFirst(q)
+}
+
+// DeploymentsPromote promotes a canary deployment, replacing all of the
+// processes with the new release.
+func (e *Empire) DeploymentsPromote(ctx context.Context, d *Deployment) error {
+	return e.canaries.Promote(ctx, d)
+}
+
+// DeploymentsAbort aborts a canary deployment, rolling back to the previous
+// release.
+func (e *Empire) DeploymentsAbort(ctx context.Context, d *Deployment) error {
+	return e.canaries.Abort(ctx, d)
+}
+
 func newJSONMessageError(err error) jsonmessage.JSONMessage {
 	return jsonmessage.JSONMessage{
 		ErrorMessage: err.Error(),
@@ -410,6 +600,90 @@ const (
 	UserKey key = 0
 )
 
+func newScheduler(options Options, r *runner.Runner) (scheduler.Scheduler, error) {
+	switch options.Scheduler {
+	case "docker":
+		return newDockerScheduler(options.Docker)
+	case "cloudformation":
+		return newCloudFormationScheduler(r, options.ECS, options.ELB, options.AWSConfig)
+	case "kubernetes":
+		return newKubernetesScheduler(r, options.Kubernetes), nil
+	case "", "ecs":
+		return newManager(r, options.ECS, options.ELB, options.AWSConfig)
+	default:
+		return nil, fmt.Errorf("unknown scheduler: %q", options.Scheduler)
+	}
+}
+
+func newDockerScheduler(o DockerOptions) (scheduler.Scheduler, error) {
+	c, err := dockerutil.NewClient(o.Auth, o.Socket, o.CertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return dockerscheduler.NewScheduler(c), nil
+}
+
+func newCloudFormationScheduler(r *runner.Runner, ecsOpts ECSOptions, elbOpts ELBOptions, config *aws.Config) (scheduler.Scheduler, error) {
+	if config == nil {
+		log.Println("warn: AWS not configured, ECS service management disabled.")
+		return scheduler.NewFakeScheduler(), nil
+	}
+
+	s, err := ecs.NewScheduler(ecs.Config{
+		Cluster: ecsOpts.Cluster,
+		AWS:     config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t := &cloudformation.EmpireTemplate{
+		Cluster:                 ecsOpts.Cluster,
+		ServiceRole:             ecsOpts.ServiceRole,
+		InternalSecurityGroupID: elbOpts.InternalSecurityGroupID,
+		ExternalSecurityGroupID: elbOpts.ExternalSecurityGroupID,
+		InternalSubnetIDs:       elbOpts.InternalSubnetIDs,
+		ExternalSubnetIDs:       elbOpts.ExternalSubnetIDs,
+	}
+
+	if elbOpts.InternalZoneID != "" {
+		zone, err := route53.New(config).GetHostedZone(&route53.GetHostedZoneInput{
+			Id: aws.String(elbOpts.InternalZoneID),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		t.HostedZoneID = elbOpts.InternalZoneID
+		t.HostedZoneName = *zone.HostedZone.Name
+	}
+
+	return &scheduler.AttachedRunner{
+		Scheduler: cloudformation.NewScheduler(s, t, config),
+		Runner:    r,
+	}, nil
+}
+
+func newKubernetesScheduler(r *runner.Runner, o KubernetesOptions) scheduler.Scheduler {
+	c := kubernetes.NewClient(o.URL)
+	c.Namespace = o.Namespace
+	c.Token = o.Token
+
+	var s scheduler.Scheduler = kubernetes.NewScheduler(c)
+
+	// Kubernetes doesn't support attaching to one off processes, so run
+	// them with docker when it's available.
+	if r != nil {
+		s = &scheduler.AttachedRunner{
+			Scheduler: s,
+			Runner:    r,
+		}
+	}
+
+	return s
+}
+
 func newManager(r *runner.Runner, ecsOpts ECSOptions, elbOpts ELBOptions, config *aws.Config) (scheduler.Scheduler, error) {
 	if config == nil {
 		log.Println("warn: AWS not configured, ECS service management disabled.")
@@ -467,6 +741,10 @@ func newLogger() log15.Logger {
 }
 
 func newExtractor(o DockerOptions) (Extractor, error) {
+	if o.Registry {
+		return &registryExtractor{client: newRegistryClient(o)}, nil
+	}
+
 	if o.Socket == "" {
 		log.Println("warn: docker socket not configured, docker command extractor disabled.")
 		return &fakeExtractor{}, nil
@@ -477,6 +755,10 @@ func newExtractor(o DockerOptions) (Extractor, error) {
 }
 
 func newResolver(o DockerOptions) (Resolver, error) {
+	if o.Registry {
+		return &registryResolver{client: newRegistryClient(o)}, nil
+	}
+
 	if o.Socket == "" {
 		log.Println("warn: docker socket not configured, docker image puller disabled.")
 		return &fakeResolver{}, nil
@@ -486,6 +768,12 @@ func newResolver(o DockerOptions) (Resolver, error) {
 	return newDockerResolver(c), err
 }
 
+func newRegistryClient(o DockerOptions) *registry.Client {
+	c := registry.NewClient(o.Auth)
+	c.Insecure = o.RegistryInsecure
+	return c
+}
+
 func newLogStreamer(logsStreamer string) LogsStreamer {
 	if logsStreamer == "kinesis" {
 		return &kinesisLogsStreamer{}
@@ -0,0 +1,21 @@
+package empire
+
+import "testing"
+
+func TestNewScheduler(t *testing.T) {
+	tests := []struct {
+		scheduler string
+		err       bool
+	}{
+		{"", false},
+		{"ecs", false},
+		{"kubernets", true},
+	}
+
+	for _, tt := range tests {
+		_, err := newScheduler(Options{Scheduler: tt.scheduler}, nil)
+		if got := err != nil; got != tt.err {
+			t.Errorf("newScheduler(%q) error = %v", tt.scheduler, err)
+		}
+	}
+}
@@ -10,31 +10,46 @@ import (
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/registry"
+	"golang.org/x/net/context"
 	"gopkg.in/yaml.v2"
 )
 
 var (
-	// Procfile is the name of the Procfile file.
-	Procfile = "Procfile"
+	// ProcfileName is the name of the Procfile file.
+	ProcfileName = "Procfile"
+
+	// ProcessLabelPrefix is the prefix of image labels that define process
+	// types (e.g. empire.process.worker=./bin/worker).
+	ProcessLabelPrefix = "empire.process."
 )
 
 // Extractor represents an object that can extract the process types from an
 // image.
 type Extractor interface {
 	// Extract takes a repo in the form `remind101/r101-api`, and an image
-	// id, and extracts the process types from the image.
-	Extract(image.Image) (CommandMap, error)
+	// id, and extracts the process definitions from the image.
+	Extract(image.Image) (Procfile, error)
+}
+
+// ManifestExtractor is implemented by Extractors that can also extract the
+// app.json manifest from an image.
+type ManifestExtractor interface {
+	// ExtractManifest extracts the app.json manifest from the same
+	// directory as the Procfile. The zero value is returned if the image
+	// doesn't have one.
+	ExtractManifest(image.Image) (AppManifest, error)
 }
 
 // fakeExtractor is a fake implementation of the Extractor interface.
 type fakeExtractor struct{}
 
 // Extract implements Extractor Extract.
-func (e *fakeExtractor) Extract(img image.Image) (CommandMap, error) {
-	pm := make(CommandMap)
+func (e *fakeExtractor) Extract(img image.Image) (Procfile, error) {
+	pm := make(Procfile)
 
 	// Just return some fake processes.
-	pm[ProcessType("web")] = Command("./bin/web")
+	pm[ProcessType("web")] = &ProcessDefinition{Command: Command("./bin/web")}
 
 	return pm, nil
 }
@@ -44,23 +59,62 @@ type cmdExtractor struct {
 	client *docker.Client
 }
 
-func (e *cmdExtractor) Extract(img image.Image) (CommandMap, error) {
-	pm := make(CommandMap)
+func (e *cmdExtractor) Extract(img image.Image) (Procfile, error) {
+	pm := make(Procfile)
 
 	i, err := e.client.InspectImage(img.String())
 	if err != nil {
 		return pm, err
 	}
 
-	pm[ProcessType("web")] = Command(strings.Join(i.Config.Cmd, " "))
+	return cmdProcfile(i.Config.Cmd), nil
+}
 
-	return pm, nil
+// cmdProcfile returns a Procfile with a web process that runs the command.
+func cmdProcfile(cmd []string) Procfile {
+	return Procfile{
+		ProcessType("web"): &ProcessDefinition{Command: Command(strings.Join(cmd, " "))},
+	}
+}
+
+// labelExtractor is an implementation of the Extractor interface that extracts
+// process definitions from the labels of an image. A label sets the command for
+// a process type:
+//
+//	empire.process.worker=./bin/worker
+//
+// Labels with a setting from the extended Procfile format after the process
+// type set that setting:
+//
+//	empire.process.worker.size=2X
+//	empire.process.worker.env.QUEUES=default
+type labelExtractor struct {
+	// Client is the docker client to use to inspect the image.
+	client *docker.Client
+}
+
+// Extract implements Extractor Extract. An empty Procfile is returned if the
+// image doesn't have any process labels.
+func (e *labelExtractor) Extract(img image.Image) (Procfile, error) {
+	i, err := e.client.InspectImage(img.String())
+	if err != nil {
+		return make(Procfile), err
+	}
+
+	var labels map[string]string
+	if i.Config != nil {
+		labels = i.Config.Labels
+	}
+
+	return ParseProcessLabels(labels)
 }
 
 // procfileFallbackExtractor attempts to extract commands using the procfileExtractor.
-// If that fails because Procfile does not exist, it uses the cmdExtractor instead.
+// If that fails because Procfile does not exist, it uses the labelExtractor,
+// then the cmdExtractor if the image doesn't have any process labels.
 type procfileFallbackExtractor struct {
 	pe *procfileExtractor
+	le *labelExtractor
 	ce *cmdExtractor
 }
 
@@ -69,32 +123,97 @@ func newProcfileFallbackExtractor(c *docker.Client) Extractor {
 		pe: &procfileExtractor{
 			client: c,
 		},
+		le: &labelExtractor{
+			client: c,
+		},
 		ce: &cmdExtractor{
 			client: c,
 		},
 	}
 }
 
-func (e *procfileFallbackExtractor) Extract(img image.Image) (CommandMap, error) {
+func (e *procfileFallbackExtractor) Extract(img image.Image) (Procfile, error) {
 	cm, err := e.pe.Extract(img)
 	// If err is a ProcfileError, Procfile doesn't exist.
 	if _, ok := err.(*ProcfileError); ok {
-		cm, err = e.ce.Extract(img)
+		cm, err = e.le.Extract(img)
+		if err == nil && len(cm) == 0 {
+			cm, err = e.ce.Extract(img)
+		}
 	}
 
 	return cm, err
 }
 
+// ExtractManifest implements ManifestExtractor ExtractManifest.
+func (e *procfileFallbackExtractor) ExtractManifest(img image.Image) (AppManifest, error) {
+	return e.pe.ExtractManifest(img)
+}
+
+// registryExtractor is an implementation of the Extractor interface that reads
+// the Procfile from an image using the Docker Registry API, without a docker
+// daemon. Like the procfileFallbackExtractor, it falls back to the image
+// labels, then the image Cmd, if the image doesn't have a Procfile.
+type registryExtractor struct {
+	client *registry.Client
+}
+
+// Extract implements Extractor Extract.
+func (e *registryExtractor) Extract(img image.Image) (Procfile, error) {
+	ctx := context.Background()
+
+	c, err := e.client.ImageConfig(ctx, img)
+	if err != nil {
+		return make(Procfile), err
+	}
+
+	b, err := e.client.ReadFile(ctx, img, path.Join("/", c.Config.WorkingDir, ProcfileName))
+	if err == nil {
+		return ParseProcfile(b)
+	}
+
+	if err != registry.ErrNotFound {
+		return make(Procfile), err
+	}
+
+	pm, err := ParseProcessLabels(c.Config.Labels)
+	if err != nil || len(pm) > 0 {
+		return pm, err
+	}
+
+	return cmdProcfile(c.Config.Cmd), nil
+}
+
+// ExtractManifest implements ManifestExtractor ExtractManifest.
+func (e *registryExtractor) ExtractManifest(img image.Image) (AppManifest, error) {
+	ctx := context.Background()
+
+	c, err := e.client.ImageConfig(ctx, img)
+	if err != nil {
+		return AppManifest{}, err
+	}
+
+	b, err := e.client.ReadFile(ctx, img, path.Join("/", c.Config.WorkingDir, AppManifestName))
+	if err == registry.ErrNotFound {
+		return AppManifest{}, nil
+	}
+	if err != nil {
+		return AppManifest{}, err
+	}
+
+	return ParseAppManifest(b)
+}
+
 // procfileExtractor is an implementation of the Extractor interface that can
-// pull a docker image and extract its Procfile into a process.CommandMap.
+// pull a docker image and extract its Procfile.
 type procfileExtractor struct {
 	// Client is the docker client to use to pull the container image.
 	client *docker.Client
 }
 
 // Extract implements Extractor Extract.
-func (e *procfileExtractor) Extract(img image.Image) (CommandMap, error) {
-	pm := make(CommandMap)
+func (e *procfileExtractor) Extract(img image.Image) (Procfile, error) {
+	pm := make(Procfile)
 
 	c, err := e.createContainer(img)
 	if err != nil {
@@ -103,7 +222,7 @@ func (e *procfileExtractor) Extract(img image.Image) (CommandMap, error) {
 
 	defer e.removeContainer(c.ID)
 
-	procfile, err := e.procfile(c.ID)
+	procfile, err := e.path(c.ID, ProcfileName)
 	if err != nil {
 		return pm, err
 	}
@@ -116,9 +235,39 @@ func (e *procfileExtractor) Extract(img image.Image) (CommandMap, error) {
 	return ParseProcfile(b)
 }
 
-// procfile returns the path to the Procfile. If the container has a WORKDIR
-// set, then this will return a path to the Procfile within that directory.
-func (e *procfileExtractor) procfile(id string) (string, error) {
+// ExtractManifest implements ManifestExtractor ExtractManifest.
+func (e *procfileExtractor) ExtractManifest(img image.Image) (AppManifest, error) {
+	var m AppManifest
+
+	c, err := e.createContainer(img)
+	if err != nil {
+		return m, err
+	}
+
+	defer e.removeContainer(c.ID)
+
+	manifest, err := e.path(c.ID, AppManifestName)
+	if err != nil {
+		return m, err
+	}
+
+	b, err := e.copyFile(c.ID, manifest)
+	if _, ok := err.(*docker.NoSuchContainer); ok {
+		// Docker responds with a 404 when the path doesn't exist in
+		// the container, so the image doesn't have an app.json.
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+
+	return ParseAppManifest(b)
+}
+
+// path returns the path to the named file, like the Procfile. If the container
+// has a WORKDIR set, then this will return a path to the file within that
+// directory.
+func (e *procfileExtractor) path(id, name string) (string, error) {
 	p := ""
 
 	c, err := e.client.InspectContainer(id)
@@ -130,7 +279,7 @@ func (e *procfileExtractor) procfile(id string) (string, error) {
 		p = c.Config.WorkingDir
 	}
 
-	return path.Join(p, Procfile), nil
+	return path.Join(p, name), nil
 }
 
 // createContainer creates a new docker container for the given docker image.
@@ -176,15 +325,57 @@ func (e *ProcfileError) Error() string {
 }
 
 // ParseProcfile takes a byte slice representing a YAML Procfile and parses it
-// into a processes.CommandMap.
-func ParseProcfile(b []byte) (CommandMap, error) {
-	pm := make(CommandMap)
+// into a Procfile. Each process can either be a command, or a process
+// definition in the extended format.
+func ParseProcfile(b []byte) (Procfile, error) {
+	pm := make(Procfile)
 
 	if err := yaml.Unmarshal(b, &pm); err != nil {
 		return pm, err
 	}
 
-	return pm, nil
+	return pm, pm.Validate()
+}
+
+// ParseProcessLabels parses the process definitions from image labels with the
+// ProcessLabelPrefix. Labels without the prefix are ignored.
+func ParseProcessLabels(labels map[string]string) (Procfile, error) {
+	pm := make(Procfile)
+
+	for k, v := range labels {
+		if !strings.HasPrefix(k, ProcessLabelPrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(k, ProcessLabelPrefix), ".", 2)
+		t := ProcessType(parts[0])
+		if t == "" {
+			return pm, &ValidationError{Err: fmt.Errorf("label %s: missing process type", k)}
+		}
+
+		def, ok := pm[t]
+		if !ok {
+			def = new(ProcessDefinition)
+			pm[t] = def
+		}
+
+		setting := "command"
+		if len(parts) > 1 {
+			setting = parts[1]
+		}
+
+		if err := def.set(setting, v); err != nil {
+			return pm, &ValidationError{Err: fmt.Errorf("label %s: %v", k, err)}
+		}
+	}
+
+	for t, def := range pm {
+		if def.Command == "" {
+			return pm, &ValidationError{Err: fmt.Errorf("label %s%s: missing command", ProcessLabelPrefix, t)}
+		}
+	}
+
+	return pm, pm.Validate()
 }
 
 // firstFile extracts the first file from a tar archive.
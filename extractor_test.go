@@ -11,6 +11,8 @@ import (
 	"github.com/fsouza/go-dockerclient"
 	"github.com/remind101/empire/pkg/httpmock"
 	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/registry"
+	"github.com/remind101/empire/pkg/registry/registrytest"
 )
 
 func TestFakeExtractor(t *testing.T) {
@@ -21,12 +23,12 @@ func TestFakeExtractor(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := CommandMap{
-		ProcessType("web"): Command("./bin/web"),
+	want := Procfile{
+		ProcessType("web"): &ProcessDefinition{Command: Command("./bin/web")},
 	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("Extract() => %q; want %q", got, want)
+		t.Errorf("Extract() => %q; want %q", got.Commands(), want.Commands())
 	}
 }
 
@@ -51,12 +53,12 @@ func TestCmdExtractor(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := CommandMap{
-		ProcessType("web"): Command("/go/bin/app server"),
+	want := Procfile{
+		ProcessType("web"): &ProcessDefinition{Command: Command("/go/bin/app server")},
 	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("Extract() => %q; want %q", got, want)
+		t.Errorf("Extract() => %q; want %q", got.Commands(), want.Commands())
 	}
 }
 
@@ -90,16 +92,65 @@ func TestProcfileExtractor(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := CommandMap{
-		ProcessType("web"): Command("rails server"),
+	want := Procfile{
+		ProcessType("web"): &ProcessDefinition{Command: Command("rails server")},
 	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("Extract() => %q; want %q", got, want)
+		t.Errorf("Extract() => %q; want %q", got.Commands(), want.Commands())
 	}
 
 }
 
+func TestProcfileExtractor_ExtractManifest(t *testing.T) {
+	tests := []struct {
+		status int
+		err    bool
+	}{
+		// The image doesn't have an app.json.
+		{404, false},
+
+		// Errors from the docker daemon aren't ignored.
+		{500, true},
+	}
+
+	for _, tt := range tests {
+		api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+			"POST /containers/create",
+			200, `{ "ID": "abc" }`,
+		)).Add(httpmock.PathHandler(t,
+			"GET /containers/abc/json",
+			200, `{}`,
+		)).Add(httpmock.PathHandler(t,
+			"POST /containers/abc/copy",
+			tt.status, ``,
+		)).Add(httpmock.PathHandler(t,
+			"DELETE /containers/abc",
+			200, `{}`,
+		))
+
+		c, s := newTestDockerClient(t, api)
+
+		e := procfileExtractor{
+			client: c,
+		}
+
+		m, err := e.ExtractManifest(image.Image{
+			Tag:        "acme-inc",
+			Repository: "remind101",
+		})
+		s.Close()
+
+		if got := err != nil; got != tt.err {
+			t.Fatalf("%d: err => %v", tt.status, err)
+		}
+
+		if !m.IsZero() {
+			t.Fatalf("%d: ExtractManifest() => %v; want zero value", tt.status, m)
+		}
+	}
+}
+
 func TestProcfileFallbackExtractor(t *testing.T) {
 	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
 		"POST /containers/create",
@@ -116,6 +167,9 @@ func TestProcfileFallbackExtractor(t *testing.T) {
 	)).Add(httpmock.PathHandler(t,
 		"GET /images/remind101:acme-inc/json",
 		200, `{ "Config": { "Cmd": ["/go/bin/app","server"] } }`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /images/remind101:acme-inc/json",
+		200, `{ "Config": { "Cmd": ["/go/bin/app","server"] } }`,
 	))
 
 	c, s := newTestDockerClient(t, api)
@@ -131,14 +185,230 @@ func TestProcfileFallbackExtractor(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := CommandMap{
-		ProcessType("web"): Command("/go/bin/app server"),
+	want := Procfile{
+		ProcessType("web"): &ProcessDefinition{Command: Command("/go/bin/app server")},
 	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("Extract() => %q; want %q", got, want)
+		t.Errorf("Extract() => %q; want %q", got.Commands(), want.Commands())
+	}
+
+}
+
+func TestProcfileFallbackExtractor_Labels(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"POST /containers/create",
+		200, `{ "ID": "abc" }`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/abc/json",
+		200, `{}`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/abc/copy",
+		404, ``,
+	)).Add(httpmock.PathHandler(t,
+		"DELETE /containers/abc",
+		200, `{}`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /images/remind101:acme-inc/json",
+		200, `{ "Config": { "Cmd": ["/go/bin/app","server"], "Labels": { "empire.process.web": "/go/bin/app server", "empire.process.worker": "/go/bin/app worker" } } }`,
+	))
+
+	c, s := newTestDockerClient(t, api)
+	defer s.Close()
+
+	e := newProcfileFallbackExtractor(c)
+
+	got, err := e.Extract(image.Image{
+		Tag:        "acme-inc",
+		Repository: "remind101",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Procfile{
+		ProcessType("web"):    &ProcessDefinition{Command: Command("/go/bin/app server")},
+		ProcessType("worker"): &ProcessDefinition{Command: Command("/go/bin/app worker")},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() => %q; want %q", got.Commands(), want.Commands())
+	}
+}
+
+func TestLabelExtractor(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /images/remind101:acme-inc/json",
+		200, `{ "Config": { "Labels": { "maintainer": "acme", "empire.process.worker": "sidekiq", "empire.process.worker.size": "2X", "empire.process.worker.env.QUEUES": "default" } } }`,
+	))
+
+	c, s := newTestDockerClient(t, api)
+	defer s.Close()
+
+	e := labelExtractor{
+		client: c,
 	}
 
+	got, err := e.Extract(image.Image{
+		Tag:        "acme-inc",
+		Repository: "remind101",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Procfile{
+		ProcessType("worker"): &ProcessDefinition{
+			Command: Command("sidekiq"),
+			Size:    "2X",
+			Env:     map[string]string{"QUEUES": "default"},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() => %q; want %q", got.Commands(), want.Commands())
+	}
+}
+
+func TestParseProcessLabels(t *testing.T) {
+	two := 2
+
+	got, err := ParseProcessLabels(map[string]string{
+		"empire.process.web":              "./bin/web",
+		"empire.process.web.quantity":     "2",
+		"empire.process.web.port":         "5000",
+		"empire.process.web.health_check": "/health",
+		"empire.process.web.exposure":     "public",
+		"empire.process.worker":           "./bin/worker",
+		"com.example.version":             "1.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Procfile{
+		"web": &ProcessDefinition{
+			Command:     "./bin/web",
+			Quantity:    &two,
+			Port:        5000,
+			HealthCheck: "/health",
+			Exposure:    "public",
+		},
+		"worker": &ProcessDefinition{Command: "./bin/worker"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseProcessLabels() => %v; want %v", got.Commands(), want.Commands())
+	}
+}
+
+func TestParseProcessLabels_Invalid(t *testing.T) {
+	tests := []map[string]string{
+		{"empire.process.web.size": "2X"},
+		{"empire.process.web": "./bin/web", "empire.process.web.quantity": "two"},
+		{"empire.process.web": "./bin/web", "empire.process.web.memory": "1GB"},
+		{"empire.process.web": "./bin/web", "empire.process.web.size": "3X"},
+		{"empire.process.": "./bin/web"},
+	}
+
+	for _, labels := range tests {
+		_, err := ParseProcessLabels(labels)
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("ParseProcessLabels(%v) => %v; want a ValidationError", labels, err)
+		}
+	}
+}
+
+func TestRegistryExtractor(t *testing.T) {
+	s := registrytest.NewServer()
+	defer s.Close()
+
+	s.AddImage("remind101/acme-inc", "procfile", registry.ImageConfig{
+		Config: registry.ContainerConfig{Cmd: []string{"/go/bin/app", "server"}, WorkingDir: "/app"},
+	}, registrytest.Layer{"app/Procfile": "web: rails server"})
+	s.AddImage("remind101/acme-inc", "labels", registry.ImageConfig{
+		Config: registry.ContainerConfig{Cmd: []string{"/go/bin/app", "server"}, WorkingDir: "/app", Labels: map[string]string{"empire.process.worker": "sidekiq"}},
+	}, registrytest.Layer{"Procfile": "web: rails server"})
+	s.AddImage("remind101/acme-inc", "cmd", registry.ImageConfig{
+		Config: registry.ContainerConfig{Cmd: []string{"/go/bin/app", "server"}},
+	})
+
+	c := registry.NewClient(nil)
+	c.Insecure = true
+	e := &registryExtractor{client: c}
+
+	tests := []struct {
+		tag  string
+		want Procfile
+	}{
+		{"procfile", Procfile{"web": &ProcessDefinition{Command: "rails server"}}},
+
+		// The Procfile isn't in the WORKDIR.
+		{"labels", Procfile{"worker": &ProcessDefinition{Command: "sidekiq"}}},
+
+		{"cmd", Procfile{"web": &ProcessDefinition{Command: "/go/bin/app server"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := e.Extract(image.Image{
+			Registry:   s.Host(),
+			Repository: "remind101/acme-inc",
+			Tag:        tt.tag,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.tag, err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Extract() => %q; want %q", tt.tag, got.Commands(), tt.want.Commands())
+		}
+	}
+}
+
+func TestRegistryExtractor_ExtractManifest(t *testing.T) {
+	s := registrytest.NewServer()
+	defer s.Close()
+
+	s.AddImage("remind101/acme-inc", "manifest", registry.ImageConfig{
+		Config: registry.ContainerConfig{WorkingDir: "/app"},
+	}, registrytest.Layer{"app/Procfile": "web: rails server", "app/app.json": `{"scripts":{"postdeploy":"rake db:setup"}}`})
+	s.AddImage("remind101/acme-inc", "none", registry.ImageConfig{
+		Config: registry.ContainerConfig{WorkingDir: "/app"},
+	}, registrytest.Layer{"app/Procfile": "web: rails server"})
+	s.AddImage("remind101/acme-inc", "invalid", registry.ImageConfig{
+		Config: registry.ContainerConfig{WorkingDir: "/app"},
+	}, registrytest.Layer{"app/app.json": `{"env":{"SECRET":{"generator":"uuid"}}}`})
+
+	c := registry.NewClient(nil)
+	c.Insecure = true
+	e := &registryExtractor{client: c}
+
+	img := image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Tag: "manifest"}
+	m, err := e.ExtractManifest(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.Scripts.Postdeploy, "rake db:setup"; got != want {
+		t.Fatalf("Postdeploy => %q; want %q", got, want)
+	}
+
+	img.Tag = "none"
+	m, err = e.ExtractManifest(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.IsZero() {
+		t.Fatalf("ExtractManifest() => %v; want zero value", m)
+	}
+
+	img.Tag = "invalid"
+	if _, err := e.ExtractManifest(img); err == nil {
+		t.Fatal("Expected an error")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("err => %T; want *ValidationError", err)
+	}
 }
 
 // newTestDockerClient returns a docker.Client configured to talk to the given http.Handler
@@ -0,0 +1,268 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// RetentionPolicy controls which releases are kept when garbage collecting.
+// Releases that are running or pinned are always kept.
+type RetentionPolicy struct {
+	// If provided, the number of most recent releases to keep for each
+	// app.
+	Keep int
+
+	// If provided, releases created within this amount of time are kept.
+	MaxAge time.Duration
+}
+
+// Validate validates the policy.
+func (p RetentionPolicy) Validate() error {
+	if p.Keep < 0 || p.MaxAge < 0 {
+		return &ValidationError{Err: errors.New("retention policy can't be negative")}
+	}
+
+	if p.Keep == 0 && p.MaxAge == 0 {
+		return &ValidationError{Err: errors.New("retention policy must keep the last N releases, or releases newer than some age")}
+	}
+
+	return nil
+}
+
+// retained returns true if the policy retains the release, given the versions
+// that are running and the current time.
+func (p RetentionPolicy) retained(r *Release, latest int, running map[int]bool, now time.Time) bool {
+	if r.Pinned || running[r.Version] {
+		return true
+	}
+
+	if p.Keep > 0 && r.Version > latest-p.Keep {
+		return true
+	}
+
+	if p.MaxAge > 0 && r.CreatedAt != nil && now.Sub(*r.CreatedAt) < p.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+// GCResult is the result of garbage collecting releases.
+type GCResult struct {
+	// The number of releases that were deleted.
+	Releases int
+
+	// The number of configs that were deleted.
+	Configs int
+
+	// The number of slugs that were deleted.
+	Slugs int
+
+	// The names of apps that were skipped, because another operation was
+	// in progress. They're garbage collected on the next run.
+	Skipped []string
+}
+
+// add adds the counts from another result.
+func (r *GCResult) add(o *GCResult) {
+	r.Releases += o.Releases
+	r.Configs += o.Configs
+	r.Slugs += o.Slugs
+	r.Skipped = append(r.Skipped, o.Skipped...)
+}
+
+// gcService deletes old releases, along with the configs and slugs that only
+// they used, and prunes old resources from the scheduler.
+type gcService struct {
+	store     *store
+	scheduler scheduler.Scheduler
+	locker    *appLocker
+}
+
+// GC garbage collects releases for all apps using the retention policy. Apps
+// that are locked are skipped, and errors for individual apps are reported,
+// so that one app can't stop the others from being garbage collected.
+func (s *gcService) GC(ctx context.Context, policy RetentionPolicy) (*GCResult, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	apps, err := s.store.Apps(All)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(GCResult)
+	for _, app := range apps {
+		r, err := s.gcApp(ctx, app, policy)
+		if r != nil {
+			result.add(r)
+		}
+		if err == ErrAppLocked {
+			result.Skipped = append(result.Skipped, app.Name)
+			continue
+		}
+		if err != nil {
+			reporter.Report(ctx, fmt.Errorf("gc %s: %v", app.Name, err))
+		}
+	}
+
+	return result, nil
+}
+
+// Run garbage collects releases every interval, until the context is
+// canceled. Errors are reported, since there's no one waiting for the result.
+func (s *gcService) Run(ctx context.Context, policy RetentionPolicy, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if _, err := s.GC(ctx, policy); err != nil {
+			reporter.Report(ctx, err)
+		}
+	}
+}
+
+// gcApp garbage collects releases for a single app. The app is locked, so
+// that releases aren't created while we're deciding what to delete.
+func (s *gcService) gcApp(ctx context.Context, app *App, policy RetentionPolicy) (*GCResult, error) {
+	unlock, err := s.locker.Lock(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var releases []*Release
+	if err := s.store.Find(ComposedScope{ForApp(app), Order("version desc")}, &releases); err != nil {
+		return nil, err
+	}
+
+	if len(releases) == 0 {
+		return new(GCResult), nil
+	}
+
+	running, err := s.runningVersions(app, releases[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*Release
+	now := timex.Now()
+	for _, r := range releases {
+		if !policy.retained(r, releases[0].Version, running, now) {
+			expired = append(expired, r)
+		}
+	}
+
+	result, err := s.store.ReleasesDelete(expired)
+	if err != nil {
+		return result, err
+	}
+
+	if len(expired) == 0 {
+		return result, nil
+	}
+
+	if p, ok := s.scheduler.(scheduler.Pruner); ok {
+		var versions []string
+		for _, r := range expired {
+			versions = append(versions, fmt.Sprintf("v%d", r.Version))
+		}
+
+		if err := p.Prune(ctx, app.ID, versions); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// runningVersions returns the versions of the app that may have running
+// processes: the latest release, and the release that's running alongside
+// a canary.
+func (s *gcService) runningVersions(app *App, latest *Release) (map[int]bool, error) {
+	running := map[int]bool{
+		latest.Version: true,
+	}
+
+	canaries, err := s.store.Deployments(ComposedScope{
+		DeploymentsQuery{App: app},
+		FieldEquals("status", StatusCanary),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range canaries {
+		if d.Release != nil {
+			running[d.Release.Version] = true
+			running[d.Release.Version-1] = true
+		}
+	}
+
+	return running, nil
+}
+
+// ReleasesDelete deletes the releases, along with the configs and slugs that
+// aren't used by any other release.
+func (s *store) ReleasesDelete(releases []*Release) (*GCResult, error) {
+	return releasesDelete(s.db, releases)
+}
+
+func releasesDelete(db *gorm.DB, releases []*Release) (*GCResult, error) {
+	result := new(GCResult)
+
+	if len(releases) == 0 {
+		return result, nil
+	}
+
+	var releaseIDs, configIDs, slugIDs []string
+	for _, r := range releases {
+		releaseIDs = append(releaseIDs, r.ID)
+		configIDs = append(configIDs, r.ConfigID)
+		slugIDs = append(slugIDs, r.SlugID)
+	}
+
+	t := db.Begin()
+
+	// Processes are deleted with the releases.
+	q := t.Exec(`delete from releases where id in (?)`, releaseIDs)
+	if err := q.Error; err != nil {
+		t.Rollback()
+		return result, err
+	}
+	result.Releases = int(q.RowsAffected)
+
+	// Configs and slugs cascade to the releases that use them, so only
+	// ones that aren't used anymore can be deleted.
+	q = t.Exec(`delete from configs where id in (?) and not exists (select 1 from releases where releases.config_id = configs.id)`, configIDs)
+	if err := q.Error; err != nil {
+		t.Rollback()
+		return result, err
+	}
+	result.Configs = int(q.RowsAffected)
+
+	q = t.Exec(`delete from slugs where id in (?) and not exists (select 1 from releases where releases.slug_id = slugs.id)`, slugIDs)
+	if err := q.Error; err != nil {
+		t.Rollback()
+		return result, err
+	}
+	result.Slugs = int(q.RowsAffected)
+
+	if err := t.Commit().Error; err != nil {
+		t.Rollback()
+		return result, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package empire
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		policy RetentionPolicy
+		valid  bool
+	}{
+		{RetentionPolicy{Keep: 10}, true},
+		{RetentionPolicy{MaxAge: time.Hour}, true},
+		{RetentionPolicy{Keep: 10, MaxAge: time.Hour}, true},
+		{RetentionPolicy{}, false},
+		{RetentionPolicy{Keep: -1}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.policy.Validate()
+		if got, want := err == nil, tt.valid; got != want {
+			t.Errorf("Validate(%#v) => %v", tt.policy, err)
+		}
+	}
+}
+
+func TestRetentionPolicy_Retained(t *testing.T) {
+	now := time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-1 * time.Hour)
+
+	running := map[int]bool{10: true, 3: true}
+
+	tests := []struct {
+		policy   RetentionPolicy
+		release  *Release
+		retained bool
+	}{
+		// Running and pinned releases are always kept.
+		{RetentionPolicy{Keep: 1}, &Release{Version: 10, CreatedAt: &old}, true},
+		{RetentionPolicy{Keep: 1}, &Release{Version: 3, CreatedAt: &old}, true},
+		{RetentionPolicy{Keep: 1}, &Release{Version: 2, CreatedAt: &old, Pinned: true}, true},
+
+		// Keep the last N.
+		{RetentionPolicy{Keep: 2}, &Release{Version: 9, CreatedAt: &old}, true},
+		{RetentionPolicy{Keep: 2}, &Release{Version: 8, CreatedAt: &old}, false},
+
+		// Keep by age.
+		{RetentionPolicy{MaxAge: 24 * time.Hour}, &Release{Version: 8, CreatedAt: &recent}, true},
+		{RetentionPolicy{MaxAge: 24 * time.Hour}, &Release{Version: 8, CreatedAt: &old}, false},
+
+		// Either one retains the release.
+		{RetentionPolicy{Keep: 2, MaxAge: 24 * time.Hour}, &Release{Version: 1, CreatedAt: &recent}, true},
+		{RetentionPolicy{Keep: 2, MaxAge: 24 * time.Hour}, &Release{Version: 1, CreatedAt: &old}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.retained(tt.release, 10, running, now); got != tt.retained {
+			t.Errorf("retained(v%d) with %#v => %v; want %v", tt.release.Version, tt.policy, got, tt.retained)
+		}
+	}
+}
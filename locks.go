@@ -0,0 +1,86 @@
+package empire
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/net/context"
+)
+
+// ErrAppLocked is returned when an operation that changes an app can't be
+// performed, because another one is in progress.
+var ErrAppLocked = errors.New("another operation is in progress for this app, try again later")
+
+// appLockNamespace is the first key of the advisory locks used to lock apps,
+// so that they don't collide with other advisory locks.
+const appLockNamespace = 3041
+
+// lockPollInterval is the amount of time to wait between attempts to acquire
+// an app lock.
+var lockPollInterval = 500 * time.Millisecond
+
+// appLocker serializes operations that change an app (deploys, config changes,
+// scaling, rollbacks), so that they can't read the same release and overwrite
+// each others changes. Locks are Postgres advisory locks, so they're shared
+// by all Empire instances using the same database.
+type appLocker struct {
+	store *store
+
+	// The amount of time to wait for the lock when another operation is in
+	// progress. The zero value fails immediately.
+	timeout time.Duration
+}
+
+// Lock acquires the lock for the app, waiting up to the timeout. The returned
+// function must be called to release the lock. ErrAppLocked is returned if
+// the lock couldn't be acquired in time.
+func (l *appLocker) Lock(ctx context.Context, app *App) (func(), error) {
+	deadline := time.Now().Add(l.timeout)
+
+	for {
+		unlock, err := l.store.AppsTryLock(app)
+		if err != nil || unlock != nil {
+			return unlock, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrAppLocked
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// AppsTryLock attempts to acquire the lock for the app without waiting. If the
+// lock is held by someone else, a nil function is returned.
+func (s *store) AppsTryLock(app *App) (func(), error) {
+	return appsTryLock(s.db, app)
+}
+
+// appsTryLock acquires a transaction level advisory lock within a new
+// transaction. The lock is held until the transaction is rolled back, which
+// also releases it if the connection is lost.
+func appsTryLock(db *gorm.DB, app *App) (func(), error) {
+	t := db.Begin()
+	if err := t.Error; err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	if err := t.Raw(`select pg_try_advisory_xact_lock(?, hashtext(?))`, appLockNamespace, app.ID).Row().Scan(&locked); err != nil {
+		t.Rollback()
+		return nil, err
+	}
+
+	if !locked {
+		t.Rollback()
+		return nil, nil
+	}
+
+	return func() { t.Rollback() }, nil
+}
@@ -0,0 +1,286 @@
+package empire
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AppManifestName is the name of the app.json manifest file, which is read
+// from the same directory as the Procfile.
+const AppManifestName = "app.json"
+
+// GeneratorSecret is the generator for config vars that should be set to a
+// random secret value when the app is first deployed.
+const GeneratorSecret = "secret"
+
+// AppManifest is an app.json manifest, which describes how to set up an app
+// the first time that it's deployed. See
+// https://devcenter.heroku.com/articles/app-json-schema.
+//
+//	{
+//	  "env": {
+//	    "DATABASE_URL": {"description": "The database to connect to", "required": true},
+//	    "SECRET_TOKEN": {"generator": "secret"},
+//	    "WEB_CONCURRENCY": "4"
+//	  },
+//	  "formation": {
+//	    "web": {"quantity": 2, "size": "2X"}
+//	  },
+//	  "scripts": {
+//	    "postdeploy": "bundle exec rake bootstrap"
+//	  }
+//	}
+type AppManifest struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Config vars for the app, which are set when it's first deployed.
+	Env map[string]*AppManifestEnv `json:"env,omitempty"`
+
+	// The formation of the app when it's first deployed.
+	Formation map[ProcessType]*AppManifestFormation `json:"formation,omitempty"`
+
+	Scripts AppManifestScripts `json:"scripts,omitempty"`
+}
+
+// AppManifestEnv describes a config var in an app.json manifest.
+type AppManifestEnv struct {
+	Description string `json:"description,omitempty"`
+
+	// If provided, the default value of the config var.
+	Value string `json:"value,omitempty"`
+
+	// If false, the config var doesn't need to be set. The zero value
+	// requires that it's set, unless it has a value or generator.
+	Required *bool `json:"required,omitempty"`
+
+	// If provided, the value of the config var is generated. The only
+	// supported generator is GeneratorSecret.
+	Generator string `json:"generator,omitempty"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. A config var can be
+// either its default value, or an object.
+func (e *AppManifestEnv) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err == nil {
+		*e = AppManifestEnv{Value: value}
+		return nil
+	}
+
+	// Avoid recursing into this method.
+	type env AppManifestEnv
+	var v env
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*e = AppManifestEnv(v)
+	return nil
+}
+
+// required returns true if the config var must be set before the app can be
+// deployed for the first time.
+func (e *AppManifestEnv) required() bool {
+	if e.Value != "" || e.Generator != "" {
+		return false
+	}
+
+	return e.Required == nil || *e.Required
+}
+
+// AppManifestFormation describes the formation of a process type in an
+// app.json manifest.
+type AppManifestFormation struct {
+	// If provided, the number of instances of the process.
+	Quantity *int `json:"quantity,omitempty"`
+
+	// If provided, the size of the process. Either one of the
+	// NamedConstraints (e.g. 2X), or cpu:memory (e.g. 512:1GB).
+	Size string `json:"size,omitempty"`
+}
+
+// AppManifestScripts are the scripts that are run during app setup.
+type AppManifestScripts struct {
+	// If provided, a command that's run as a one off process after the app
+	// is first deployed.
+	Postdeploy string `json:"postdeploy,omitempty"`
+}
+
+// ParseAppManifest parses and validates an app.json manifest.
+func ParseAppManifest(b []byte) (AppManifest, error) {
+	var m AppManifest
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, &ValidationError{Err: fmt.Errorf("%s: %v", AppManifestName, err)}
+	}
+
+	if err := m.Validate(); err != nil {
+		return m, &ValidationError{Err: fmt.Errorf("%s: %v", AppManifestName, err)}
+	}
+
+	return m, nil
+}
+
+// Validate validates the manifest.
+func (m AppManifest) Validate() error {
+	for k, e := range m.Env {
+		if e == nil {
+			return fmt.Errorf("env %s: missing definition", k)
+		}
+
+		if e.Generator != "" && e.Generator != GeneratorSecret {
+			return fmt.Errorf("env %s: unsupported generator %q", k, e.Generator)
+		}
+	}
+
+	for t, f := range m.Formation {
+		if f == nil {
+			return fmt.Errorf("formation %s: missing definition", t)
+		}
+
+		if f.Quantity != nil && *f.Quantity < 0 {
+			return fmt.Errorf("formation %s: quantity can't be negative", t)
+		}
+
+		if _, err := parseConstraints(f.Size); err != nil {
+			return fmt.Errorf("formation %s: invalid size %q: %v", t, f.Size, err)
+		}
+	}
+
+	return nil
+}
+
+// IsZero returns true if the manifest doesn't declare anything, which is also
+// the case when an image doesn't have an app.json.
+func (m AppManifest) IsZero() bool {
+	return reflect.DeepEqual(m, AppManifest{})
+}
+
+// Scan implements the sql.Scanner interface.
+func (m *AppManifest) Scan(src interface{}) error {
+	*m = AppManifest{}
+
+	if src == nil {
+		return nil
+	}
+
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("app manifest: can't scan %T", src)
+	}
+
+	return json.Unmarshal(b, m)
+}
+
+// Value implements the driver.Value interface.
+func (m AppManifest) Value() (driver.Value, error) {
+	if m.IsZero() {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.Value(b), nil
+}
+
+// configVars returns the config vars to set when the app is first deployed,
+// given its current config and the vars that are being set by the deployment.
+// Config vars with default values or generators are added, unless they're
+// already set. A ValidationError is returned if a required config var isn't
+// set.
+func (m AppManifest) configVars(config *Config, vars Vars) (Vars, error) {
+	set := make(Vars)
+	for k, v := range vars {
+		set[k] = v
+	}
+
+	var missing []string
+	for k, e := range m.Env {
+		name := Variable(k)
+
+		if v, ok := vars[name]; ok {
+			if v != nil {
+				continue
+			}
+		} else if config != nil && config.Vars[name] != nil {
+			continue
+		}
+
+		switch {
+		case e.Value != "":
+			value := e.Value
+			set[name] = &value
+		case e.Generator == GeneratorSecret:
+			value, err := generateSecret()
+			if err != nil {
+				return nil, err
+			}
+			set[name] = &value
+		case e.required():
+			missing = append(missing, k)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, &ValidationError{Err: fmt.Errorf("%s requires config vars that aren't set: %s", AppManifestName, strings.Join(missing, ", "))}
+	}
+
+	return set, nil
+}
+
+// formationUpdates returns the updates to apply to the formation when the app
+// is first deployed. If the manifest doesn't provide a quantity for a process,
+// the default quantity from the formation is kept.
+func (m AppManifest) formationUpdates(defaults Formation) ([]*FormationUpdate, error) {
+	var updates []*FormationUpdate
+
+	for t, f := range m.Formation {
+		p, ok := defaults[t]
+		if !ok {
+			return nil, &ValidationError{Err: fmt.Errorf("%s: no %s process type in release", AppManifestName, t)}
+		}
+
+		up := &FormationUpdate{Process: t, Quantity: p.Quantity}
+		if f.Quantity != nil {
+			up.Quantity = *f.Quantity
+		}
+
+		// The size was validated when the manifest was parsed.
+		if c, _ := parseConstraints(f.Size); c != nil {
+			up.Constraints = c
+		}
+
+		updates = append(updates, up)
+	}
+
+	sort.Sort(formationUpdatesByProcess(updates))
+
+	return updates, nil
+}
+
+type formationUpdatesByProcess []*FormationUpdate
+
+func (s formationUpdatesByProcess) Len() int           { return len(s) }
+func (s formationUpdatesByProcess) Less(i, j int) bool { return s[i].Process < s[j].Process }
+func (s formationUpdatesByProcess) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// generateSecret returns a random hex encoded secret.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("unable to generate a secret: " + err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,195 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAppManifest(t *testing.T) {
+	two, no := 2, false
+
+	m, err := ParseAppManifest([]byte(`{
+  "name": "acme-inc",
+  "env": {
+    "DATABASE_URL": {"description": "The database to connect to"},
+    "SECRET_TOKEN": {"generator": "secret"},
+    "DEBUG": {"required": false},
+    "WEB_CONCURRENCY": "4"
+  },
+  "formation": {
+    "web": {"quantity": 2, "size": "2X"}
+  },
+  "scripts": {
+    "postdeploy": "rake db:setup"
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := AppManifest{
+		Name: "acme-inc",
+		Env: map[string]*AppManifestEnv{
+			"DATABASE_URL":    {Description: "The database to connect to"},
+			"SECRET_TOKEN":    {Generator: GeneratorSecret},
+			"DEBUG":           {Required: &no},
+			"WEB_CONCURRENCY": {Value: "4"},
+		},
+		Formation: map[ProcessType]*AppManifestFormation{
+			"web": {Quantity: &two, Size: "2X"},
+		},
+		Scripts: AppManifestScripts{Postdeploy: "rake db:setup"},
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("ParseAppManifest() => %#v; want %#v", m, want)
+	}
+
+	for k, required := range map[string]bool{
+		"DATABASE_URL":    true,
+		"SECRET_TOKEN":    false,
+		"DEBUG":           false,
+		"WEB_CONCURRENCY": false,
+	} {
+		if got := m.Env[k].required(); got != required {
+			t.Errorf("%s: required() => %t; want %t", k, got, required)
+		}
+	}
+}
+
+func TestParseAppManifest_Invalid(t *testing.T) {
+	tests := []string{
+		`{`,
+		`{"env": {"SECRET_TOKEN": {"generator": "uuid"}}}`,
+		`{"env": {"SECRET_TOKEN": null}}`,
+		`{"formation": {"web": {"size": "10X"}}}`,
+		`{"formation": {"web": {"quantity": -1}}}`,
+	}
+
+	for _, tt := range tests {
+		_, err := ParseAppManifest([]byte(tt))
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("ParseAppManifest(%q) => %v; want a ValidationError", tt, err)
+		}
+	}
+}
+
+func TestAppManifest_Value(t *testing.T) {
+	v, err := AppManifest{}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != nil {
+		t.Fatalf("Value() => %v; want nil", v)
+	}
+
+	m := AppManifest{Scripts: AppManifestScripts{Postdeploy: "rake db:setup"}}
+
+	v, err = m.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got AppManifest
+	if err := got.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, m) {
+		t.Fatalf("Scan() => %v; want %v", got, m)
+	}
+}
+
+func TestAppManifest_ConfigVars(t *testing.T) {
+	var (
+		DATABASE_URL = "postgres://"
+		SECRET_TOKEN = "abcd"
+		CONCURRENCY  = "8"
+		DEFAULT      = "4"
+	)
+
+	m := AppManifest{
+		Env: map[string]*AppManifestEnv{
+			"DATABASE_URL":    {},
+			"SECRET_TOKEN":    {Generator: GeneratorSecret},
+			"WEB_CONCURRENCY": {Value: "4"},
+		},
+	}
+
+	// Required config vars that aren't set.
+	if _, err := m.configVars(&Config{}, nil); err == nil {
+		t.Fatal("Expected an error")
+	} else if got, want := err.Error(), "app.json requires config vars that aren't set: DATABASE_URL"; got != want {
+		t.Fatalf("err => %q; want %q", got, want)
+	}
+
+	// Unsetting a required config var.
+	if _, err := m.configVars(&Config{Vars: Vars{"DATABASE_URL": &DATABASE_URL}}, Vars{"DATABASE_URL": nil}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// Set in the deployment.
+	vars, err := m.configVars(&Config{}, Vars{"DATABASE_URL": &DATABASE_URL, "WEB_CONCURRENCY": &CONCURRENCY})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := *vars["DATABASE_URL"], "postgres://"; got != want {
+		t.Errorf("DATABASE_URL => %q; want %q", got, want)
+	}
+
+	if got, want := *vars["WEB_CONCURRENCY"], "8"; got != want {
+		t.Errorf("WEB_CONCURRENCY => %q; want %q", got, want)
+	}
+
+	if got, want := len(*vars["SECRET_TOKEN"]), 64; got != want {
+		t.Errorf("len(SECRET_TOKEN) => %d; want %d", got, want)
+	}
+
+	// Already set in the app's config.
+	vars, err = m.configVars(&Config{Vars: Vars{"DATABASE_URL": &DATABASE_URL, "SECRET_TOKEN": &SECRET_TOKEN}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vars, (Vars{"WEB_CONCURRENCY": &DEFAULT}); !reflect.DeepEqual(got, want) {
+		t.Errorf("configVars() => %v; want %v", got, want)
+	}
+}
+
+func TestAppManifest_FormationUpdates(t *testing.T) {
+	two := 2
+
+	defaults := Formation{
+		"web":    &Process{Type: "web", Quantity: 1},
+		"worker": &Process{Type: "worker", Quantity: 0},
+	}
+
+	m := AppManifest{
+		Formation: map[ProcessType]*AppManifestFormation{
+			"worker": {Quantity: &two},
+			"web":    {Size: "2X"},
+		},
+	}
+
+	updates, err := m.formationUpdates(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Constraints2X
+	want := []*FormationUpdate{
+		{Process: "web", Quantity: 1, Constraints: &c},
+		{Process: "worker", Quantity: 2},
+	}
+
+	if !reflect.DeepEqual(updates, want) {
+		t.Fatalf("formationUpdates() => %v; want %v", updates, want)
+	}
+
+	m.Formation["scheduler"] = &AppManifestFormation{Quantity: &two}
+	if _, err := m.formationUpdates(defaults); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE ports DROP COLUMN process_type;
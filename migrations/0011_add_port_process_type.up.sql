@@ -0,0 +1,4 @@
+ALTER TABLE ports ADD COLUMN process_type text;
+
+-- Ports that are already assigned belong to the web process.
+UPDATE ports SET process_type = 'web' WHERE app_id IS NOT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE deployments (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  release_id uuid references releases(id) ON DELETE SET NULL,
+  image text NOT NULL,
+  user_name text,
+  source text NOT NULL,
+  status text NOT NULL,
+  error text,
+  created_at timestamp without time zone default (now() at time zone 'utc'),
+  finished_at timestamp without time zone
+);
+
+CREATE INDEX index_deployments_on_app_id ON deployments USING btree (app_id);
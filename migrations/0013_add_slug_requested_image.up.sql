@@ -0,0 +1,4 @@
+ALTER TABLE slugs ADD COLUMN requested_image text;
+
+-- Existing slugs were not pinned, so the requested image is the image.
+UPDATE slugs SET requested_image = image;
@@ -0,0 +1 @@
+DROP INDEX index_slugs_on_image;
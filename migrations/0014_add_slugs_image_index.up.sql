@@ -0,0 +1 @@
+CREATE INDEX index_slugs_on_image ON slugs USING btree (image);
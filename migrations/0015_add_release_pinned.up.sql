@@ -0,0 +1 @@
+ALTER TABLE releases ADD COLUMN pinned boolean NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE deployments ADD COLUMN output text NOT NULL DEFAULT '';
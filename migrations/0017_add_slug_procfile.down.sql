@@ -0,0 +1 @@
+ALTER TABLE slugs DROP COLUMN procfile;
@@ -0,0 +1 @@
+ALTER TABLE slugs ADD COLUMN procfile json;
@@ -0,0 +1,3 @@
+ALTER TABLE slugs ADD COLUMN requested_image text;
+UPDATE slugs SET requested_image = image;
+ALTER TABLE releases DROP COLUMN requested_image;
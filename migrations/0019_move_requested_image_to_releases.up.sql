@@ -0,0 +1,7 @@
+ALTER TABLE releases ADD COLUMN requested_image text;
+
+-- Slugs are shared by every deploy of the same image, so the requested image
+-- of a slug is the best we know for existing releases.
+UPDATE releases SET requested_image = slugs.requested_image FROM slugs WHERE releases.slug_id = slugs.id;
+
+ALTER TABLE slugs DROP COLUMN requested_image;
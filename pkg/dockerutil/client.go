@@ -116,3 +116,24 @@ func (c *Client) RemoveContainer(ctx context.Context, opts docker.RemoveContaine
 	done(err, "RemoveContainer", "id", opts.ID)
 	return err
 }
+
+func (c *Client) ListContainers(ctx context.Context, opts docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	ctx, done := trace.Trace(ctx)
+	containers, err := c.Client.ListContainers(opts)
+	done(err, "ListContainers", "all", opts.All)
+	return containers, err
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (*docker.Container, error) {
+	ctx, done := trace.Trace(ctx)
+	container, err := c.Client.InspectContainer(id)
+	done(err, "InspectContainer", "id", id)
+	return container, err
+}
+
+func (c *Client) WaitContainer(ctx context.Context, id string) (int, error) {
+	ctx, done := trace.Trace(ctx)
+	code, err := c.Client.WaitContainer(id)
+	done(err, "WaitContainer", "id", id, "code", code)
+	return code, err
+}
@@ -61,7 +61,51 @@ func (c *Client) RegisterAppTaskDefinition(ctx context.Context, app string, inpu
 	return c.ECS.RegisterTaskDefinition(ctx, input)
 }
 
-// ListAppTasks lists all the tasks for the app.
+// ListAppTaskDefinitions lists the ARNs of all of the active task definition
+// revisions for the app. ECS only matches the family prefix of task
+// definitions against whole families, so the app's families are listed
+// first, then the revisions of each family.
+func (c *Client) ListAppTaskDefinitions(ctx context.Context, appID string) (*ecs.ListTaskDefinitionsOutput, error) {
+	var families []*string
+
+	if err := c.ListTaskDefinitionFamiliesPages(ctx, &ecs.ListTaskDefinitionFamiliesInput{
+		FamilyPrefix: aws.String(appID + c.delimiter()),
+	}, func(resp *ecs.ListTaskDefinitionFamiliesOutput, lastPage bool) bool {
+		families = append(families, resp.Families...)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	var arns []*string
+
+	for _, family := range families {
+		if err := c.ListTaskDefinitionsPages(ctx, &ecs.ListTaskDefinitionsInput{
+			FamilyPrefix: family,
+			Status:       aws.String("ACTIVE"),
+		}, func(resp *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+			arns = append(arns, resp.TaskDefinitionArns...)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ecs.ListTaskDefinitionsOutput{
+		TaskDefinitionArns: arns,
+	}, nil
+}
+
+// RunAppTask runs a one off task for the app. The task is marked as started by
+// the app, so that it can be found with ListAppTasks.
+func (c *Client) RunAppTask(ctx context.Context, app string, input *ecs.RunTaskInput) (*ecs.RunTaskOutput, error) {
+	input.TaskDefinition = c.prefix(app, input.TaskDefinition)
+	input.StartedBy = aws.String(app)
+	return c.ECS.RunTask(ctx, input)
+}
+
+// ListAppTasks lists all the tasks for the app, including one off tasks that
+// were started with RunAppTask.
 func (c *Client) ListAppTasks(ctx context.Context, appID string, input *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
 	var arns []*string
 
@@ -97,6 +141,16 @@ func (c *Client) ListAppTasks(ctx context.Context, appID string, input *ecs.List
 		arns = append(arns, taskArns...)
 	}
 
+	if err := c.ListTasksPages(ctx, &ecs.ListTasksInput{
+		Cluster:   input.Cluster,
+		StartedBy: aws.String(appID),
+	}, func(resp *ecs.ListTasksOutput, lastPage bool) bool {
+		arns = append(arns, resp.TaskArns...)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
 	return &ecs.ListTasksOutput{
 		TaskArns: arns,
 	}, nil
@@ -108,6 +108,18 @@ func TestListAppTasks(t *testing.T) {
 				Body:       `{"taskArns":["arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
 			},
 		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTasks",
+				Body:       `{"cluster":"cluster","startedBy":"ae69bb4c-3903-4844-82fe-548ac5b74570"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskArns":["arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"]}`,
+			},
+		},
 	})
 	m, s := newTestClient(h)
 	defer s.Close()
@@ -119,8 +131,8 @@ func TestListAppTasks(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if got := len(resp.TaskArns); got != 1 {
-		t.Fatalf("Expected 1 tasks returned; got %d", got)
+	if got := len(resp.TaskArns); got != 2 {
+		t.Fatalf("Expected 2 tasks returned; got %d", got)
 	}
 }
 
@@ -161,6 +173,18 @@ func TestListAppTasks_Paginate(t *testing.T) {
 				Body:       `{"taskArns":["arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
 			},
 		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTasks",
+				Body:       `{"cluster":"cluster","startedBy":"ae69bb4c-3903-4844-82fe-548ac5b74570"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskArns":[]}`,
+			},
+		},
 	})
 	m, s := newTestClient(h)
 	defer s.Close()
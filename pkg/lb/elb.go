@@ -1,6 +1,7 @@
 package lb
 
 import (
+	"fmt"
 	"strings"
 
 	"code.google.com/p/go-uuid/uuid"
@@ -16,6 +17,15 @@ const (
 
 var defaultConnectionDrainingTimeout int64 = 30
 
+// Thresholds and timings for HTTP health checks, which are the same as the ELB
+// defaults.
+var (
+	defaultHealthyThreshold    int64 = 10
+	defaultUnhealthyThreshold  int64 = 2
+	defaultHealthCheckTimeout  int64 = 5
+	defaultHealthCheckInterval int64 = 30
+)
+
 var _ Manager = &ELBManager{}
 
 // ELBManager is an implementation of the Manager interface that creates Elastic
@@ -49,6 +59,7 @@ func NewELBManager(c *aws.Config) *ELBManager {
 // CreateLoadBalancer creates a new ELB:
 //
 // * The ELB is created and connection draining is enabled.
+// * If a health check path is provided, the ELB checks it over HTTP.
 // * An internal DNS CNAME record is created, pointing the the DNSName of the ELB.
 func (m *ELBManager) CreateLoadBalancer(ctx context.Context, o CreateLoadBalancerOpts) (*LoadBalancer, error) {
 	scheme := schemeInternal
@@ -92,6 +103,21 @@ func (m *ELBManager) CreateLoadBalancer(ctx context.Context, o CreateLoadBalance
 		return nil, err
 	}
 
+	if o.HealthCheck != "" {
+		if _, err := m.elb.ConfigureHealthCheck(&elb.ConfigureHealthCheckInput{
+			HealthCheck: &elb.HealthCheck{
+				HealthyThreshold:   aws.Int64(defaultHealthyThreshold),
+				UnhealthyThreshold: aws.Int64(defaultUnhealthyThreshold),
+				Interval:           aws.Int64(defaultHealthCheckInterval),
+				Timeout:            aws.Int64(defaultHealthCheckTimeout),
+				Target:             aws.String(fmt.Sprintf("HTTP:%d%s", o.InstancePort, o.HealthCheck)),
+			},
+			LoadBalancerName: input.LoadBalancerName,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	return &LoadBalancer{
 		Name:         *input.LoadBalancerName,
 		DNSName:      *out.DNSName,
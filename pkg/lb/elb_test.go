@@ -63,6 +63,57 @@ func TestELB_CreateLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestELB_CreateLoadBalancer_HealthCheck(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Body:       `Action=CreateLoadBalancer&Listeners.member.1.InstancePort=9000&Listeners.member.1.InstanceProtocol=http&Listeners.member.1.LoadBalancerPort=80&Listeners.member.1.Protocol=http&LoadBalancerName=acme-inc&Scheme=internal&SecurityGroups.member.1=&Subnets.member.1=private-subnet&Version=2012-06-01`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body: `<?xml version="1.0"?>
+<CreateLoadBalancerResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+	<DNSName>acme-inc.us-east-1.elb.amazonaws.com</DNSName>
+</CreateLoadBalancerResponse>`,
+			},
+		},
+		{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Body:       `Action=ModifyLoadBalancerAttributes&LoadBalancerAttributes.ConnectionDraining.Enabled=true&LoadBalancerAttributes.ConnectionDraining.Timeout=30&LoadBalancerAttributes.CrossZoneLoadBalancing.Enabled=true&LoadBalancerName=acme-inc&Version=2012-06-01`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body: `<?xml version="1.0"?>
+<ModifyLoadBalancerAttributesResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+</ModifyLoadBalancerAttributesResponse>`,
+			},
+		},
+		{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Body:       `Action=ConfigureHealthCheck&HealthCheck.HealthyThreshold=10&HealthCheck.Interval=30&HealthCheck.Target=HTTP%3A9000%2Fhealth&HealthCheck.Timeout=5&HealthCheck.UnhealthyThreshold=2&LoadBalancerName=acme-inc&Version=2012-06-01`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body: `<?xml version="1.0"?>
+<ConfigureHealthCheckResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+</ConfigureHealthCheckResponse>`,
+			},
+		},
+	})
+	m, s := newTestELBManager(h)
+	defer s.Close()
+
+	if _, err := m.CreateLoadBalancer(context.Background(), CreateLoadBalancerOpts{
+		InstancePort: 9000,
+		HealthCheck:  "/health",
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func buildLoadBalancerForDestroy() (*ELBManager, *httptest.Server, *LoadBalancer) {
 	h := awsutil.NewHandler([]awsutil.Cycle{
 		{
@@ -310,6 +361,27 @@ func TestELBwDNS_DestroyLoadBalancer(t *testing.T) {
 		t.Fatal("DeleteCNAME was not called.")
 	}
 
+	if got, want := ns.CNAME, "acme-inc"; got != want {
+		t.Fatalf("CNAME => %s; want %s", got, want)
+	}
+}
+
+func TestELBwDNS_DestroyLoadBalancer_CNAMETag(t *testing.T) {
+	m, s, lb := buildLoadBalancerForDestroy()
+	defer s.Close()
+	ns := newTestNameserver("FAKEZONE")
+
+	lb.Tags[CNAMETag] = "admin.acme-inc"
+
+	m2 := WithCNAME(m, ns)
+
+	if err := m2.DestroyLoadBalancer(context.Background(), lb); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := ns.CNAME, "admin.acme-inc"; got != want {
+		t.Fatalf("CNAME => %s; want %s", got, want)
+	}
 }
 
 func newTestELBManager(h http.Handler) (*ELBManager, *httptest.Server) {
@@ -337,15 +409,20 @@ type fakeNameserver struct {
 
 	CNAMECalled       bool
 	DeleteCNAMECalled bool
+
+	// The last cname that was created or deleted.
+	CNAME string
 }
 
 func (n *fakeNameserver) CreateCNAME(cname, record string) error {
 	n.CNAMECalled = true
+	n.CNAME = cname
 	return nil
 }
 
 func (n *fakeNameserver) DeleteCNAME(cname, record string) error {
 	n.DeleteCNAMECalled = true
+	n.CNAME = cname
 	return nil
 }
 
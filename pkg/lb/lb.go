@@ -3,7 +3,16 @@ package lb
 
 import "golang.org/x/net/context"
 
-const AppTag = "App"
+const (
+	// AppTag is the tag that holds the name of the app. When present, a
+	// CNAME record is created with the app name.
+	AppTag = "App"
+
+	// CNAMETag can be used to override the name of the CNAME record that
+	// is created, for load balancers that aren't the primary load balancer
+	// for an app.
+	CNAMETag = "CNAME"
+)
 
 // CreateLoadBalancerOpts are options that can be provided when creating a
 // LoadBalancer.
@@ -19,6 +28,10 @@ type CreateLoadBalancerOpts struct {
 
 	// The SSL Certificate
 	SSLCert string
+
+	// If provided, the HTTP path on the hosts that's used to check the
+	// health of instances (e.g. /health).
+	HealthCheck string
 }
 
 // LoadBalancer represents a load balancer.
@@ -75,14 +88,14 @@ type cnameManager struct {
 
 // CreateLoadBalancer will create the LoadBalancer using the underlying manager,
 // then create a CNAME record pointed at the LoadBalancers DNSName. The CNAME
-// will be pulled from the `Service` tag if provided.
+// will be pulled from the `CNAME` tag, or the `App` tag if provided.
 func (m *cnameManager) CreateLoadBalancer(ctx context.Context, opts CreateLoadBalancerOpts) (*LoadBalancer, error) {
 	lb, err := m.Manager.CreateLoadBalancer(ctx, opts)
 	if err != nil {
 		return lb, err
 	}
 
-	if n, ok := opts.Tags[AppTag]; ok {
+	if n, ok := cname(opts.Tags); ok {
 		return lb, m.CreateCNAME(n, lb.DNSName)
 	}
 
@@ -98,9 +111,20 @@ func (m *cnameManager) DestroyLoadBalancer(ctx context.Context, lb *LoadBalancer
 		return err
 	}
 
-	if n, ok := lb.Tags[AppTag]; ok {
+	if n, ok := cname(lb.Tags); ok {
 		return m.DeleteCNAME(n, lb.DNSName)
 	}
 
 	return nil
 }
+
+// cname returns the name of the CNAME record for a load balancer with the
+// given tags.
+func cname(tags map[string]string) (string, bool) {
+	if n, ok := tags[CNAMETag]; ok {
+		return n, ok
+	}
+
+	n, ok := tags[AppTag]
+	return n, ok
+}
@@ -33,6 +33,7 @@ func (m *LoggedManager) CreateLoadBalancer(ctx context.Context, o CreateLoadBala
 		"instance-port", o.InstancePort,
 		"dns-name", dnsName,
 		"cert", o.SSLCert,
+		"health-check", o.HealthCheck,
 	)
 	return lb, err
 }
@@ -0,0 +1,508 @@
+// Package registry provides a client for the Docker Registry HTTP API V2. It
+// can resolve tags to digests, and read the config and files of an image,
+// without a Docker daemon, and without pulling the whole image.
+//
+// Only images with a schema 2 manifest are supported.
+package registry
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/remind101/empire/pkg/image"
+	"golang.org/x/net/context"
+)
+
+const (
+	// MediaTypeManifest is the media type of a schema 2 image manifest.
+	MediaTypeManifest = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// DefaultRegistry is the host of the registry that's used for images
+	// without a registry (e.g. remind101/acme-inc).
+	DefaultRegistry = "registry-1.docker.io"
+
+	// The key for Docker Hub credentials in ~/.dockercfg.
+	indexServer = "https://index.docker.io/v1/"
+
+	// Prefixes for whiteout files in a layer, which mark files from lower
+	// layers as deleted.
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// ErrNotFound is returned when an image, or a file within an image, doesn't
+// exist.
+var ErrNotFound = errors.New("registry: not found")
+
+// Descriptor references a blob in the registry.
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// Manifest is a schema 2 image manifest.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// ImageConfig is the configuration of an image, which is referenced by its
+// manifest.
+type ImageConfig struct {
+	Config ContainerConfig `json:"config"`
+}
+
+// ContainerConfig is the part of the image configuration that's used when
+// running a container from the image.
+type ContainerConfig struct {
+	Cmd        []string          `json:"Cmd"`
+	Entrypoint []string          `json:"Entrypoint"`
+	WorkingDir string            `json:"WorkingDir"`
+	Labels     map[string]string `json:"Labels"`
+}
+
+// Error is returned when the registry responds with an unexpected status.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("registry: %s %s: unexpected status %d", e.Method, e.URL, e.StatusCode)
+}
+
+// Client is a client for the Docker Registry HTTP API V2.
+type Client struct {
+	// Credentials for registries, keyed by registry, as in ~/.dockercfg.
+	Auth *docker.AuthConfigurations
+
+	// If true, registries are accessed over http instead of https.
+	Insecure bool
+
+	client *http.Client
+
+	// Bearer tokens, keyed by registry and scope.
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a new Client that uses the credentials from auth.
+func NewClient(auth *docker.AuthConfigurations) *Client {
+	if auth == nil {
+		auth = &docker.AuthConfigurations{}
+	}
+
+	return &Client{
+		Auth:   auth,
+		client: http.DefaultClient,
+		tokens: make(map[string]string),
+	}
+}
+
+// Digest returns the digest of the image's manifest, which can be used to pull
+// exactly this image, even if its tag is moved.
+func (c *Client) Digest(ctx context.Context, img image.Image) (string, error) {
+	_, digest, err := c.manifest(ctx, img)
+	return digest, err
+}
+
+// Manifest returns the manifest of the image.
+func (c *Client) Manifest(ctx context.Context, img image.Image) (*Manifest, error) {
+	m, _, err := c.manifest(ctx, img)
+	return m, err
+}
+
+// ImageConfig returns the configuration of the image.
+func (c *Client) ImageConfig(ctx context.Context, img image.Image) (*ImageConfig, error) {
+	m, err := c.Manifest(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.Blob(ctx, img, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+
+	var config ImageConfig
+	if err := json.NewDecoder(b).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Blob returns the contents of a blob in the image's repository. The caller
+// must close it.
+func (c *Client) Blob(ctx context.Context, img image.Image, digest string) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, img, "blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// ReadFile returns the contents of the file at the given path in the image's
+// filesystem. Layers are read from the top, so only the layers above the one
+// that last changed the file are downloaded. ErrNotFound is returned if the
+// file doesn't exist.
+func (c *Client) ReadFile(ctx context.Context, img image.Image, name string) ([]byte, error) {
+	m, err := c.Manifest(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+
+	name = cleanPath(name)
+
+	for i := len(m.Layers) - 1; i >= 0; i-- {
+		b, err := c.readLayerFile(ctx, img, m.Layers[i], name)
+		if err != errNotInLayer {
+			return b, err
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// errNotInLayer is returned by readLayerFile when the layer doesn't change the
+// file, so lower layers need to be checked.
+var errNotInLayer = errors.New("registry: file not in layer")
+
+// readLayerFile reads the file from a layer. ErrNotFound is returned if the
+// layer deletes the file.
+func (c *Client) readLayerFile(ctx context.Context, img image.Image, layer Descriptor, name string) ([]byte, error) {
+	blob, err := c.Blob(ctx, img, layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	var r io.Reader = blob
+	if strings.HasSuffix(layer.MediaType, "gzip") {
+		gz, err := gzip.NewReader(blob)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	dir, base := path.Split(name)
+	whiteout := cleanPath(path.Join(dir, whiteoutPrefix+base))
+
+	// If a directory containing the file is opaque in this layer, the
+	// file in lower layers is hidden.
+	var opaque bool
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch n := cleanPath(h.Name); {
+		case n == name:
+			return ioutil.ReadAll(tr)
+		case n == whiteout:
+			return nil, ErrNotFound
+		case path.Base(n) == whiteoutOpaque && strings.HasPrefix(name, path.Dir(n)+"/"):
+			opaque = true
+		}
+	}
+
+	if opaque {
+		return nil, ErrNotFound
+	}
+
+	return nil, errNotInLayer
+}
+
+// manifest returns the manifest of the image, and its digest.
+func (c *Client) manifest(ctx context.Context, img image.Image) (*Manifest, string, error) {
+	resp, err := c.get(ctx, img, "manifests/"+reference(img), MediaTypeManifest)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, "", err
+	}
+
+	if m.SchemaVersion != 2 || m.MediaType != MediaTypeManifest {
+		return nil, "", fmt.Errorf("registry: %s: unsupported manifest (schema version %d, media type %q)", img, m.SchemaVersion, m.MediaType)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(raw))
+	}
+
+	return &m, digest, nil
+}
+
+// get performs a GET request against the repository of the image. If the
+// registry requires authentication, the request is retried with credentials.
+func (c *Client) get(ctx context.Context, img image.Image, p, accept string) (*http.Response, error) {
+	host, repo := c.host(img), repository(img)
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", c.scheme(), host, repo, p)
+	scope := fmt.Sprintf("repository:%s:pull", repo)
+
+	resp, err := c.do(ctx, u, accept, c.authorization(host, scope))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		auth, err := c.authenticate(ctx, img, host, scope, challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp, err = c.do(ctx, u, accept, auth); err != nil {
+			return nil, err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		resp.Body.Close()
+		return nil, &Error{Method: "GET", URL: u, StatusCode: resp.StatusCode}
+	}
+}
+
+func (c *Client) do(ctx context.Context, u, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Cancel = ctx.Done()
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.client.Do(req)
+}
+
+// authorization returns the Authorization header for a previously obtained
+// bearer token for the scope, if there is one.
+func (c *Client) authorization(host, scope string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.tokens[host+" "+scope]; ok {
+		return "Bearer " + t
+	}
+
+	return ""
+}
+
+// authenticate responds to the authentication challenge from a registry, and
+// returns the Authorization header to use. Bearer tokens are cached for later
+// requests.
+func (c *Client) authenticate(ctx context.Context, img image.Image, host, scope, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	creds, hasCreds := c.credentials(img)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCreds {
+			return "", fmt.Errorf("registry: no credentials for %s", host)
+		}
+
+		req := &http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		q := url.Values{}
+		q.Set("service", params["service"])
+		q.Set("scope", scope)
+
+		req, err := http.NewRequest("GET", params["realm"]+"?"+q.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		req.Cancel = ctx.Done()
+
+		if hasCreds {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", &Error{Method: "GET", URL: params["realm"], StatusCode: resp.StatusCode}
+		}
+
+		var t struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+			return "", err
+		}
+
+		token := t.Token
+		if token == "" {
+			token = t.AccessToken
+		}
+
+		c.mu.Lock()
+		c.tokens[host+" "+scope] = token
+		c.mu.Unlock()
+
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("registry: unsupported authentication challenge from %s: %q", host, challenge)
+	}
+}
+
+// credentials returns the credentials for the registry of the image.
+func (c *Client) credentials(img image.Image) (docker.AuthConfiguration, bool) {
+	key := img.Registry
+	if isDockerHub(img.Registry) {
+		key = indexServer
+	}
+
+	a, ok := c.Auth.Configs[key]
+	return a, ok
+}
+
+func (c *Client) scheme() string {
+	if c.Insecure {
+		return "http"
+	}
+	return "https"
+}
+
+// host returns the host of the image's registry.
+func (c *Client) host(img image.Image) string {
+	if isDockerHub(img.Registry) {
+		return DefaultRegistry
+	}
+	return img.Registry
+}
+
+func isDockerHub(registry string) bool {
+	switch registry {
+	case "", "docker.io", "index.docker.io", DefaultRegistry:
+		return true
+	}
+	return false
+}
+
+// repository returns the name of the image's repository in the registry.
+// Official images on Docker Hub (e.g. ubuntu) are in the library namespace.
+func repository(img image.Image) string {
+	if isDockerHub(img.Registry) && !strings.Contains(img.Repository, "/") {
+		return "library/" + img.Repository
+	}
+	return img.Repository
+}
+
+// reference returns the digest or tag of the image.
+func reference(img image.Image) string {
+	if img.Digest != "" {
+		return img.Digest
+	}
+	if img.Tag != "" {
+		return img.Tag
+	}
+	return image.DefaultTag
+}
+
+// cleanPath returns the path relative to the root of the filesystem, as paths
+// in layers are.
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// parseChallenge parses a WWW-Authenticate header, like:
+//
+//	Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(h string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(h), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+
+		rest = strings.TrimLeft(rest, ", ")
+	}
+
+	return parts[0], params
+}
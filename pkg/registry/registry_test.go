@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/pkg/image"
+)
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		in     string
+		scheme string
+		params map[string]string
+	}{
+		{
+			`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:remind101/acme-inc:pull"`,
+			"Bearer",
+			map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:remind101/acme-inc:pull"},
+		},
+		{
+			`Basic realm="Registry Realm"`,
+			"Basic",
+			map[string]string{"realm": "Registry Realm"},
+		},
+		{
+			`Basic`,
+			"Basic",
+			map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		scheme, params := parseChallenge(tt.in)
+		if scheme != tt.scheme {
+			t.Errorf("parseChallenge(%q) scheme => %q; want %q", tt.in, scheme, tt.scheme)
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("parseChallenge(%q) params => %v; want %v", tt.in, params, tt.params)
+		}
+	}
+}
+
+func TestRepository(t *testing.T) {
+	tests := []struct {
+		img  image.Image
+		host string
+		repo string
+	}{
+		{image.Image{Repository: "ubuntu"}, DefaultRegistry, "library/ubuntu"},
+		{image.Image{Repository: "remind101/acme-inc"}, DefaultRegistry, "remind101/acme-inc"},
+		{image.Image{Registry: "docker.io", Repository: "remind101/acme-inc"}, DefaultRegistry, "remind101/acme-inc"},
+		{image.Image{Registry: "quay.io", Repository: "acme-inc"}, "quay.io", "acme-inc"},
+	}
+
+	c := NewClient(nil)
+	for _, tt := range tests {
+		if got := c.host(tt.img); got != tt.host {
+			t.Errorf("host(%v) => %q; want %q", tt.img, got, tt.host)
+		}
+		if got := repository(tt.img); got != tt.repo {
+			t.Errorf("repository(%v) => %q; want %q", tt.img, got, tt.repo)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := map[string]string{
+		"Procfile":           "Procfile",
+		"/Procfile":          "Procfile",
+		"./app/Procfile":     "app/Procfile",
+		"/app/../a/Procfile": "a/Procfile",
+	}
+
+	for in, want := range tests {
+		if got := cleanPath(in); got != want {
+			t.Errorf("cleanPath(%q) => %q; want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package registrytest provides an in-process Docker Registry V2 for testing.
+package registrytest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/remind101/empire/pkg/registry"
+)
+
+// Layer maps the paths of files in a layer to their contents. Files can be
+// deleted from lower layers with whiteout files (e.g. app/.wh.Procfile).
+type Layer map[string]string
+
+// Server is a fake Docker registry that serves images from memory.
+type Server struct {
+	*httptest.Server
+
+	// If provided, requests must have this bearer token, which is obtained
+	// from the server's token endpoint.
+	Token string
+
+	mu        sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	requests  []string
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished.
+func NewServer() *Server {
+	s := &Server{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Host returns the host of the registry, for use as the registry of an image.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Requests returns the paths of the requests that were made to the registry.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// AddImage adds an image with the given config and layers to the repository,
+// tagged with tag. The layers are ordered from the bottom. It returns the
+// digest of the image's manifest.
+func (s *Server) AddImage(repo, tag string, config registry.ImageConfig, layers ...Layer) string {
+	c, err := json.Marshal(config)
+	if err != nil {
+		panic(err)
+	}
+
+	m := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeManifest,
+		Config:        s.addBlob("application/vnd.docker.container.image.v1+json", c),
+	}
+
+	for _, l := range layers {
+		m.Layers = append(m.Layers, s.addBlob("application/vnd.docker.image.rootfs.diff.tar.gzip", layerTar(l)))
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	d := digest(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manifests[repo+":"+tag] = raw
+	s.manifests[repo+":"+d] = raw
+
+	return d
+}
+
+func (s *Server) addBlob(mediaType string, b []byte) registry.Descriptor {
+	d := digest(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[d] = b
+
+	return registry.Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(b)),
+		Digest:    d,
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		json.NewEncoder(w).Encode(map[string]string{"token": s.Token})
+		return
+	}
+
+	s.requests = append(s.requests, r.URL.Path)
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registrytest"`, s.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// /v2/<repo>/manifests/<reference> or /v2/<repo>/blobs/<digest>
+	p := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if i := strings.LastIndex(p, "/manifests/"); i >= 0 {
+		raw, ok := s.manifests[p[:i]+":"+p[i+len("/manifests/"):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", registry.MediaTypeManifest)
+		w.Header().Set("Docker-Content-Digest", digest(raw))
+		w.Write(raw)
+		return
+	}
+
+	if i := strings.LastIndex(p, "/blobs/"); i >= 0 {
+		b, ok := s.blobs[p[i+len("/blobs/"):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// layerTar returns the gzipped tar archive of the layer.
+func layerTar(l Layer) []byte {
+	var names []string
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	for _, name := range names {
+		body := l[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			panic(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		panic(err)
+	}
+	if err := gz.Close(); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+func digest(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
@@ -0,0 +1,138 @@
+package registrytest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/registry"
+	"golang.org/x/net/context"
+)
+
+func TestClient_Digest(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	digest := s.AddImage("remind101/acme-inc", "latest", registry.ImageConfig{})
+
+	c := newTestClient()
+	got, err := c.Digest(context.Background(), image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Tag: "latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != digest {
+		t.Fatalf("Digest => %s; want %s", got, digest)
+	}
+
+	if _, err := c.Digest(context.Background(), image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Tag: "v1"}); err != registry.ErrNotFound {
+		t.Fatalf("err => %v; want %v", err, registry.ErrNotFound)
+	}
+}
+
+func TestClient_ImageConfig(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	config := registry.ImageConfig{
+		Config: registry.ContainerConfig{
+			Cmd:        []string{"./bin/web"},
+			WorkingDir: "/app",
+			Labels:     map[string]string{"empire.process.web": "./bin/web"},
+		},
+	}
+	digest := s.AddImage("remind101/acme-inc", "latest", config)
+
+	c := newTestClient()
+	got, err := c.ImageConfig(context.Background(), image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Digest: digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, &config) {
+		t.Fatalf("ImageConfig => %v; want %v", got, config)
+	}
+}
+
+func TestClient_ReadFile(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.AddImage("remind101/acme-inc", "latest", registry.ImageConfig{},
+		Layer{"app/Procfile": "web: ./bin/old", "app/README": "acme"},
+		Layer{"app/Procfile": "web: ./bin/web"},
+		Layer{"app/bin/web": "#!/bin/sh"},
+	)
+	s.AddImage("remind101/acme-inc", "deleted", registry.ImageConfig{},
+		Layer{"app/Procfile": "web: ./bin/web"},
+		Layer{"app/.wh.Procfile": ""},
+	)
+	s.AddImage("remind101/acme-inc", "opaque", registry.ImageConfig{},
+		Layer{"app/Procfile": "web: ./bin/web"},
+		Layer{"app/.wh..wh..opq": "", "app/README": "acme"},
+	)
+
+	c := newTestClient()
+	img := image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Tag: "latest"}
+
+	b, err := c.ReadFile(context.Background(), img, "/app/Procfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(b), "web: ./bin/web"; got != want {
+		t.Fatalf("ReadFile => %q; want %q", got, want)
+	}
+
+	// Only the layers above the one with the Procfile should've been
+	// downloaded.
+	var blobs int
+	for _, r := range s.Requests() {
+		if strings.Contains(r, "/blobs/") {
+			blobs++
+		}
+	}
+	if got, want := blobs, 2; got != want {
+		t.Fatalf("downloaded %d layers; want %d", got, want)
+	}
+
+	if _, err := c.ReadFile(context.Background(), img, "/app/Gemfile"); err != registry.ErrNotFound {
+		t.Fatalf("err => %v; want %v", err, registry.ErrNotFound)
+	}
+
+	for _, tag := range []string{"deleted", "opaque"} {
+		img.Tag = tag
+		if _, err := c.ReadFile(context.Background(), img, "/app/Procfile"); err != registry.ErrNotFound {
+			t.Fatalf("%s: err => %v; want %v", tag, err, registry.ErrNotFound)
+		}
+	}
+}
+
+func TestClient_TokenAuth(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Token = "abcd"
+
+	s.AddImage("remind101/acme-inc", "latest", registry.ImageConfig{})
+
+	c := newTestClient()
+	img := image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Tag: "latest"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Digest(context.Background(), img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The token should be reused for the second request.
+	if got, want := len(s.Requests()), 3; got != want {
+		t.Fatalf("%d requests; want %d", got, want)
+	}
+}
+
+func newTestClient() *registry.Client {
+	c := registry.NewClient(nil)
+	c.Insecure = true
+	return c
+}
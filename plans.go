@@ -0,0 +1,126 @@
+package empire
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+// Plan describes what a deploy, rollback or config change would do, without
+// doing it.
+type Plan struct {
+	// The release that would be created. Nothing is persisted, so it
+	// doesn't have an ID, and its Version is the version that it would
+	// get. Nil if no release would be created, like when changing the
+	// config of an app that hasn't been deployed.
+	Release *Release
+
+	// What would change, compared to the current release.
+	Diff *ReleaseDiff
+
+	// The changes that the scheduler would make. Nil if no release would
+	// be created, or if the scheduler doesn't implement the
+	// scheduler.Planner interface.
+	Scheduler *scheduler.Plan
+}
+
+// plan returns what creating the release would do, without creating it,
+// running the release phase or submitting it to the scheduler. It mirrors
+// create.
+func (s *releasesService) plan(ctx context.Context, r *Release, updates []*FormationUpdate) (*Plan, error) {
+	current, err := s.store.ReleasesFirstPlan(ReleasesQuery{App: r.App})
+	if err != nil {
+		if err != gorm.RecordNotFound {
+			return nil, err
+		}
+		current = &Release{}
+	}
+
+	setFormation(r, current)
+
+	if err := r.Formation().Update(updates); err != nil {
+		return nil, err
+	}
+
+	r.Version = current.Version + 1
+
+	if err := s.store.planPorts(r); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Release: r,
+		Diff:    diffReleases(current, r),
+	}
+
+	if p, ok := s.scheduler.(scheduler.Planner); ok {
+		sp, err := p.Plan(ctx, newServiceApp(r))
+		if err != nil {
+			return nil, err
+		}
+		plan.Scheduler = withoutManagedEnv(sp)
+	}
+
+	return plan, nil
+}
+
+// managedEnv is the set of environment variables that Empire sets on every
+// process (see newServiceProcess). Some of them change with every release.
+var managedEnv = map[string]bool{
+	"EMPIRE_APPID":      true,
+	"EMPIRE_APPNAME":    true,
+	"EMPIRE_PROCESS":    true,
+	"EMPIRE_RELEASE":    true,
+	"EMPIRE_CREATED_AT": true,
+	"SOURCE":            true,
+}
+
+// withoutManagedEnv removes changes to Empire managed environment variables
+// from the scheduler's plan, so that only config changes are shown, instead of
+// every process changing with every release.
+func withoutManagedEnv(sp *scheduler.Plan) *scheduler.Plan {
+	if sp == nil {
+		return nil
+	}
+
+	for _, p := range sp.Processes {
+		var env []*scheduler.EnvChange
+		for _, c := range p.Env {
+			if !managedEnv[c.Name] {
+				env = append(env, c)
+			}
+		}
+		p.Env = env
+	}
+
+	return sp
+}
+
+// planPorts is like attachPorts, but doesn't allocate any ports. Exposed
+// processes that don't have a port yet get the port that's next in line to be
+// allocated.
+func (s *store) planPorts(r *Release) error {
+	exposed := exposedProcessTypes(r.Config, slugProcfile(r.Slug))
+
+	for _, p := range r.Processes {
+		if !exposed[p.Type] {
+			continue
+		}
+
+		port, err := s.PortsFindByApp(r.App, p.Type)
+		if err != nil {
+			return err
+		}
+
+		if port == nil {
+			port, err = portsFindAvailable(s.db)
+			if err != nil {
+				return err
+			}
+		}
+
+		p.Port = port.Port
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/scheduler"
+)
+
+func TestWithoutManagedEnv(t *testing.T) {
+	sp := &scheduler.Plan{
+		Processes: []*scheduler.ProcessPlan{
+			{
+				Type:   "web",
+				Action: scheduler.ActionUpdate,
+				Env: []*scheduler.EnvChange{
+					{Name: "DATABASE_URL", Change: scheduler.EnvChanged},
+					{Name: "EMPIRE_CREATED_AT", Change: scheduler.EnvChanged},
+					{Name: "EMPIRE_RELEASE", Change: scheduler.EnvChanged},
+					{Name: "SOURCE", Change: scheduler.EnvChanged},
+				},
+			},
+			{
+				Type:   "worker",
+				Action: scheduler.ActionUpdate,
+				Env: []*scheduler.EnvChange{
+					{Name: "EMPIRE_RELEASE", Change: scheduler.EnvChanged},
+				},
+			},
+		},
+	}
+
+	sp = withoutManagedEnv(sp)
+
+	if got, want := sp.Processes[0].Env, []*scheduler.EnvChange{{Name: "DATABASE_URL", Change: scheduler.EnvChanged}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Env => %v; want %v", got, want)
+	}
+
+	if got := sp.Processes[1].Env; got != nil {
+		t.Fatalf("Env => %v; want nil", got)
+	}
+
+	if withoutManagedEnv(nil) != nil {
+		t.Fatal("Expected a nil plan")
+	}
+}
@@ -7,29 +7,32 @@ import (
 )
 
 type Port struct {
-	ID    string
-	AppID *string
-	Port  int
+	ID          string
+	AppID       *string
+	ProcessType *string
+	Port        int
 }
 
 var ErrNoPorts = errors.New("no ports avaiable")
 
-func (s *store) PortsFindOrCreateByApp(app *App) (*Port, error) {
-	p, err := s.PortsFindByApp(app)
+// PortsFindOrCreateByApp returns the port assigned to the process type within
+// the app, assigning a new port if one hasn't been assigned yet.
+func (s *store) PortsFindOrCreateByApp(app *App, pt ProcessType) (*Port, error) {
+	p, err := s.PortsFindByApp(app, pt)
 
 	// If an error occurred or we found a port, return.
 	if err != nil || p != nil {
 		return p, err
 	}
 
-	return s.PortsAssign(app)
+	return s.PortsAssign(app, pt)
 }
 
-func (s *store) PortsFindByApp(app *App) (*Port, error) {
-	return portsFindByApp(s.db, app)
+func (s *store) PortsFindByApp(app *App, pt ProcessType) (*Port, error) {
+	return portsFindByApp(s.db, app, pt)
 }
 
-func (s *store) PortsAssign(app *App) (*Port, error) {
+func (s *store) PortsAssign(app *App, pt ProcessType) (*Port, error) {
 	var port *Port
 
 	t := s.db.Begin()
@@ -41,7 +44,9 @@ func (s *store) PortsAssign(app *App) (*Port, error) {
 	}
 
 	// Assign app to port
+	processType := string(pt)
 	port.AppID = &app.ID
+	port.ProcessType = &processType
 
 	if err := portsUpdate(t, port); err != nil {
 		t.Rollback()
@@ -60,9 +65,9 @@ func (s *store) PortsUnassign(app *App) error {
 	return portsUnassign(s.db, app)
 }
 
-func portsFindByApp(db *gorm.DB, app *App) (*Port, error) {
+func portsFindByApp(db *gorm.DB, app *App, pt ProcessType) (*Port, error) {
 	var port Port
-	if err := db.Where("app_id = ?", app.ID).Order("port").First(&port).Error; err != nil {
+	if err := db.Where("app_id = ? and process_type = ?", app.ID, string(pt)).Order("port").First(&port).Error; err != nil {
 		if err == gorm.RecordNotFound {
 			return nil, nil
 		}
@@ -89,5 +94,5 @@ func portsUpdate(db *gorm.DB, port *Port) error {
 }
 
 func portsUnassign(db *gorm.DB, app *App) error {
-	return db.Exec(`update ports set app_id = null where app_id = ?`, app.ID).Error
+	return db.Exec(`update ports set app_id = null, process_type = null where app_id = ?`, app.ID).Error
 }
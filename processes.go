@@ -5,6 +5,8 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -192,13 +194,21 @@ func (c Constraints) String() string {
 type Formation map[ProcessType]*Process
 
 // NewFormation creates a new Formation based on an existing Formation and
-// the available processes from a CommandMap.
-func NewFormation(f Formation, cm CommandMap) Formation {
+// the available processes from a CommandMap. If provided, the defaults from
+// the process definitions are used for process types that aren't in the
+// existing Formation.
+func NewFormation(f Formation, cm CommandMap, defs Procfile) Formation {
 	processes := make(Formation)
 
 	// Iterate through all of the available process types in the CommandMap.
 	for t, cmd := range cm {
+		// The release process is only run during the release phase.
+		if t == ReleaseProcessType {
+			continue
+		}
+
 		p := NewProcess(t, cmd)
+		defs[t].apply(p)
 
 		if existing, found := f[t]; found {
 			// If the existing Formation already had a process
@@ -214,6 +224,38 @@ func NewFormation(f Formation, cm CommandMap) Formation {
 	return processes
 }
 
+// FormationUpdate represents a change to the quantity and constraints of a
+// process type.
+type FormationUpdate struct {
+	Process  ProcessType
+	Quantity int
+
+	// If provided, the new constraints for the process.
+	Constraints *Constraints
+}
+
+// Update applies the updates to the processes in the Formation. A
+// ValidationError is returned if a process type doesn't exist.
+func (f Formation) Update(updates []*FormationUpdate) error {
+	for _, up := range updates {
+		p, ok := f[up.Process]
+		if !ok {
+			return &ValidationError{Err: fmt.Errorf("no %s process type in release", up.Process)}
+		}
+
+		if up.Quantity < 0 {
+			return &ValidationError{Err: fmt.Errorf("quantity for %s can't be negative", up.Process)}
+		}
+
+		p.Quantity = up.Quantity
+		if up.Constraints != nil {
+			p.Constraints = *up.Constraints
+		}
+	}
+
+	return nil
+}
+
 // newFormation takes a slice of processes and returns a Formation.
 func newFormation(p []*Process) Formation {
 	f := make(Formation)
@@ -225,6 +267,41 @@ func newFormation(p []*Process) Formation {
 	return f
 }
 
+// String returns the quantity and constraints of each process, sorted by
+// process type (e.g. "web=2 (1X), worker=1 (2X)").
+func (f Formation) String() string {
+	var types []string
+	for t := range f {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	var processes []string
+	for _, t := range types {
+		p := f[ProcessType(t)]
+		processes = append(processes, fmt.Sprintf("%s=%d (%s)", t, p.Quantity, p.Constraints))
+	}
+
+	return strings.Join(processes, ", ")
+}
+
+// updates returns the FormationUpdates that would set the quantity and
+// constraints of each process to match this Formation.
+func (f Formation) updates() []*FormationUpdate {
+	var updates []*FormationUpdate
+
+	for t, p := range f {
+		constraints := p.Constraints
+		updates = append(updates, &FormationUpdate{
+			Process:     t,
+			Quantity:    p.Quantity,
+			Constraints: &constraints,
+		})
+	}
+
+	return updates
+}
+
 // Processes takes a Formation and returns a slice of the processes.
 func (f Formation) Processes() []*Process {
 	var processes []*Process
@@ -22,9 +22,12 @@ func TestProcessesQuery(t *testing.T) {
 }
 
 func TestNewFormation(t *testing.T) {
+	two := 2
+
 	tests := []struct {
-		f  Formation
-		cm CommandMap
+		f    Formation
+		cm   CommandMap
+		defs Procfile
 
 		expected Formation
 	}{
@@ -101,10 +104,60 @@ func TestNewFormation(t *testing.T) {
 				},
 			},
 		},
+
+		{
+			f: nil,
+			cm: CommandMap{
+				"web":     "./bin/web",
+				"release": "./bin/migrate",
+			},
+			expected: Formation{
+				"web": &Process{
+					Type:        "web",
+					Quantity:    1,
+					Command:     "./bin/web",
+					Constraints: NamedConstraints["1X"],
+				},
+			},
+		},
+
+		// Defaults from the Procfile only apply to new process types.
+		{
+			f: Formation{
+				"web": &Process{
+					Type:        "web",
+					Quantity:    5,
+					Command:     "./bin/web",
+					Constraints: NamedConstraints["1X"],
+				},
+			},
+			cm: CommandMap{
+				"web":    "./bin/web",
+				"worker": "sidekiq",
+			},
+			defs: Procfile{
+				"web":    &ProcessDefinition{Command: "./bin/web", Size: "2X", Quantity: &two},
+				"worker": &ProcessDefinition{Command: "sidekiq", Size: "1024:2GB", Quantity: &two},
+			},
+			expected: Formation{
+				"web": &Process{
+					Type:        "web",
+					Quantity:    5,
+					Command:     "./bin/web",
+					Constraints: NamedConstraints["1X"],
+				},
+				"worker": &Process{
+					Type:        "worker",
+					Quantity:    2,
+					Command:     "sidekiq",
+					Constraints: Constraints{constraints.CPUShare(1024), constraints.Memory(2 * GB)},
+				},
+			},
+		},
 	}
 
 	for i, tt := range tests {
-		f := NewFormation(tt.f, tt.cm)
+		f := NewFormation(tt.f, tt.cm, tt.defs)
 
 		if got, want := f, tt.expected; !reflect.DeepEqual(got, want) {
 			t.Fatalf("%d processes => %v; want %v", i, got, want)
@@ -112,6 +165,50 @@ func TestNewFormation(t *testing.T) {
 	}
 }
 
+func TestFormation_Update(t *testing.T) {
+	f := Formation{
+		"web":    &Process{Type: "web", Quantity: 1, Constraints: Constraints1X},
+		"worker": &Process{Type: "worker", Quantity: 1, Constraints: Constraints1X},
+	}
+
+	if err := f.Update([]*FormationUpdate{
+		{Process: "web", Quantity: 3, Constraints: &Constraints2X},
+		{Process: "worker", Quantity: 0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Formation{
+		"web":    &Process{Type: "web", Quantity: 3, Constraints: Constraints2X},
+		"worker": &Process{Type: "worker", Quantity: 0, Constraints: Constraints1X},
+	}
+
+	if got, want := f, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Formation => %v; want %v", got, want)
+	}
+
+	err := f.Update([]*FormationUpdate{{Process: "scheduler", Quantity: 1}})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("err => %v; want a ValidationError", err)
+	}
+
+	err = f.Update([]*FormationUpdate{{Process: "web", Quantity: -1}})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("err => %v; want a ValidationError", err)
+	}
+}
+
+func TestFormation_String(t *testing.T) {
+	f := Formation{
+		"worker": &Process{Type: "worker", Quantity: 0, Constraints: Constraints2X},
+		"web":    &Process{Type: "web", Quantity: 2, Constraints: Constraints1X},
+	}
+
+	if got, want := f.String(), "web=2 (1X), worker=0 (2X)"; got != want {
+		t.Fatalf("String() => %q; want %q", got, want)
+	}
+}
+
 func TestConstraints_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		in  string
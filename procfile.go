@@ -0,0 +1,230 @@
+package empire
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Procfile maps a process type to its definition in a Procfile.
+type Procfile map[ProcessType]*ProcessDefinition
+
+// Commands returns the command for each process type.
+func (p Procfile) Commands() CommandMap {
+	cm := make(CommandMap)
+
+	for t, def := range p {
+		cm[t] = def.Command
+	}
+
+	return cm
+}
+
+// Validate validates each process definition.
+func (p Procfile) Validate() error {
+	for t, def := range p {
+		if def == nil {
+			return &ValidationError{Err: fmt.Errorf("Procfile: %s: missing command", t)}
+		}
+
+		if err := def.Validate(); err != nil {
+			return &ValidationError{Err: fmt.Errorf("Procfile: %s: %v", t, err)}
+		}
+	}
+
+	return nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (p *Procfile) Scan(src interface{}) error {
+	*p = nil
+
+	if src == nil {
+		return nil
+	}
+
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("procfile: can't scan %T", src)
+	}
+
+	return json.Unmarshal(b, p)
+}
+
+// Value implements the driver.Value interface.
+func (p Procfile) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.Value(b), nil
+}
+
+// ProcessDefinition is the definition of a process type in a Procfile. The
+// standard Procfile format only provides the command:
+//
+//	web: ./bin/web
+//
+// The extended format also declares defaults for the process:
+//
+//	web:
+//	  command: ./bin/web
+//	  size: 2X
+//	  quantity: 2
+//	  port: 8080
+//	  health_check: /health
+//	  exposure: public
+//	  env:
+//	    WEB_CONCURRENCY: "4"
+//
+// The size and quantity are only used when the process type is first added to
+// an app's formation. After that, the app's formation is kept, so that
+// scaling isn't undone by the next deploy.
+type ProcessDefinition struct {
+	// The command to run.
+	Command Command `yaml:"command" json:"command"`
+
+	// If provided, the default size of the process. Either one of the
+	// NamedConstraints (e.g. 2X), or cpu:memory (e.g. 512:1GB).
+	Size string `yaml:"size" json:"size,omitempty"`
+
+	// If provided, the default number of instances of the process.
+	Quantity *int `yaml:"quantity" json:"quantity,omitempty"`
+
+	// If provided, the port that the process listens on inside the
+	// container. The process is exposed behind a load balancer.
+	Port int `yaml:"port" json:"port,omitempty"`
+
+	// If provided, the HTTP path that the load balancer checks to
+	// determine if an instance is healthy.
+	HealthCheck string `yaml:"health_check" json:"health_check,omitempty"`
+
+	// If provided, the exposure of the process's load balancer (private or
+	// public), instead of the app's exposure. The process is exposed behind
+	// a load balancer.
+	Exposure string `yaml:"exposure" json:"exposure,omitempty"`
+
+	// Environment variables to set for the process. Config vars take
+	// precedence over these.
+	Env map[string]string `yaml:"env" json:"env,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface. A process can be
+// either a command, or a definition in the extended format.
+func (d *ProcessDefinition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var cmd string
+	if err := unmarshal(&cmd); err == nil {
+		*d = ProcessDefinition{Command: Command(cmd)}
+		return nil
+	}
+
+	// Avoid recursing into this method.
+	type definition ProcessDefinition
+	var def definition
+	if err := unmarshal(&def); err != nil {
+		return err
+	}
+
+	*d = ProcessDefinition(def)
+	return nil
+}
+
+// Validate validates the process definition.
+func (d *ProcessDefinition) Validate() error {
+	if strings.TrimSpace(string(d.Command)) == "" {
+		return errors.New("missing command")
+	}
+
+	if _, err := parseConstraints(d.Size); err != nil {
+		return fmt.Errorf("invalid size %q: %v", d.Size, err)
+	}
+
+	if d.Quantity != nil && *d.Quantity < 0 {
+		return errors.New("quantity can't be negative")
+	}
+
+	if d.Port < 0 || d.Port > 65535 {
+		return fmt.Errorf("invalid port %d", d.Port)
+	}
+
+	if d.HealthCheck != "" && !strings.HasPrefix(d.HealthCheck, "/") {
+		return fmt.Errorf("health check %q must be a path starting with /", d.HealthCheck)
+	}
+
+	switch d.Exposure {
+	case "", ExposePrivate, ExposePublic:
+	default:
+		return fmt.Errorf("exposure must be %s or %s", ExposePrivate, ExposePublic)
+	}
+
+	return nil
+}
+
+// set sets a setting of the definition from its string value, using the names
+// from the extended Procfile format.
+func (d *ProcessDefinition) set(setting, v string) error {
+	if strings.HasPrefix(setting, "env.") {
+		if d.Env == nil {
+			d.Env = make(map[string]string)
+		}
+		d.Env[strings.TrimPrefix(setting, "env.")] = v
+		return nil
+	}
+
+	switch setting {
+	case "command":
+		d.Command = Command(v)
+	case "size":
+		d.Size = v
+	case "quantity":
+		q, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid quantity %q", v)
+		}
+		d.Quantity = &q
+	case "port":
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", v)
+		}
+		d.Port = port
+	case "health_check":
+		d.HealthCheck = v
+	case "exposure":
+		d.Exposure = v
+	default:
+		return fmt.Errorf("unknown setting %q", setting)
+	}
+
+	return nil
+}
+
+// exposed returns true if the definition declares that the process should be
+// exposed behind a load balancer.
+func (d *ProcessDefinition) exposed() bool {
+	return d != nil && (d.Port != 0 || d.Exposure != "")
+}
+
+// apply sets the defaults from the definition on a new process.
+func (d *ProcessDefinition) apply(p *Process) {
+	if d == nil {
+		return
+	}
+
+	if d.Quantity != nil {
+		p.Quantity = *d.Quantity
+	}
+
+	// The size was validated when the Procfile was parsed.
+	if c, _ := parseConstraints(d.Size); c != nil {
+		p.Constraints = *c
+	}
+}
@@ -0,0 +1,100 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcfile(t *testing.T) {
+	two := 2
+
+	tests := []struct {
+		in  string
+		out Procfile
+	}{
+		{
+			`web: ./bin/web`,
+			Procfile{
+				"web": &ProcessDefinition{Command: "./bin/web"},
+			},
+		},
+
+		{
+			`
+web:
+  command: ./bin/web
+  size: 2X
+  quantity: 2
+  port: 5000
+  health_check: /health
+  exposure: public
+  env:
+    WEB_CONCURRENCY: "4"
+worker: ./bin/worker`,
+			Procfile{
+				"web": &ProcessDefinition{
+					Command:     "./bin/web",
+					Size:        "2X",
+					Quantity:    &two,
+					Port:        5000,
+					HealthCheck: "/health",
+					Exposure:    "public",
+					Env:         map[string]string{"WEB_CONCURRENCY": "4"},
+				},
+				"worker": &ProcessDefinition{Command: "./bin/worker"},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		got, err := ParseProcfile([]byte(tt.in))
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		if want := tt.out; !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d: ParseProcfile() => %v; want %v", i, got.Commands(), want.Commands())
+		}
+	}
+}
+
+func TestParseProcfile_Invalid(t *testing.T) {
+	tests := []string{
+		"web:\n  command: ./bin/web\n  size: 3X",
+		"web:\n  command: ./bin/web\n  quantity: -1",
+		"web:\n  command: ./bin/web\n  port: 70000",
+		"web:\n  command: ./bin/web\n  health_check: health",
+		"web:\n  command: ./bin/web\n  exposure: everyone",
+		"web:\n",
+		"worker: ~",
+		"web:\n  size: 2X",
+	}
+
+	for _, in := range tests {
+		_, err := ParseProcfile([]byte(in))
+		if _, ok := err.(*ValidationError); !ok {
+			t.Errorf("ParseProcfile(%q) => %v; want a ValidationError", in, err)
+		}
+	}
+}
+
+func TestProcfile_Value(t *testing.T) {
+	two := 2
+	p := Procfile{
+		"web": &ProcessDefinition{Command: "./bin/web", Quantity: &two, Port: 5000},
+	}
+
+	v, err := p.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Procfile
+	if err := got.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("Scan() => %v; want %v", got, p)
+	}
+}
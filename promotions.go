@@ -0,0 +1,93 @@
+package empire
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/net/context"
+)
+
+// PromotionsCreateOpts represents options that can be passed when promoting
+// a release from one app to another.
+type PromotionsCreateOpts struct {
+	// The app to promote the release from (e.g. acme-staging).
+	Source *App
+
+	// If provided, the version of the source app's release to promote.
+	// The zero value is the source app's current release.
+	Version int
+
+	// The app to promote the release to (e.g. acme-prod).
+	Target *App
+
+	// The user that is promoting the release.
+	User *User
+}
+
+// promotionsService promotes the slug of one app's release to another app,
+// so that exactly what was tested in one environment is released to the
+// next.
+type promotionsService struct {
+	store    *store
+	configs  *configsService
+	releases *releasesService
+	locker   *appLocker
+}
+
+// Promote creates a new release on the target app, using the slug from the
+// source app's release, and the target app's current config.
+func (s *promotionsService) Promote(ctx context.Context, opts PromotionsCreateOpts) (*Release, error) {
+	source, target := opts.Source, opts.Target
+
+	if source.ID == target.ID {
+		return nil, &ValidationError{Err: fmt.Errorf("can't promote %s to itself", source.Name)}
+	}
+
+	q := ReleasesQuery{App: source}
+	if opts.Version != 0 {
+		q.Version = &opts.Version
+	}
+
+	from, err := s.store.ReleasesFirst(q)
+	if err != nil {
+		if err == gorm.RecordNotFound && opts.Version == 0 {
+			return nil, &ValidationError{Err: fmt.Errorf("%s has no releases to promote", source.Name)}
+		}
+		return nil, err
+	}
+
+	unlock, err := s.locker.Lock(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.store.canaryRunning(target); err != nil {
+		return nil, err
+	}
+
+	config, err := s.configs.ConfigsCurrent(target)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := s.store.DeploymentsCreate(newDeployment(target, from.Slug.Image, opts.User, SourcePromotion))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.releases.ReleasesCreate(ctx, &Release{
+		App:            target,
+		Config:         config,
+		Slug:           from.Slug,
+		RequestedImage: from.RequestedImage,
+		Description:    fmt.Sprintf("Promote %s v%d (%s)", source.Name, from.Version, from.Slug.Image),
+	})
+
+	d.Finish(r, err)
+	if uerr := s.store.DeploymentsUpdate(d); uerr != nil && err == nil {
+		err = uerr
+	}
+
+	return r, err
+}
@@ -1,11 +1,16 @@
 package empire
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/jinzhu/gorm"
 	"github.com/remind101/empire/pkg/headerutil"
+	"github.com/remind101/empire/pkg/image"
 	"github.com/remind101/empire/scheduler"
 	"github.com/remind101/pkg/timex"
 	"golang.org/x/net/context"
@@ -26,10 +31,22 @@ type Release struct {
 	SlugID string
 	Slug   *Slug
 
+	// The image that was requested when it was deployed (e.g.
+	// remind101/acme-inc:latest), before it was pinned. Slugs are shared
+	// by every deploy of the same image, so this is recorded on the
+	// release. Releases that don't deploy an image (e.g. config changes
+	// and rollbacks) keep the requested image of the release that they're
+	// based on.
+	RequestedImage image.Image
+
 	Processes []*Process
 
 	Description string
-	CreatedAt   *time.Time
+
+	// Pinned releases are never garbage collected.
+	Pinned bool
+
+	CreatedAt *time.Time
 }
 
 // Formation creates a Formation object
@@ -93,6 +110,16 @@ func (q ReleasesQuery) DefaultRange() headerutil.Range {
 
 // ReleasesFirst returns the first matching release.
 func (s *store) ReleasesFirst(scope Scope) (*Release, error) {
+	return s.releasesFirst(scope, s.attachPorts)
+}
+
+// ReleasesFirstPlan is like ReleasesFirst, but uses planPorts, so that no
+// ports are allocated. It's used when planning.
+func (s *store) ReleasesFirstPlan(scope Scope) (*Release, error) {
+	return s.releasesFirst(scope, s.planPorts)
+}
+
+func (s *store) releasesFirst(scope Scope, ports func(*Release) error) (*Release, error) {
 	var release Release
 	// TODO: Wrap the store with this. Gorm blows up when preloading
 	// App.Certificates on a collection of releases.
@@ -101,7 +128,7 @@ func (s *store) ReleasesFirst(scope Scope) (*Release, error) {
 		return &release, err
 	}
 
-	if err := s.attachPorts(&release); err != nil {
+	if err := ports(&release); err != nil {
 		return &release, err
 	}
 
@@ -123,76 +150,308 @@ func (s *store) ReleasesCreate(r *Release) (*Release, error) {
 	return releasesCreate(s.db, r)
 }
 
-// attachPorts returns a map of ports for a release. It will allocate new ports to an app if need be.
+// attachPorts assigns a port to each exposed process in the release. It will
+// allocate new ports to an app if need be.
 func (s *store) attachPorts(r *Release) error {
+	exposed := exposedProcessTypes(r.Config, slugProcfile(r.Slug))
+
 	for _, p := range r.Processes {
-		if p.Type == WebProcessType {
-			// TODO: Support a port per process, allowing more than one process to expose a port.
-			port, err := s.PortsFindOrCreateByApp(r.App)
-			if err != nil {
-				return err
-			}
-			p.Port = port.Port
+		if !exposed[p.Type] {
+			continue
 		}
+
+		port, err := s.PortsFindOrCreateByApp(r.App, p.Type)
+		if err != nil {
+			return err
+		}
+		p.Port = port.Port
 	}
 	return nil
 }
 
+// exposedProcessTypes returns the process types that should be assigned a port
+// and exposed behind a load balancer. The web process is always exposed, and
+// other processes can be exposed by listing them in the
+// EMPIRE_EXPOSED_PROCESSES config var, or by declaring a port or exposure in
+// the Procfile.
+func exposedProcessTypes(config *Config, defs Procfile) map[ProcessType]bool {
+	exposed := map[ProcessType]bool{
+		WebProcessType: true,
+	}
+
+	for t, def := range defs {
+		if def.exposed() {
+			exposed[t] = true
+		}
+	}
+
+	if config == nil {
+		return exposed
+	}
+
+	if v := config.Vars[ExposedProcessesVar]; v != nil {
+		for _, t := range strings.Split(*v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				exposed[ProcessType(t)] = true
+			}
+		}
+	}
+
+	return exposed
+}
+
 // releasesService is a service for creating and rolling back a Release.
 type releasesService struct {
 	store    *store
 	releaser *releaser
+
+	// The scheduler used to run the release phase.
+	scheduler scheduler.Scheduler
+
+	locker *appLocker
 }
 
 // ReleasesCreate creates the release, then sets the current process formation on the release.
-func (s *releasesService) ReleasesCreate(ctx context.Context, r *Release) (*Release, error) {
+// If provided, the updates are applied to the new formation.
+func (s *releasesService) ReleasesCreate(ctx context.Context, r *Release, updates ...*FormationUpdate) (*Release, error) {
+	r, err := s.create(ctx, r, updates)
+	if err != nil {
+		return r, err
+	}
+
+	// Schedule the new release onto the cluster.
+	return r, s.releaser.Release(ctx, r)
+}
+
+// ReleasesCreateCanary creates the release, but only schedules canaries of
+// its processes onto the cluster. The existing processes keep running the
+// previous release until the canary is promoted. If the canaries can't be
+// scheduled, the release is deleted again, so that it doesn't become the
+// app's latest release without ever having run.
+func (s *releasesService) ReleasesCreateCanary(ctx context.Context, r *Release, opts CanaryOpts, updates ...*FormationUpdate) (*Release, error) {
+	r, err := s.create(ctx, r, updates)
+	if err != nil {
+		return r, err
+	}
+
+	if err := s.releaser.ReleaseCanary(ctx, r, opts); err != nil {
+		if _, derr := s.store.ReleasesDelete([]*Release{r}); derr != nil {
+			return nil, fmt.Errorf("%v (and deleting v%d failed: %v)", err, r.Version, derr)
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// create creates the formation for the release, applies the updates to it,
+// runs the release phase, then inserts the release, without scheduling it.
+func (s *releasesService) create(ctx context.Context, r *Release, updates []*FormationUpdate) (*Release, error) {
 	// Create a new formation for this release.
 	if err := s.createFormation(r); err != nil {
 		return nil, err
 	}
 
-	r, err := s.store.ReleasesCreate(r)
+	if err := r.Formation().Update(updates); err != nil {
+		return nil, err
+	}
+
+	// The release phase runs before the release is inserted, so it's given
+	// the version that the release will be inserted with. The app is locked
+	// while releases are created, so the version can't be taken in the
+	// meantime.
+	v, err := releasesLastVersion(s.store.db, r.App.ID)
 	if err != nil {
-		return r, err
+		return nil, err
 	}
+	r.Version = v + 1
 
-	// Schedule the new release onto the cluster.
-	return r, s.releaser.Release(ctx, r)
+	// Run the release phase before the release is created, so that a
+	// failed release never becomes the current release.
+	if err := s.runReleasePhase(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return s.store.ReleasesCreate(r)
 }
 
-func (s *releasesService) createFormation(release *Release) error {
-	var existing Formation
+// runReleasePhase runs the release process type from the slug, if there is
+// one, as a one off process with the new slug and config, and waits for it to
+// exit. An error is returned if it exits with a non-zero status.
+func (s *releasesService) runReleasePhase(ctx context.Context, release *Release) error {
+	cmd, ok := release.Slug.ProcessTypes[ReleaseProcessType]
+	if !ok {
+		return nil
+	}
+
+	if err := s.runDetached(ctx, release, ReleaseProcessType, cmd); err != nil {
+		return fmt.Errorf("release phase: %v", err)
+	}
+
+	return nil
+}
+
+// runPostdeploy runs the postdeploy script from the app.json manifest, if
+// there is one, as a one off process with the release, and waits for it to
+// exit.
+func (s *releasesService) runPostdeploy(ctx context.Context, release *Release) error {
+	cmd := release.Slug.Manifest.Scripts.Postdeploy
+	if cmd == "" {
+		return nil
+	}
+
+	if err := s.runDetached(ctx, release, PostdeployProcessType, Command(cmd)); err != nil {
+		return fmt.Errorf("postdeploy: %v", err)
+	}
+
+	return nil
+}
+
+// runDetached runs the command as a one off process with the release's slug
+// and config, and waits for it to exit. An error is returned if it exits with
+// a non-zero status.
+func (s *releasesService) runDetached(ctx context.Context, release *Release, t ProcessType, cmd Command) error {
+	w, ok := s.scheduler.(scheduler.Waiter)
+	if !ok {
+		return scheduler.ErrWaitNotSupported
+	}
 
+	a := newServiceApp(release)
+	p := newServiceProcess(release, NewProcess(t, cmd))
+
+	instance, err := s.scheduler.Run(ctx, a, p, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if instance == nil {
+		return errors.New("no process was started")
+	}
+
+	if err := w.Wait(ctx, release.App.ID, instance.ID); err != nil {
+		return fmt.Errorf("`%s` failed: %v", cmd, err)
+	}
+
+	return nil
+}
+
+func (s *releasesService) createFormation(release *Release) error {
 	// Get the old release, so we can copy the Formation.
 	last, err := s.store.ReleasesFirst(ReleasesQuery{App: release.App})
 	if err != nil {
 		if err != gorm.RecordNotFound {
 			return err
 		}
-	} else {
-		existing = last.Formation()
+		last = &Release{}
 	}
 
-	f := NewFormation(existing, release.Slug.ProcessTypes)
-	release.Processes = f.Processes()
+	setFormation(release, last)
 
 	return nil
 }
 
+// setFormation sets the processes of the release from its slug, copying the
+// quantity and constraints of each process from the last release.
+func setFormation(release *Release, last *Release) {
+	f := NewFormation(last.Formation(), release.Slug.ProcessTypes, release.Slug.Procfile)
+	release.Processes = f.Processes()
+}
+
+// RollbackOpts represents options that can be passed when rolling back to a
+// release.
+type RollbackOpts struct {
+	// If true, the quantity and constraints of each process are restored
+	// from the release that's being rolled back to. Otherwise, the current
+	// formation is kept.
+	RestoreFormation bool
+}
+
 // Rolls back to a specific release version.
-func (s *releasesService) ReleasesRollback(ctx context.Context, app *App, version int) (*Release, error) {
-	r, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+func (s *releasesService) ReleasesRollback(ctx context.Context, app *App, version int, opts RollbackOpts) (*Release, error) {
+	unlock, err := s.locker.Lock(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.store.canaryRunning(app); err != nil {
+		return nil, err
+	}
+
+	return s.rollback(ctx, app, version, "", opts)
+}
+
+// ReleasesRollbackPlan returns what rolling back to a specific release version
+// would do, without doing it.
+func (s *releasesService) ReleasesRollbackPlan(ctx context.Context, app *App, version int, opts RollbackOpts) (*Plan, error) {
+	target, err := s.store.ReleasesFirstPlan(ReleasesQuery{App: app, Version: &version})
 	if err != nil {
 		return nil, err
 	}
 
-	desc := fmt.Sprintf("Rollback to v%d", version)
-	return s.ReleasesCreate(ctx, &Release{
-		App:         app,
-		Config:      r.Config,
-		Slug:        r.Slug,
-		Description: desc,
-	})
+	r, updates := rollbackRelease(target, "", opts)
+	return s.plan(ctx, r, updates)
+}
+
+// rollback rolls back to a specific release version. If a reason is provided,
+// it's included in the description of the new release. The formation that was
+// applied is written to the output of the rollback's deployment.
+func (s *releasesService) rollback(ctx context.Context, app *App, version int, reason string, opts RollbackOpts) (*Release, error) {
+	target, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+	if err != nil {
+		return nil, err
+	}
+
+	user, _ := UserFromContext(ctx)
+	d, err := s.store.DeploymentsCreate(newDeployment(app, target.Slug.Image, user, SourceRollback))
+	if err != nil {
+		return nil, err
+	}
+
+	r, updates := rollbackRelease(target, reason, opts)
+	r, err = s.ReleasesCreate(ctx, r, updates...)
+
+	if err == nil {
+		msg := jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Rolled back %s to v%d as v%d, with formation %s", app.Name, version, r.Version, r.Formation())}
+		err = json.NewEncoder(&deploymentOutput{store: s.store, deployment: d}).Encode(&msg)
+	}
+
+	d.Finish(r, err)
+	if uerr := s.store.DeploymentsUpdate(d); uerr != nil && err == nil {
+		err = uerr
+	}
+
+	return r, err
+}
+
+// rollbackRelease returns the release that rolls back to the target release,
+// and the formation updates to apply to it.
+func rollbackRelease(target *Release, reason string, opts RollbackOpts) (*Release, []*FormationUpdate) {
+	var updates []*FormationUpdate
+
+	desc := fmt.Sprintf("Rollback to v%d", target.Version)
+	if opts.RestoreFormation {
+		updates = target.Formation().updates()
+		desc += " with its formation"
+	}
+	if reason != "" {
+		desc = fmt.Sprintf("%s (%s)", desc, reason)
+	}
+
+	return &Release{
+		App:            target.App,
+		Config:         target.Config,
+		Slug:           target.Slug,
+		RequestedImage: target.RequestedImage,
+		Description:    desc,
+	}, updates
+}
+
+// ReleasesPin pins or unpins a release, so that it's kept when garbage
+// collecting releases.
+func (s *store) ReleasesPin(r *Release, pinned bool) error {
+	r.Pinned = pinned
+	return s.db.Model(r).UpdateColumn("pinned", pinned).Error
 }
 
 // ReleasesLastVersion returns the last ReleaseVersion for the given App. This
@@ -229,6 +488,19 @@ func releasesCreate(db *gorm.DB, release *Release) (*Release, error) {
 	// Increment the release version.
 	release.Version = v + 1
 
+	if release.RequestedImage.Repository == "" && release.Slug != nil {
+		release.RequestedImage = release.Slug.Image
+	}
+
+	// Insert the config if it's new (e.g. config changes made by a
+	// deployment), so that it's only persisted if the release is.
+	if release.Config != nil && release.Config.ID == "" {
+		if _, err := configsCreate(t, release.Config); err != nil {
+			t.Rollback()
+			return release, err
+		}
+	}
+
 	if err := t.Create(release).Error; err != nil {
 		t.Rollback()
 		return release, err
@@ -254,6 +526,19 @@ func (r *releaser) Release(ctx context.Context, release *Release) error {
 	return r.scheduler.Submit(ctx, a)
 }
 
+// ReleaseCanary schedules canaries of the release's processes onto the
+// cluster, alongside the existing processes.
+func (r *releaser) ReleaseCanary(ctx context.Context, release *Release, opts CanaryOpts) error {
+	s, ok := r.scheduler.(scheduler.CanarySubmitter)
+	if !ok {
+		return scheduler.ErrCanaryNotSupported
+	}
+
+	a := newServiceApp(release)
+	a.Processes = canaryProcesses(a.Processes, opts)
+	return s.SubmitCanary(ctx, a)
+}
+
 // ReleaseApp will find the last release for an app and release it.
 func (r *releaser) ReleaseApp(ctx context.Context, app *App) error {
 	release, err := r.store.ReleasesFirst(ReleasesQuery{App: app})
@@ -284,9 +569,20 @@ func newServiceApp(release *Release) *scheduler.App {
 
 func newServiceProcess(release *Release, p *Process) *scheduler.Process {
 	var procExp scheduler.Exposure
-	ports := newServicePorts(int64(p.Port))
+	def := slugProcfile(release.Slug)[p.Type]
+	ports := newServicePorts(p.Type, int64(p.Port), def)
 
-	env := environment(release.Config.Vars)
+	env := make(map[string]string)
+	if def != nil {
+		for k, v := range def.Env {
+			env[k] = v
+		}
+	}
+	for k, v := range environment(release.Config.Vars) {
+		env[k] = v
+	}
+	// These are left out of plans, so managedEnv needs to be updated
+	// when they change.
 	env["EMPIRE_APPID"] = release.App.ID
 	env["EMPIRE_APPNAME"] = release.App.Name
 	env["EMPIRE_PROCESS"] = string(p.Type)
@@ -297,8 +593,17 @@ func newServiceProcess(release *Release, p *Process) *scheduler.Process {
 	if len(ports) > 0 {
 		env["PORT"] = fmt.Sprintf("%d", *ports[0].Container)
 
-		// If we have exposed ports, set process exposure to apps exposure
+		// If we have exposed ports, set process exposure to apps
+		// exposure, unless the Procfile declares one.
 		procExp = serviceExposure(release.App.Exposure)
+		if def != nil && def.Exposure != "" {
+			procExp = serviceExposure(def.Exposure)
+		}
+	}
+
+	var healthCheck string
+	if def != nil {
+		healthCheck = def.HealthCheck
 	}
 
 	cert := serviceSSLCertName(release.App.Certificates)
@@ -314,15 +619,26 @@ func newServiceProcess(release *Release, p *Process) *scheduler.Process {
 		Ports:       ports,
 		Exposure:    procExp,
 		SSLCert:     cert,
+		HealthCheck: healthCheck,
 	}
 }
 
-func newServicePorts(hostPort int64) []scheduler.PortMap {
+func newServicePorts(t ProcessType, hostPort int64, def *ProcessDefinition) []scheduler.PortMap {
 	var ports []scheduler.PortMap
 	if hostPort != 0 {
-		// TODO: We can just map the same host port as the container port, as we make it
-		// available as $PORT in the env vars.
-		port := int64(WebPort)
+		// Other processes use the same container port as the host port,
+		// which is made available as $PORT in the env vars. The web
+		// process keeps using WebPort, since the container port of an
+		// existing ECS service's load balancer can't be changed. A port
+		// declared in the Procfile takes precedence over both.
+		port := hostPort
+		if t == WebProcessType {
+			port = int64(WebPort)
+		}
+		if def != nil && def.Port != 0 {
+			port = int64(def.Port)
+		}
+
 		ports = append(ports, scheduler.PortMap{
 			Host:      &hostPort,
 			Container: &port,
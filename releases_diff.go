@@ -0,0 +1,263 @@
+package empire
+
+import (
+	"sort"
+
+	"github.com/remind101/empire/pkg/image"
+)
+
+// Types of changes between two releases.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// ReleaseDiff describes what changed between two releases.
+type ReleaseDiff struct {
+	// The versions of the releases that were compared.
+	From, To int
+
+	// If the image changed, the old and new image.
+	Image *ImageDiff
+
+	// Config vars that were added, removed or changed. Values are never
+	// included.
+	Vars []*VarDiff
+
+	// Process types that were added, removed or changed.
+	Processes []*ProcessDiff
+}
+
+// ImageDiff represents a change to the image that's deployed.
+type ImageDiff struct {
+	From, To image.Image
+}
+
+// VarDiff represents a change to a config var.
+type VarDiff struct {
+	Name   Variable
+	Change string
+}
+
+// ProcessDiff represents a change to a process type. Fields that didn't
+// change are nil.
+type ProcessDiff struct {
+	Type   ProcessType
+	Change string
+
+	Command     *CommandDiff
+	Quantity    *QuantityDiff
+	Constraints *ConstraintsDiff
+}
+
+// CommandDiff represents a change to a process command.
+type CommandDiff struct {
+	From, To Command
+}
+
+// QuantityDiff represents a change to the number of instances of a process.
+type QuantityDiff struct {
+	From, To int
+}
+
+// ConstraintsDiff represents a change to the constraints of a process.
+type ConstraintsDiff struct {
+	From, To Constraints
+}
+
+// diffReleases compares two releases and returns what changed between them.
+func diffReleases(from, to *Release) *ReleaseDiff {
+	d := &ReleaseDiff{
+		From: from.Version,
+		To:   to.Version,
+	}
+
+	var fromImage, toImage image.Image
+	if from.Slug != nil {
+		fromImage = from.Slug.Image
+	}
+	if to.Slug != nil {
+		toImage = to.Slug.Image
+	}
+
+	if fromImage != toImage {
+		d.Image = &ImageDiff{From: fromImage, To: toImage}
+	}
+
+	d.Vars = diffVars(configVars(from.Config), configVars(to.Config))
+	d.Processes = diffProcesses(from, to)
+
+	return d
+}
+
+// diffVars returns the config vars that changed. Only the names of the vars
+// are returned, so that secrets aren't exposed.
+func diffVars(from, to Vars) []*VarDiff {
+	var diffs []*VarDiff
+
+	for _, name := range varNames(from, to) {
+		a, inFrom := from[name]
+		b, inTo := to[name]
+
+		switch {
+		case !inFrom:
+			diffs = append(diffs, &VarDiff{Name: name, Change: ChangeAdded})
+		case !inTo:
+			diffs = append(diffs, &VarDiff{Name: name, Change: ChangeRemoved})
+		case stringValue(a) != stringValue(b):
+			diffs = append(diffs, &VarDiff{Name: name, Change: ChangeChanged})
+		}
+	}
+
+	return diffs
+}
+
+// diffProcesses returns the process types that changed, using the commands
+// from the slug and the quantity and constraints from the formation.
+func diffProcesses(from, to *Release) []*ProcessDiff {
+	var (
+		fromCommands, toCommands   = slugProcessTypes(from.Slug), slugProcessTypes(to.Slug)
+		fromFormation, toFormation = from.Formation(), to.Formation()
+	)
+
+	var diffs []*ProcessDiff
+
+	for _, t := range processTypes(fromCommands, toCommands, fromFormation, toFormation) {
+		a, inFrom := fromFormation[t]
+		b, inTo := toFormation[t]
+
+		if _, ok := fromCommands[t]; ok {
+			inFrom = true
+		}
+		if _, ok := toCommands[t]; ok {
+			inTo = true
+		}
+
+		switch {
+		case !inFrom:
+			diffs = append(diffs, &ProcessDiff{Type: t, Change: ChangeAdded})
+			continue
+		case !inTo:
+			diffs = append(diffs, &ProcessDiff{Type: t, Change: ChangeRemoved})
+			continue
+		}
+
+		d := &ProcessDiff{Type: t, Change: ChangeChanged}
+
+		if a, b := fromCommands[t], toCommands[t]; a != b {
+			d.Command = &CommandDiff{From: a, To: b}
+		}
+
+		if a != nil && b != nil {
+			if a.Quantity != b.Quantity {
+				d.Quantity = &QuantityDiff{From: a.Quantity, To: b.Quantity}
+			}
+
+			if a.Constraints != b.Constraints {
+				d.Constraints = &ConstraintsDiff{From: a.Constraints, To: b.Constraints}
+			}
+		}
+
+		if d.Command != nil || d.Quantity != nil || d.Constraints != nil {
+			diffs = append(diffs, d)
+		}
+	}
+
+	return diffs
+}
+
+func configVars(c *Config) Vars {
+	if c == nil {
+		return nil
+	}
+	return c.Vars
+}
+
+func slugProcessTypes(s *Slug) CommandMap {
+	if s == nil {
+		return nil
+	}
+	return s.ProcessTypes
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// varNames returns the sorted union of the var names.
+func varNames(vars ...Vars) []Variable {
+	seen := make(map[Variable]bool)
+	var names []string
+
+	for _, v := range vars {
+		for name := range v {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, string(name))
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	variables := make([]Variable, len(names))
+	for i, name := range names {
+		variables[i] = Variable(name)
+	}
+
+	return variables
+}
+
+// processTypes returns the sorted union of the process types in the command
+// maps and formations.
+func processTypes(fromCommands, toCommands CommandMap, fromFormation, toFormation Formation) []ProcessType {
+	seen := make(map[ProcessType]bool)
+	var types []string
+
+	add := func(t ProcessType) {
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, string(t))
+		}
+	}
+
+	for _, cm := range []CommandMap{fromCommands, toCommands} {
+		for t := range cm {
+			add(t)
+		}
+	}
+
+	for _, f := range []Formation{fromFormation, toFormation} {
+		for t := range f {
+			add(t)
+		}
+	}
+
+	sort.Strings(types)
+
+	processTypes := make([]ProcessType, len(types))
+	for i, t := range types {
+		processTypes[i] = ProcessType(t)
+	}
+
+	return processTypes
+}
+
+// ReleasesDiff compares two versions of an app.
+func (s *releasesService) ReleasesDiff(app *App, from, to int) (*ReleaseDiff, error) {
+	a, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &from})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &to})
+	if err != nil {
+		return nil, err
+	}
+
+	return diffReleases(a, b), nil
+}
@@ -0,0 +1,118 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/pkg/image"
+)
+
+func TestDiffReleases(t *testing.T) {
+	var (
+		secret    = "secret"
+		newSecret = "new-secret"
+		debug     = "1"
+	)
+
+	from := &Release{
+		Version: 41,
+		Config: &Config{
+			Vars: Vars{
+				"SECRET":    &secret,
+				"UNCHANGED": &debug,
+				"REMOVED":   &debug,
+			},
+		},
+		Slug: &Slug{
+			Image: image.Image{Repository: "remind101/acme-inc", Digest: "sha256:aaaa"},
+			ProcessTypes: CommandMap{
+				"web":    "./bin/web",
+				"worker": "./bin/worker",
+			},
+		},
+		Processes: []*Process{
+			{Type: "web", Command: "./bin/web", Quantity: 1, Constraints: Constraints1X},
+			{Type: "worker", Command: "./bin/worker", Quantity: 1, Constraints: Constraints1X},
+		},
+	}
+
+	to := &Release{
+		Version: 42,
+		Config: &Config{
+			Vars: Vars{
+				"SECRET":    &newSecret,
+				"UNCHANGED": &debug,
+				"ADDED":     &debug,
+			},
+		},
+		Slug: &Slug{
+			Image: image.Image{Repository: "remind101/acme-inc", Digest: "sha256:bbbb"},
+			ProcessTypes: CommandMap{
+				"web":   "./bin/web --port 80",
+				"admin": "./bin/admin",
+			},
+		},
+		Processes: []*Process{
+			{Type: "web", Command: "./bin/web --port 80", Quantity: 2, Constraints: Constraints2X},
+			{Type: "admin", Command: "./bin/admin", Quantity: 0, Constraints: Constraints1X},
+		},
+	}
+
+	d := diffReleases(from, to)
+
+	if got, want := d.Image, (&ImageDiff{From: from.Slug.Image, To: to.Slug.Image}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Image => %v; want %v", got, want)
+	}
+
+	expectedVars := []*VarDiff{
+		{Name: "ADDED", Change: ChangeAdded},
+		{Name: "REMOVED", Change: ChangeRemoved},
+		{Name: "SECRET", Change: ChangeChanged},
+	}
+	if got, want := d.Vars, expectedVars; !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars => %v; want %v", got, want)
+	}
+
+	expectedProcesses := []*ProcessDiff{
+		{Type: "admin", Change: ChangeAdded},
+		{
+			Type:        "web",
+			Change:      ChangeChanged,
+			Command:     &CommandDiff{From: "./bin/web", To: "./bin/web --port 80"},
+			Quantity:    &QuantityDiff{From: 1, To: 2},
+			Constraints: &ConstraintsDiff{From: Constraints1X, To: Constraints2X},
+		},
+		{Type: "worker", Change: ChangeRemoved},
+	}
+	if got, want := d.Processes, expectedProcesses; !reflect.DeepEqual(got, want) {
+		t.Errorf("Processes => %v; want %v", got, want)
+	}
+}
+
+func TestDiffReleases_NoChanges(t *testing.T) {
+	r := &Release{
+		Version: 1,
+		Config:  &Config{},
+		Slug: &Slug{
+			Image:        image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+			ProcessTypes: CommandMap{"web": "./bin/web"},
+		},
+		Processes: []*Process{
+			{Type: "web", Command: "./bin/web", Quantity: 1, Constraints: Constraints1X},
+		},
+	}
+
+	d := diffReleases(r, r)
+
+	if d.Image != nil {
+		t.Errorf("Image => %v; want nil", d.Image)
+	}
+
+	if len(d.Vars) != 0 {
+		t.Errorf("Vars => %v; want none", d.Vars)
+	}
+
+	if len(d.Processes) != 0 {
+		t.Errorf("Processes => %v; want none", d.Processes)
+	}
+}
@@ -1,9 +1,15 @@
 package empire
 
 import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/remind101/empire/pkg/headerutil"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
 )
 
 func TestReleasesQuery(t *testing.T) {
@@ -31,3 +37,178 @@ func TestReleasesQuery(t *testing.T) {
 
 	tests.Run(t)
 }
+
+func TestExposedProcessTypes(t *testing.T) {
+	admin := "admin, grpc"
+
+	tests := []struct {
+		config *Config
+		defs   Procfile
+		out    map[ProcessType]bool
+	}{
+		{nil, nil, map[ProcessType]bool{"web": true}},
+		{&Config{}, nil, map[ProcessType]bool{"web": true}},
+		{&Config{Vars: Vars{ExposedProcessesVar: &admin}}, nil, map[ProcessType]bool{"web": true, "admin": true, "grpc": true}},
+		{nil, Procfile{
+			"api":    &ProcessDefinition{Port: 9000},
+			"admin":  &ProcessDefinition{Exposure: ExposePrivate},
+			"worker": &ProcessDefinition{Command: "./bin/worker"},
+		}, map[ProcessType]bool{"web": true, "api": true, "admin": true}},
+	}
+
+	for i, tt := range tests {
+		if got, want := exposedProcessTypes(tt.config, tt.defs), tt.out; !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d exposedProcessTypes() => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestNewServicePorts(t *testing.T) {
+	tests := []struct {
+		process   ProcessType
+		hostPort  int64
+		def       *ProcessDefinition
+		container int64
+	}{
+		{"web", 9000, nil, WebPort},
+		{"admin", 9001, nil, 9001},
+		{"web", 9000, &ProcessDefinition{Port: 5000}, 5000},
+		{"admin", 9001, &ProcessDefinition{Port: 5000}, 5000},
+	}
+
+	for _, tt := range tests {
+		ports := newServicePorts(tt.process, tt.hostPort, tt.def)
+
+		if got, want := *ports[0].Host, tt.hostPort; got != want {
+			t.Errorf("%s: Host => %d; want %d", tt.process, got, want)
+		}
+
+		if got, want := *ports[0].Container, tt.container; got != want {
+			t.Errorf("%s: Container => %d; want %d", tt.process, got, want)
+		}
+	}
+
+	if ports := newServicePorts("worker", 0, nil); len(ports) != 0 {
+		t.Errorf("expected no ports for an unexposed process; got %v", ports)
+	}
+}
+
+func TestRollbackRelease(t *testing.T) {
+	target := &Release{
+		Version: 3,
+		Processes: []*Process{
+			{Type: "web", Quantity: 2, Constraints: Constraints2X},
+		},
+	}
+
+	// The formation is kept by default.
+	r, updates := rollbackRelease(target, "", RollbackOpts{})
+	if got, want := r.Description, "Rollback to v3"; got != want {
+		t.Fatalf("Description => %q; want %q", got, want)
+	}
+	if len(updates) != 0 {
+		t.Fatalf("updates => %v; want none", updates)
+	}
+
+	r, updates = rollbackRelease(target, "automatic", RollbackOpts{RestoreFormation: true})
+	if got, want := r.Description, "Rollback to v3 with its formation (automatic)"; got != want {
+		t.Fatalf("Description => %q; want %q", got, want)
+	}
+
+	expected := []*FormationUpdate{
+		{Process: "web", Quantity: 2, Constraints: &Constraints2X},
+	}
+	if got, want := updates, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("updates => %v; want %v", got, want)
+	}
+}
+
+func TestReleasesService_RunReleasePhase(t *testing.T) {
+	tests := []struct {
+		processTypes CommandMap
+		waitErr      error
+
+		run bool
+		err string
+	}{
+		{CommandMap{"web": "./bin/web"}, nil, false, ""},
+		{CommandMap{"web": "./bin/web", "release": "./bin/migrate"}, nil, true, ""},
+		{CommandMap{"web": "./bin/web", "release": "./bin/migrate"}, &scheduler.ExitError{Code: 1}, true, "release phase: `./bin/migrate` failed: process exited with status 1"},
+	}
+
+	for i, tt := range tests {
+		f := &fakeReleaseScheduler{
+			FakeScheduler: scheduler.NewFakeScheduler(),
+			waitErr:       tt.waitErr,
+		}
+		s := &releasesService{scheduler: f}
+
+		r := &Release{
+			App:    &App{ID: "1234", Name: "acme-inc"},
+			Config: &Config{},
+			Slug:   &Slug{ProcessTypes: tt.processTypes},
+		}
+
+		err := s.runReleasePhase(context.Background(), r)
+
+		if tt.err == "" && err != nil {
+			t.Errorf("#%d: err => %v", i, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("#%d: err => %v; want %s", i, err, tt.err)
+		}
+
+		if got, want := f.run != nil, tt.run; got != want {
+			t.Errorf("#%d: run => %v; want %v", i, got, want)
+		}
+
+		if f.run != nil {
+			if got, want := f.run.Type, "release"; got != want {
+				t.Errorf("#%d: Type => %s; want %s", i, got, want)
+			}
+			if got, want := f.run.Command, "./bin/migrate"; got != want {
+				t.Errorf("#%d: Command => %s; want %s", i, got, want)
+			}
+		}
+	}
+}
+
+func TestReleasesService_RunReleasePhase_NotSupported(t *testing.T) {
+	s := &releasesService{scheduler: &noWaitScheduler{scheduler.NewFakeScheduler()}}
+
+	r := &Release{
+		App:    &App{ID: "1234", Name: "acme-inc"},
+		Config: &Config{},
+		Slug:   &Slug{ProcessTypes: CommandMap{"release": "./bin/migrate"}},
+	}
+
+	err := s.runReleasePhase(context.Background(), r)
+	if err == nil || !strings.Contains(err.Error(), scheduler.ErrWaitNotSupported.Error()) {
+		t.Fatalf("err => %v; want %v", err, scheduler.ErrWaitNotSupported)
+	}
+}
+
+// fakeReleaseScheduler is a scheduler.Scheduler that records the one off
+// process that was run, and returns waitErr from Wait.
+type fakeReleaseScheduler struct {
+	*scheduler.FakeScheduler
+	waitErr error
+	run     *scheduler.Process
+}
+
+func (s *fakeReleaseScheduler) Run(ctx context.Context, app *scheduler.App, p *scheduler.Process, in io.Reader, out io.Writer) (*scheduler.Instance, error) {
+	if out != nil {
+		return nil, errors.New("expected the release phase to run detached")
+	}
+	s.run = p
+	return s.FakeScheduler.Run(ctx, app, p, in, out)
+}
+
+func (s *fakeReleaseScheduler) Wait(ctx context.Context, app string, instanceID string) error {
+	return s.waitErr
+}
+
+// noWaitScheduler is a scheduler.Scheduler that doesn't implement the
+// scheduler.Waiter interface.
+type noWaitScheduler struct {
+	scheduler.Scheduler
+}
@@ -11,12 +11,32 @@ import (
 	"github.com/fsouza/go-dockerclient"
 	"github.com/remind101/empire/pkg/dockerutil"
 	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/registry"
 )
 
 type Resolver interface {
 	Resolve(context.Context, image.Image, io.Writer) (image.Image, error)
 }
 
+// localResolver is an optional interface that a Resolver that pulls images can
+// implement, to resolve an image without pulling it (e.g. when planning a
+// deploy).
+type localResolver interface {
+	// ResolveLocal resolves the image using what's available locally. If
+	// the image isn't available, it's returned as is.
+	ResolveLocal(context.Context, image.Image) (image.Image, error)
+}
+
+// resolveLocal resolves the image with r without pulling it, if r implements
+// the localResolver interface. Otherwise, r doesn't pull images, so it's used
+// as is.
+func resolveLocal(ctx context.Context, r Resolver, img image.Image, out io.Writer) (image.Image, error) {
+	if l, ok := r.(localResolver); ok {
+		return l.ResolveLocal(ctx, img)
+	}
+	return r.Resolve(ctx, img, out)
+}
+
 // fakeResolver is a fake resolver that will just return the provided image.
 type fakeResolver struct{}
 
@@ -25,6 +45,10 @@ func (r *fakeResolver) Resolve(_ context.Context, img image.Image, out io.Writer
 	return img, err
 }
 
+func (r *fakeResolver) ResolveLocal(_ context.Context, img image.Image) (image.Image, error) {
+	return img, nil
+}
+
 // dockerResolver is a resolver that pulls the docker image, then inspects it to
 // get the canonical image id.
 type dockerResolver struct {
@@ -47,10 +71,102 @@ func (r *dockerResolver) Resolve(ctx context.Context, img image.Image, out io.Wr
 		return img, err
 	}
 
-	return image.Image{
+	digests, err := r.repoDigests(i.ID)
+	if err != nil {
+		return img, err
+	}
+
+	return pinnedImage(img, digests), nil
+}
+
+// ResolveLocal resolves the image like Resolve, if it's already been pulled.
+// Images that are pinned to a digest already are returned as is.
+func (r *dockerResolver) ResolveLocal(ctx context.Context, img image.Image) (image.Image, error) {
+	if img.Digest != "" {
+		return img, nil
+	}
+
+	i, err := r.client.InspectImage(img.String())
+	if err == docker.ErrNoSuchImage {
+		return img, nil
+	}
+	if err != nil {
+		return img, err
+	}
+
+	digests, err := r.repoDigests(i.ID)
+	if err != nil {
+		return img, err
+	}
+
+	return pinnedImage(img, digests), nil
+}
+
+// repoDigests returns the repository digests for the image with the given id.
+// The image inspect api doesn't include digests, so we have to find the image
+// in the list of images.
+func (r *dockerResolver) repoDigests(id string) ([]string, error) {
+	images, err := r.client.ListImages(docker.ListImagesOptions{Digests: true})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range images {
+		if i.ID == id {
+			return i.RepoDigests, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// registryResolver is a resolver that resolves the tag of an image to a
+// digest using the Docker Registry API, without pulling the image.
+type registryResolver struct {
+	client *registry.Client
+}
+
+func (r *registryResolver) Resolve(ctx context.Context, img image.Image, out io.Writer) (image.Image, error) {
+	digest, err := r.client.Digest(ctx, img)
+	if err != nil {
+		return img, err
+	}
+
+	resolved := image.Image{
+		Registry:   img.Registry,
 		Repository: img.Repository,
-		Tag:        i.ID,
-	}, nil
+		Digest:     digest,
+	}
+
+	msg := jsonmessage.JSONMessage{Status: fmt.Sprintf("Status: Resolved %s to %s", img, resolved)}
+	if err := json.NewEncoder(out).Encode(&msg); err != nil {
+		return img, err
+	}
+
+	return resolved, nil
+}
+
+// pinnedImage returns a reference to img that won't change when the tag is
+// moved, if the registry provided a digest for the repository. Otherwise (e.g.
+// the image was built locally and never pushed), the requested image is
+// returned as is, since that's the only reference that other hosts can pull.
+func pinnedImage(img image.Image, repoDigests []string) image.Image {
+	for _, d := range repoDigests {
+		digest, err := image.Decode(d)
+		if err != nil {
+			continue
+		}
+
+		if digest.Registry == img.Registry && digest.Repository == img.Repository && digest.Digest != "" {
+			return image.Image{
+				Registry:   img.Registry,
+				Repository: img.Repository,
+				Digest:     digest.Digest,
+			}
+		}
+	}
+
+	return img
 }
 
 // pullImage can pull a docker image from a repo, by its imageID.
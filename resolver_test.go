@@ -0,0 +1,82 @@
+package empire
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/registry"
+	"github.com/remind101/empire/pkg/registry/registrytest"
+	"golang.org/x/net/context"
+)
+
+func TestPinnedImage(t *testing.T) {
+	tests := []struct {
+		img     image.Image
+		digests []string
+		out     image.Image
+	}{
+		// Digest for the repository.
+		{
+			image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+			[]string{"remind101/acme-inc@sha256:c6f40a0ea8ec43ed8e0fc4bc0d4b9f8b7a4ec8c9b31e7a7b6e7e2b4b0f1a7e61"},
+			image.Image{Repository: "remind101/acme-inc", Digest: "sha256:c6f40a0ea8ec43ed8e0fc4bc0d4b9f8b7a4ec8c9b31e7a7b6e7e2b4b0f1a7e61"},
+		},
+
+		// Digest for a private registry.
+		{
+			image.Image{Registry: "quay.io", Repository: "remind101/acme-inc", Tag: "latest"},
+			[]string{
+				"remind101/acme-inc@sha256:aaaa",
+				"quay.io/remind101/acme-inc@sha256:bbbb",
+			},
+			image.Image{Registry: "quay.io", Repository: "remind101/acme-inc", Digest: "sha256:bbbb"},
+		},
+
+		// No digest for the repository, so the requested image is used.
+		{
+			image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+			[]string{"remind101/other@sha256:aaaa"},
+			image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+		},
+		{
+			image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+			nil,
+			image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := pinnedImage(tt.img, tt.digests); got != tt.out {
+			t.Errorf("pinnedImage(%v) => %v; want %v", tt.img, got, tt.out)
+		}
+	}
+}
+
+func TestRegistryResolver(t *testing.T) {
+	s := registrytest.NewServer()
+	defer s.Close()
+
+	digest := s.AddImage("remind101/acme-inc", "latest", registry.ImageConfig{})
+
+	c := registry.NewClient(nil)
+	c.Insecure = true
+	r := &registryResolver{client: c}
+
+	out := new(bytes.Buffer)
+	img := image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Tag: "latest"}
+	got, err := r.Resolve(context.Background(), img, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := image.Image{Registry: s.Host(), Repository: "remind101/acme-inc", Digest: digest}
+	if got != want {
+		t.Fatalf("Resolve() => %v; want %v", got, want)
+	}
+
+	if !strings.Contains(out.String(), "Resolved") {
+		t.Fatalf("expected the resolved digest in the output; got %q", out.String())
+	}
+}
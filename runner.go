@@ -26,10 +26,12 @@ type runnerService struct {
 	scheduler scheduler.Scheduler
 }
 
-func (r *runnerService) Run(ctx context.Context, app *App, opts ProcessRunOpts) error {
+// Run runs a one off process. When the process is run detached, the
+// ProcessState for the started process is returned.
+func (r *runnerService) Run(ctx context.Context, app *App, opts ProcessRunOpts) (*ProcessState, error) {
 	release, err := r.store.ReleasesFirst(ReleasesQuery{App: app})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	a := newServiceApp(release)
@@ -39,5 +41,10 @@ func (r *runnerService) Run(ctx context.Context, app *App, opts ProcessRunOpts)
 		p.Env[k] = v
 	}
 
-	return r.scheduler.Run(ctx, a, p, opts.Input, opts.Output)
+	instance, err := r.scheduler.Run(ctx, a, p, opts.Input, opts.Output)
+	if err != nil || instance == nil {
+		return nil, err
+	}
+
+	return processStateFromInstance(instance), nil
 }
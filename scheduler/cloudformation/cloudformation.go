@@ -1,5 +1,338 @@
 // Package cloudformation implements the Scheduler interface for ECS by using
 // CloudFormation to provision and update resources.
 //
-// TODO: Implement this.
+// Each app is represented by a single CloudFormation stack, which contains the
+// ECS services, task definitions, ELBs and Route53 records for all of the
+// processes within the app. Since the stack is updated as a whole, a failure
+// part way through an update is rolled back by CloudFormation, rather than
+// leaving resources out of sync.
 package cloudformation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+// DefaultPollInterval is the default amount of time to wait between checks
+// on the status of a stack.
+var DefaultPollInterval = 10 * time.Second
+
+// ErrNoProcess is returned when trying to scale a process that isn't in the
+// app's stack.
+var ErrNoProcess = errors.New("cloudformation: process does not exist in the stack")
+
+// StackError is returned when a stack fails to create or update.
+type StackError struct {
+	Stack  string
+	Status string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *StackError) Error() string {
+	return fmt.Sprintf("stack %s failed: %s (%s)", e.Stack, e.Status, e.Reason)
+}
+
+// cloudformationClient duck types the cloudformation.CloudFormation methods
+// that we use.
+type cloudformationClient interface {
+	CreateStack(*cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error)
+	UpdateStack(*cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error)
+	DeleteStack(*cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error)
+	DescribeStacks(*cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error)
+}
+
+var (
+	_ scheduler.Scheduler  = &Scheduler{}
+	_ scheduler.Stabilizer = &Scheduler{}
+	_ scheduler.Waiter     = &Scheduler{}
+	_ scheduler.Planner    = &Scheduler{}
+	_ scheduler.Pruner     = &Scheduler{}
+	_ scheduler.Restarter  = &Scheduler{}
+)
+
+// Scheduler is an implementation of the scheduler.Scheduler interface that
+// manages apps with CloudFormation stacks. Instances are still managed with
+// the ECS API directly, using the wrapped Scheduler.
+//
+// Canaries aren't supported, since they would need to be resources in the
+// app's stack to share its load balancer, and to be removed when the stack is
+// next updated.
+type Scheduler struct {
+	// Template is used to generate the CloudFormation template for an app.
+	Template Template
+
+	// The amount of time to wait between checks on the status of a stack.
+	// The zero value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// The Scheduler used for Instances, Stop and Run. This should be an
+	// ECS scheduler.
+	scheduler.Scheduler
+
+	cloudformation cloudformationClient
+}
+
+// NewScheduler returns a new Scheduler that uses the given template, and
+// delegates instance management to s.
+func NewScheduler(s scheduler.Scheduler, t Template, config *aws.Config) *Scheduler {
+	return &Scheduler{
+		Template:       t,
+		Scheduler:      s,
+		cloudformation: cloudformation.New(config),
+	}
+}
+
+// Submit creates the stack for the app if it doesn't exist, or updates it with
+// a newly generated template, then waits for the stack to finish.
+func (s *Scheduler) Submit(ctx context.Context, app *scheduler.App) error {
+	buf := new(bytes.Buffer)
+	if err := s.Template.Execute(buf, app); err != nil {
+		return err
+	}
+
+	stackName := StackName(app.ID)
+
+	var parameters []*cloudformation.Parameter
+	for _, p := range app.Processes {
+		parameters = append(parameters, &cloudformation.Parameter{
+			ParameterKey:   aws.String(desiredCountParameter(p.Type)),
+			ParameterValue: aws.String(fmt.Sprintf("%d", p.Instances)),
+		})
+	}
+
+	stack, err := s.stack(stackName)
+	if err != nil {
+		return err
+	}
+
+	if stack == nil {
+		if _, err := s.cloudformation.CreateStack(&cloudformation.CreateStackInput{
+			StackName:    aws.String(stackName),
+			TemplateBody: aws.String(buf.String()),
+			Parameters:   parameters,
+			Tags: []*cloudformation.Tag{
+				{Key: aws.String("empire.app.id"), Value: aws.String(app.ID)},
+				{Key: aws.String("empire.app.name"), Value: aws.String(app.Name)},
+			},
+		}); err != nil {
+			return err
+		}
+	} else {
+		if _, err := s.cloudformation.UpdateStack(&cloudformation.UpdateStackInput{
+			StackName:    aws.String(stackName),
+			TemplateBody: aws.String(buf.String()),
+			Parameters:   parameters,
+		}); err != nil {
+			if noUpdates(err) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return s.wait(ctx, stackName)
+}
+
+// Scale updates the DesiredCount parameter for the process, keeping the
+// existing template and all other parameters.
+func (s *Scheduler) Scale(ctx context.Context, app string, ptype string, instances uint) error {
+	stackName := StackName(app)
+
+	stack, err := s.stack(stackName)
+	if err != nil {
+		return err
+	}
+
+	if stack == nil {
+		return ErrNoProcess
+	}
+
+	key := desiredCountParameter(ptype)
+
+	var (
+		parameters []*cloudformation.Parameter
+		found      bool
+	)
+	for _, p := range stack.Parameters {
+		if *p.ParameterKey == key {
+			found = true
+			parameters = append(parameters, &cloudformation.Parameter{
+				ParameterKey:   p.ParameterKey,
+				ParameterValue: aws.String(fmt.Sprintf("%d", instances)),
+			})
+			continue
+		}
+
+		parameters = append(parameters, &cloudformation.Parameter{
+			ParameterKey:     p.ParameterKey,
+			UsePreviousValue: aws.Bool(true),
+		})
+	}
+
+	if !found {
+		return ErrNoProcess
+	}
+
+	if _, err := s.cloudformation.UpdateStack(&cloudformation.UpdateStackInput{
+		StackName:           aws.String(stackName),
+		UsePreviousTemplate: aws.Bool(true),
+		Parameters:          parameters,
+	}); err != nil {
+		if noUpdates(err) {
+			return nil
+		}
+		return err
+	}
+
+	return s.wait(ctx, stackName)
+}
+
+// Remove deletes the stack for the app, which removes all of its resources.
+func (s *Scheduler) Remove(ctx context.Context, app string) error {
+	_, err := s.cloudformation.DeleteStack(&cloudformation.DeleteStackInput{
+		StackName: aws.String(StackName(app)),
+	})
+	return err
+}
+
+// Run runs a one off process using the wrapped Scheduler.
+func (s *Scheduler) Run(ctx context.Context, app *scheduler.App, p *scheduler.Process, in io.Reader, out io.Writer) (*scheduler.Instance, error) {
+	return s.Scheduler.Run(ctx, app, p, in, out)
+}
+
+// Stabilize waits for the ECS services in the stack to stabilize, using the
+// wrapped Scheduler.
+func (s *Scheduler) Stabilize(ctx context.Context, app string, ss scheduler.StatusStream) error {
+	if st, ok := s.Scheduler.(scheduler.Stabilizer); ok {
+		return st.Stabilize(ctx, app, ss)
+	}
+	return nil
+}
+
+// Wait waits for a one off process to exit, using the wrapped Scheduler.
+func (s *Scheduler) Wait(ctx context.Context, app string, instanceID string) error {
+	if w, ok := s.Scheduler.(scheduler.Waiter); ok {
+		return w.Wait(ctx, app, instanceID)
+	}
+	return scheduler.ErrWaitNotSupported
+}
+
+// Plan returns the changes that submitting the app would make, using the
+// wrapped Scheduler. A nil Plan is returned if it doesn't implement the
+// Planner interface.
+func (s *Scheduler) Plan(ctx context.Context, app *scheduler.App) (*scheduler.Plan, error) {
+	if p, ok := s.Scheduler.(scheduler.Planner); ok {
+		return p.Plan(ctx, app)
+	}
+	return nil, nil
+}
+
+// Restart restarts the process type using the wrapped Scheduler, falling back
+// to stopping each instance if it doesn't implement the Restarter interface.
+func (s *Scheduler) Restart(ctx context.Context, app string, process string) error {
+	return scheduler.Restart(ctx, s.Scheduler, app, process)
+}
+
+// Prune removes resources that were created for old releases of the app by
+// the wrapped Scheduler, like the task definitions of one off processes. The
+// stack's own resources are removed by CloudFormation when they're replaced.
+func (s *Scheduler) Prune(ctx context.Context, app string, releases []string) error {
+	if p, ok := s.Scheduler.(scheduler.Pruner); ok {
+		return p.Prune(ctx, app, releases)
+	}
+	return nil
+}
+
+// stack returns the named stack, or nil if it doesn't exist.
+func (s *Scheduler) stack(stackName string) (*cloudformation.Stack, error) {
+	resp, err := s.cloudformation.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		if stackDoesNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(resp.Stacks) == 0 {
+		return nil, nil
+	}
+
+	return resp.Stacks[0], nil
+}
+
+// wait polls the stack until it's no longer in progress, returning a
+// StackError if the create or update failed.
+func (s *Scheduler) wait(ctx context.Context, stackName string) error {
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		stack, err := s.stack(stackName)
+		if err != nil {
+			return err
+		}
+
+		if stack == nil {
+			return fmt.Errorf("stack %s does not exist", stackName)
+		}
+
+		status := *stack.StackStatus
+
+		if !strings.HasSuffix(status, "_IN_PROGRESS") {
+			if failed(status) {
+				return &StackError{
+					Stack:  stackName,
+					Status: status,
+					Reason: aws.StringValue(stack.StackStatusReason),
+				}
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// StackName returns the name of the CloudFormation stack for the app.
+func StackName(appID string) string {
+	return fmt.Sprintf("empire-%s", appID)
+}
+
+// failed returns true if the stack status indicates that the last create or
+// update failed.
+func failed(status string) bool {
+	return strings.HasSuffix(status, "_FAILED") || strings.Contains(status, "ROLLBACK")
+}
+
+func stackDoesNotExist(err error) bool {
+	if err, ok := err.(awserr.Error); ok {
+		return strings.Contains(err.Message(), "does not exist")
+	}
+	return false
+}
+
+func noUpdates(err error) bool {
+	if err, ok := err.(awserr.Error); ok {
+		return err.Message() == "No updates are to be performed."
+	}
+	return false
+}
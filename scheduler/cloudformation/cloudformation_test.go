@@ -0,0 +1,222 @@
+package cloudformation
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+func TestScheduler_Submit_NewStack(t *testing.T) {
+	c := &fakeCloudFormation{
+		statuses: []string{"CREATE_IN_PROGRESS", "CREATE_COMPLETE"},
+	}
+	s := newTestScheduler(c)
+
+	if err := s.Submit(context.Background(), fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.created == nil {
+		t.Fatal("expected the stack to be created")
+	}
+
+	if got, want := *c.created.StackName, "empire-1234"; got != want {
+		t.Fatalf("StackName => %s; want %s", got, want)
+	}
+
+	params := parameterValues(c.created.Parameters)
+	if got, want := params["WebDesiredCount"], "2"; got != want {
+		t.Fatalf("WebDesiredCount => %s; want %s", got, want)
+	}
+	if got, want := params["WorkerDesiredCount"], "1"; got != want {
+		t.Fatalf("WorkerDesiredCount => %s; want %s", got, want)
+	}
+}
+
+func TestScheduler_Submit_ExistingStack(t *testing.T) {
+	c := &fakeCloudFormation{
+		exists:   true,
+		statuses: []string{"UPDATE_COMPLETE", "UPDATE_IN_PROGRESS", "UPDATE_COMPLETE"},
+	}
+	s := newTestScheduler(c)
+
+	if err := s.Submit(context.Background(), fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.updated == nil {
+		t.Fatal("expected the stack to be updated")
+	}
+
+	if *c.updated.TemplateBody == "" {
+		t.Fatal("expected a template body")
+	}
+}
+
+func TestScheduler_Submit_NoUpdates(t *testing.T) {
+	c := &fakeCloudFormation{
+		exists:    true,
+		statuses:  []string{"UPDATE_COMPLETE"},
+		updateErr: awserr.New("ValidationError", "No updates are to be performed.", nil),
+	}
+	s := newTestScheduler(c)
+
+	if err := s.Submit(context.Background(), fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Submit_Failed(t *testing.T) {
+	c := &fakeCloudFormation{
+		exists:   true,
+		statuses: []string{"UPDATE_COMPLETE", "UPDATE_ROLLBACK_IN_PROGRESS", "UPDATE_ROLLBACK_COMPLETE"},
+		reason:   "Resource creation cancelled",
+	}
+	s := newTestScheduler(c)
+
+	err := s.Submit(context.Background(), fakeApp())
+	if err, ok := err.(*StackError); !ok {
+		t.Fatalf("err => %v; want a StackError", err)
+	} else if got, want := err.Status, "UPDATE_ROLLBACK_COMPLETE"; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+}
+
+func TestScheduler_Scale(t *testing.T) {
+	c := &fakeCloudFormation{
+		exists:   true,
+		statuses: []string{"UPDATE_COMPLETE", "UPDATE_COMPLETE"},
+		parameters: []*cloudformation.Parameter{
+			{ParameterKey: aws.String("WebDesiredCount"), ParameterValue: aws.String("2")},
+			{ParameterKey: aws.String("WorkerDesiredCount"), ParameterValue: aws.String("1")},
+		},
+	}
+	s := newTestScheduler(c)
+
+	if err := s.Scale(context.Background(), "1234", "worker", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if !*c.updated.UsePreviousTemplate {
+		t.Fatal("expected the previous template to be used")
+	}
+
+	params := c.updated.Parameters
+	if len(params) != 2 {
+		t.Fatalf("expected 2 parameters, got %d", len(params))
+	}
+
+	if !*params[0].UsePreviousValue {
+		t.Fatal("expected WebDesiredCount to use the previous value")
+	}
+
+	if got, want := *params[1].ParameterValue, "5"; got != want {
+		t.Fatalf("WorkerDesiredCount => %s; want %s", got, want)
+	}
+
+	if err := s.Scale(context.Background(), "1234", "scheduler", 1); err != ErrNoProcess {
+		t.Fatalf("err => %v; want %v", err, ErrNoProcess)
+	}
+}
+
+func TestScheduler_Scale_NoStack(t *testing.T) {
+	s := newTestScheduler(&fakeCloudFormation{})
+
+	if err := s.Scale(context.Background(), "1234", "web", 1); err != ErrNoProcess {
+		t.Fatalf("err => %v; want %v", err, ErrNoProcess)
+	}
+}
+
+func TestScheduler_Remove(t *testing.T) {
+	c := &fakeCloudFormation{exists: true}
+	s := newTestScheduler(c)
+
+	if err := s.Remove(context.Background(), "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := *c.deleted.StackName, "empire-1234"; got != want {
+		t.Fatalf("StackName => %s; want %s", got, want)
+	}
+}
+
+func newTestScheduler(c cloudformationClient) *Scheduler {
+	return &Scheduler{
+		Template:       &EmpireTemplate{Cluster: "cluster"},
+		PollInterval:   1,
+		Scheduler:      scheduler.NewFakeScheduler(),
+		cloudformation: c,
+	}
+}
+
+func parameterValues(params []*cloudformation.Parameter) map[string]string {
+	m := make(map[string]string)
+	for _, p := range params {
+		m[*p.ParameterKey] = *p.ParameterValue
+	}
+	return m
+}
+
+// fakeCloudFormation is a fake implementation of the cloudformationClient
+// interface. Each call to DescribeStacks returns the next status in statuses.
+type fakeCloudFormation struct {
+	exists     bool
+	statuses   []string
+	reason     string
+	parameters []*cloudformation.Parameter
+	updateErr  error
+
+	created *cloudformation.CreateStackInput
+	updated *cloudformation.UpdateStackInput
+	deleted *cloudformation.DeleteStackInput
+}
+
+func (c *fakeCloudFormation) CreateStack(input *cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error) {
+	c.created = input
+	c.exists = true
+	return &cloudformation.CreateStackOutput{}, nil
+}
+
+func (c *fakeCloudFormation) UpdateStack(input *cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error) {
+	c.updated = input
+	return &cloudformation.UpdateStackOutput{}, c.updateErr
+}
+
+func (c *fakeCloudFormation) DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	c.deleted = input
+	return &cloudformation.DeleteStackOutput{}, nil
+}
+
+func (c *fakeCloudFormation) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	if !c.exists {
+		return nil, awserr.New("ValidationError", "Stack with id "+*input.StackName+" does not exist", nil)
+	}
+
+	status := c.statuses[0]
+	if len(c.statuses) > 1 {
+		c.statuses = c.statuses[1:]
+	}
+
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{
+				StackName:         input.StackName,
+				StackStatus:       aws.String(status),
+				StackStatusReason: aws.String(c.reason),
+				Parameters:        c.parameters,
+			},
+		},
+	}, nil
+}
+
+func TestScheduler_CanariesNotSupported(t *testing.T) {
+	s := &Scheduler{Scheduler: scheduler.NewFakeScheduler()}
+
+	if scheduler.CanariesSupported(s) {
+		t.Fatal("Expected canaries to not be supported")
+	}
+}
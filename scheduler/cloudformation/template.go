@@ -0,0 +1,331 @@
+package cloudformation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	shellwords "github.com/mattn/go-shellwords"
+	. "github.com/remind101/empire/pkg/bytesize"
+	"github.com/remind101/empire/scheduler"
+)
+
+// Template represents something that can generate a CloudFormation template
+// for an app. The data passed to Execute is the *scheduler.App. A
+// text/template.Template satisfies this interface.
+//
+// Templates should declare a Number parameter named <Process>DesiredCount for
+// each process, which will be set to the number of instances to run.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Delimiter is used to prefix the names of ECS services and task definitions
+// with the app ID. This matches pkg/ecsutil, so that the ECS scheduler can be
+// used to find the running tasks.
+const Delimiter = "--"
+
+// Tags that are attached to load balancers so that they can be found later.
+const (
+	AppIDTag       = "AppID"
+	ProcessTypeTag = "ProcessType"
+)
+
+// The connection draining timeout to set on load balancers.
+var defaultConnectionDrainingTimeout = 30
+
+// EmpireTemplate is a Template implementation that generates ECS services,
+// task definitions, ELBs and Route53 CNAME records for the processes in an
+// app.
+type EmpireTemplate struct {
+	// The ECS cluster to run services in.
+	Cluster string
+
+	// The IAM role to use for ECS services with ELBs attached.
+	ServiceRole string
+
+	// The ID of the hosted zone to create internal CNAME records in, and the
+	// domain name of the zone (e.g. "empire.").
+	HostedZoneID   string
+	HostedZoneName string
+
+	// The ID of the security group to assign to internal load balancers.
+	InternalSecurityGroupID string
+
+	// The ID of the security group to assign to external load balancers.
+	ExternalSecurityGroupID string
+
+	// The Subnet IDs to assign when creating internal load balancers.
+	InternalSubnetIDs []string
+
+	// The Subnet IDs to assign when creating external load balancers.
+	ExternalSubnetIDs []string
+}
+
+// Execute builds the template for the app, then writes it as JSON.
+func (t *EmpireTemplate) Execute(w io.Writer, data interface{}) error {
+	app, ok := data.(*scheduler.App)
+	if !ok {
+		return fmt.Errorf("cloudformation: expected a *scheduler.App, got %T", data)
+	}
+
+	v, err := t.Build(app)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Build generates the CloudFormation template for the app.
+func (t *EmpireTemplate) Build(app *scheduler.App) (map[string]interface{}, error) {
+	parameters := make(map[string]interface{})
+	resources := make(map[string]interface{})
+	outputs := make(map[string]interface{})
+
+	// Maps logical ids to the process types that they were generated from,
+	// since process types that only differ by punctuation (e.g. web-1 and
+	// web_1) would otherwise share resources.
+	keys := make(map[string]string)
+
+	for _, p := range app.Processes {
+		key := logicalID(p.Type)
+		if key == "" {
+			return nil, fmt.Errorf("cloudformation: process type %q has no alphanumeric characters", p.Type)
+		}
+		if other, ok := keys[key]; ok {
+			return nil, fmt.Errorf("cloudformation: process types %q and %q both have the logical id %s", other, p.Type, key)
+		}
+		keys[key] = p.Type
+
+		taskDefinition, err := t.taskDefinition(app, p)
+		if err != nil {
+			return nil, err
+		}
+
+		parameters[desiredCountParameter(p.Type)] = map[string]interface{}{
+			"Type":    "Number",
+			"Default": "0",
+		}
+		resources[key+"TaskDefinition"] = taskDefinition
+
+		service := map[string]interface{}{
+			"ServiceName":    app.ID + Delimiter + p.Type,
+			"Cluster":        t.Cluster,
+			"DesiredCount":   ref(desiredCountParameter(p.Type)),
+			"TaskDefinition": ref(key + "TaskDefinition"),
+		}
+
+		if p.Exposure > scheduler.ExposeNone && len(p.Ports) > 0 {
+			loadBalancer := key + "LoadBalancer"
+
+			if p.Ports[0].Host == nil {
+				return nil, fmt.Errorf("cloudformation: process %s: a host port is required to attach a load balancer", p.Type)
+			}
+
+			resources[loadBalancer] = t.loadBalancer(app, p)
+			service["Role"] = t.ServiceRole
+			service["LoadBalancers"] = []interface{}{
+				map[string]interface{}{
+					"ContainerName":    p.Type,
+					"ContainerPort":    *p.Ports[0].Container,
+					"LoadBalancerName": ref(loadBalancer),
+				},
+			}
+
+			outputs[loadBalancer] = map[string]interface{}{
+				"Value": getAtt(loadBalancer, "DNSName"),
+			}
+
+			// The web process gets a CNAME of the app name under
+			// the internal zone. Other exposed processes get a
+			// CNAME of <process>.<app>.
+			if t.HostedZoneID != "" {
+				name := app.Name
+				if p.Type != "web" {
+					name = fmt.Sprintf("%s.%s", p.Type, app.Name)
+				}
+
+				resources[key+"CNAME"] = map[string]interface{}{
+					"Type": "AWS::Route53::RecordSet",
+					"Properties": map[string]interface{}{
+						"HostedZoneId":    t.HostedZoneID,
+						"Name":            fmt.Sprintf("%s.%s", name, t.HostedZoneName),
+						"Type":            "CNAME",
+						"TTL":             60,
+						"ResourceRecords": []interface{}{getAtt(loadBalancer, "DNSName")},
+					},
+				}
+			}
+		}
+
+		resources[key+"Service"] = map[string]interface{}{
+			"Type":       "AWS::ECS::Service",
+			"Properties": service,
+		}
+	}
+
+	return map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              fmt.Sprintf("Empire app %s (%s)", app.Name, app.ID),
+		"Parameters":               parameters,
+		"Resources":                resources,
+		"Outputs":                  outputs,
+	}, nil
+}
+
+// taskDefinition returns the AWS::ECS::TaskDefinition resource for the
+// process.
+func (t *EmpireTemplate) taskDefinition(app *scheduler.App, p *scheduler.Process) (map[string]interface{}, error) {
+	command, err := shellwords.Parse(p.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for k := range p.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	environment := []interface{}{}
+	for _, k := range keys {
+		environment = append(environment, map[string]interface{}{
+			"Name":  k,
+			"Value": p.Env[k],
+		})
+	}
+
+	ports := []interface{}{}
+	for _, m := range p.Ports {
+		if m.Container == nil {
+			return nil, fmt.Errorf("cloudformation: process %s: port mapping is missing a container port", p.Type)
+		}
+
+		// Without a host port, ECS assigns one.
+		mapping := map[string]interface{}{
+			"ContainerPort": *m.Container,
+		}
+		if m.Host != nil {
+			mapping["HostPort"] = *m.Host
+		}
+		ports = append(ports, mapping)
+	}
+
+	return map[string]interface{}{
+		"Type": "AWS::ECS::TaskDefinition",
+		"Properties": map[string]interface{}{
+			"Family": app.ID + Delimiter + p.Type,
+			"ContainerDefinitions": []interface{}{
+				map[string]interface{}{
+					"Name":         p.Type,
+					"Image":        p.Image.String(),
+					"Command":      command,
+					"Cpu":          p.CPUShares,
+					"Memory":       p.MemoryLimit / MB,
+					"Essential":    true,
+					"Environment":  environment,
+					"PortMappings": ports,
+				},
+			},
+		},
+	}, nil
+}
+
+// loadBalancer returns the AWS::ElasticLoadBalancing::LoadBalancer resource
+// for the process.
+func (t *EmpireTemplate) loadBalancer(app *scheduler.App, p *scheduler.Process) map[string]interface{} {
+	scheme := "internal"
+	sg := t.InternalSecurityGroupID
+	subnets := t.InternalSubnetIDs
+
+	if p.Exposure == scheduler.ExposePublic {
+		scheme = "internet-facing"
+		sg = t.ExternalSecurityGroupID
+		subnets = t.ExternalSubnetIDs
+	}
+
+	instancePort := *p.Ports[0].Host
+
+	listeners := []interface{}{
+		map[string]interface{}{
+			"LoadBalancerPort": 80,
+			"InstancePort":     instancePort,
+			"Protocol":         "http",
+			"InstanceProtocol": "http",
+		},
+	}
+
+	if p.SSLCert != "" {
+		listeners = append(listeners, map[string]interface{}{
+			"LoadBalancerPort": 443,
+			"InstancePort":     instancePort,
+			"SSLCertificateId": p.SSLCert,
+			"Protocol":         "https",
+			"InstanceProtocol": "http",
+		})
+	}
+
+	properties := map[string]interface{}{
+		"Scheme":         scheme,
+		"SecurityGroups": []string{sg},
+		"Subnets":        subnets,
+		"Listeners":      listeners,
+		"CrossZone":      true,
+		"ConnectionDrainingPolicy": map[string]interface{}{
+			"Enabled": true,
+			"Timeout": defaultConnectionDrainingTimeout,
+		},
+		"Tags": []interface{}{
+			map[string]interface{}{"Key": AppIDTag, "Value": app.ID},
+			map[string]interface{}{"Key": ProcessTypeTag, "Value": p.Type},
+		},
+	}
+
+	if p.HealthCheck != "" {
+		properties["HealthCheck"] = map[string]interface{}{
+			"Target":             fmt.Sprintf("HTTP:%d%s", instancePort, p.HealthCheck),
+			"HealthyThreshold":   "10",
+			"UnhealthyThreshold": "2",
+			"Interval":           "30",
+			"Timeout":            "5",
+		}
+	}
+
+	return map[string]interface{}{
+		"Type":       "AWS::ElasticLoadBalancing::LoadBalancer",
+		"Properties": properties,
+	}
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// logicalID returns a CloudFormation logical id for the process type, which
+// must be alphanumeric. For example, "worker_high" becomes "WorkerHigh".
+func logicalID(ptype string) string {
+	var id string
+	for _, part := range nonAlphanumeric.Split(ptype, -1) {
+		if part == "" {
+			continue
+		}
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// desiredCountParameter returns the name of the stack parameter that controls
+// the number of instances of the process.
+func desiredCountParameter(ptype string) string {
+	return logicalID(ptype) + "DesiredCount"
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"Ref": name}
+}
+
+func getAtt(name, attr string) map[string]interface{} {
+	return map[string]interface{}{"Fn::GetAtt": []string{name, attr}}
+}
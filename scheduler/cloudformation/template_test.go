@@ -0,0 +1,317 @@
+package cloudformation
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/scheduler"
+)
+
+func TestEmpireTemplate(t *testing.T) {
+	tmpl := &EmpireTemplate{
+		Cluster:                 "cluster",
+		ServiceRole:             "ecsServiceRole",
+		HostedZoneID:            "Z3DG6IL3SJCGPX",
+		HostedZoneName:          "empire.",
+		InternalSecurityGroupID: "sg-internal",
+		ExternalSecurityGroupID: "sg-external",
+		InternalSubnetIDs:       []string{"subnet-a"},
+		ExternalSubnetIDs:       []string{"subnet-b"},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got, want interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(expectedTemplate), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("template => %s", buf.String())
+	}
+}
+
+func TestEmpireTemplate_InvalidData(t *testing.T) {
+	tmpl := &EmpireTemplate{}
+
+	if err := tmpl.Execute(new(bytes.Buffer), "acme-inc"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestLogicalID(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"web", "Web"},
+		{"worker_high", "WorkerHigh"},
+		{"worker-high.1", "WorkerHigh1"},
+	}
+
+	for _, tt := range tests {
+		if got := logicalID(tt.in); got != tt.out {
+			t.Errorf("logicalID(%q) => %s; want %s", tt.in, got, tt.out)
+		}
+	}
+}
+
+// fakeApp returns a fake app for testing.
+func fakeApp() *scheduler.App {
+	return &scheduler.App{
+		ID:   "1234",
+		Name: "acme-inc",
+		Processes: []*scheduler.Process{
+			&scheduler.Process{
+				Type:    "web",
+				Image:   image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+				Command: "acme-inc web '--port 80'",
+				Env: map[string]string{
+					"USER": "foo",
+					"PORT": "8080",
+				},
+				MemoryLimit: 134217728, // 128
+				CPUShares:   128,
+				Instances:   2,
+				Exposure:    scheduler.ExposePublic,
+				SSLCert:     "arn:aws:iam::012345678901:server-certificate/AcmeIncDotCom",
+				Ports: []scheduler.PortMap{
+					{Host: aws.Int64(9000), Container: aws.Int64(8080)},
+				},
+			},
+			&scheduler.Process{
+				Type:        "worker",
+				Image:       image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+				Command:     "acme-inc worker",
+				MemoryLimit: 134217728, // 128
+				CPUShares:   128,
+				Instances:   1,
+			},
+		},
+	}
+}
+
+const expectedTemplate = `{
+  "AWSTemplateFormatVersion": "2010-09-09",
+  "Description": "Empire app acme-inc (1234)",
+  "Parameters": {
+    "WebDesiredCount": {"Type": "Number", "Default": "0"},
+    "WorkerDesiredCount": {"Type": "Number", "Default": "0"}
+  },
+  "Resources": {
+    "WebTaskDefinition": {
+      "Type": "AWS::ECS::TaskDefinition",
+      "Properties": {
+        "Family": "1234--web",
+        "ContainerDefinitions": [
+          {
+            "Name": "web",
+            "Image": "remind101/acme-inc:latest",
+            "Command": ["acme-inc", "web", "--port 80"],
+            "Cpu": 128,
+            "Memory": 128,
+            "Essential": true,
+            "Environment": [
+              {"Name": "PORT", "Value": "8080"},
+              {"Name": "USER", "Value": "foo"}
+            ],
+            "PortMappings": [
+              {"HostPort": 9000, "ContainerPort": 8080}
+            ]
+          }
+        ]
+      }
+    },
+    "WebLoadBalancer": {
+      "Type": "AWS::ElasticLoadBalancing::LoadBalancer",
+      "Properties": {
+        "Scheme": "internet-facing",
+        "SecurityGroups": ["sg-external"],
+        "Subnets": ["subnet-b"],
+        "Listeners": [
+          {"LoadBalancerPort": 80, "InstancePort": 9000, "Protocol": "http", "InstanceProtocol": "http"},
+          {"LoadBalancerPort": 443, "InstancePort": 9000, "Protocol": "https", "InstanceProtocol": "http", "SSLCertificateId": "arn:aws:iam::012345678901:server-certificate/AcmeIncDotCom"}
+        ],
+        "CrossZone": true,
+        "ConnectionDrainingPolicy": {"Enabled": true, "Timeout": 30},
+        "Tags": [
+          {"Key": "AppID", "Value": "1234"},
+          {"Key": "ProcessType", "Value": "web"}
+        ]
+      }
+    },
+    "WebCNAME": {
+      "Type": "AWS::Route53::RecordSet",
+      "Properties": {
+        "HostedZoneId": "Z3DG6IL3SJCGPX",
+        "Name": "acme-inc.empire.",
+        "Type": "CNAME",
+        "TTL": 60,
+        "ResourceRecords": [{"Fn::GetAtt": ["WebLoadBalancer", "DNSName"]}]
+      }
+    },
+    "WebService": {
+      "Type": "AWS::ECS::Service",
+      "Properties": {
+        "ServiceName": "1234--web",
+        "Cluster": "cluster",
+        "DesiredCount": {"Ref": "WebDesiredCount"},
+        "TaskDefinition": {"Ref": "WebTaskDefinition"},
+        "Role": "ecsServiceRole",
+        "LoadBalancers": [
+          {"ContainerName": "web", "ContainerPort": 8080, "LoadBalancerName": {"Ref": "WebLoadBalancer"}}
+        ]
+      }
+    },
+    "WorkerTaskDefinition": {
+      "Type": "AWS::ECS::TaskDefinition",
+      "Properties": {
+        "Family": "1234--worker",
+        "ContainerDefinitions": [
+          {
+            "Name": "worker",
+            "Image": "remind101/acme-inc:latest",
+            "Command": ["acme-inc", "worker"],
+            "Cpu": 128,
+            "Memory": 128,
+            "Essential": true,
+            "Environment": [],
+            "PortMappings": []
+          }
+        ]
+      }
+    },
+    "WorkerService": {
+      "Type": "AWS::ECS::Service",
+      "Properties": {
+        "ServiceName": "1234--worker",
+        "Cluster": "cluster",
+        "DesiredCount": {"Ref": "WorkerDesiredCount"},
+        "TaskDefinition": {"Ref": "WorkerTaskDefinition"}
+      }
+    }
+  },
+  "Outputs": {
+    "WebLoadBalancer": {"Value": {"Fn::GetAtt": ["WebLoadBalancer", "DNSName"]}}
+  }
+}`
+
+func TestEmpireTemplate_ProcessCNAME(t *testing.T) {
+	tmpl := &EmpireTemplate{
+		Cluster:        "cluster",
+		HostedZoneID:   "Z3DG6IL3SJCGPX",
+		HostedZoneName: "empire.",
+	}
+
+	app := fakeApp()
+	app.Processes[1] = &scheduler.Process{
+		Type:      "admin",
+		Image:     image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+		Command:   "acme-inc admin",
+		Instances: 1,
+		Exposure:  scheduler.ExposePrivate,
+		Ports: []scheduler.PortMap{
+			{Host: aws.Int64(9001), Container: aws.Int64(9001)},
+		},
+	}
+
+	v, err := tmpl.Build(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources := v["Resources"].(map[string]interface{})
+
+	tests := []struct {
+		resource string
+		name     string
+	}{
+		{"WebCNAME", "acme-inc.empire."},
+		{"AdminCNAME", "admin.acme-inc.empire."},
+	}
+
+	for _, tt := range tests {
+		r, ok := resources[tt.resource].(map[string]interface{})
+		if !ok {
+			t.Fatalf("expected a %s resource", tt.resource)
+		}
+
+		properties := r["Properties"].(map[string]interface{})
+		if got, want := properties["Name"], tt.name; got != want {
+			t.Errorf("%s Name => %v; want %s", tt.resource, got, want)
+		}
+	}
+}
+
+func TestEmpireTemplate_LogicalIDCollision(t *testing.T) {
+	tmpl := &EmpireTemplate{Cluster: "cluster"}
+
+	app := fakeApp()
+	app.Processes = []*scheduler.Process{
+		{Type: "web-1", Command: "acme-inc web"},
+		{Type: "web_1", Command: "acme-inc web"},
+	}
+
+	if _, err := tmpl.Build(app); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	app.Processes = []*scheduler.Process{
+		{Type: "--", Command: "acme-inc web"},
+	}
+
+	if _, err := tmpl.Build(app); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestEmpireTemplate_Ports(t *testing.T) {
+	tmpl := &EmpireTemplate{Cluster: "cluster"}
+
+	app := fakeApp()
+	app.Processes = []*scheduler.Process{
+		{
+			Type:    "web",
+			Command: "acme-inc web",
+			Ports: []scheduler.PortMap{
+				{Container: aws.Int64(8080)},
+			},
+		},
+	}
+
+	// Without a host port, ECS assigns one.
+	v, err := tmpl.Build(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources := v["Resources"].(map[string]interface{})
+	properties := resources["WebTaskDefinition"].(map[string]interface{})["Properties"].(map[string]interface{})
+	container := properties["ContainerDefinitions"].([]interface{})[0].(map[string]interface{})
+	if got, want := container["PortMappings"], []interface{}{map[string]interface{}{"ContainerPort": int64(8080)}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("PortMappings => %v; want %v", got, want)
+	}
+
+	// A load balancer needs a host port to route to.
+	app.Processes[0].Exposure = scheduler.ExposePrivate
+	if _, err := tmpl.Build(app); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// A container port is always required.
+	app.Processes[0].Exposure = scheduler.ExposeNone
+	app.Processes[0].Ports = []scheduler.PortMap{{Host: aws.Int64(8080)}}
+	if _, err := tmpl.Build(app); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -2,5 +2,592 @@
 // This implementation is not recommended for production use, but can be used in
 // development for testing.
 //
-// TODO: Implement this.
+// Each instance of a process is run as a container on a single Docker daemon.
+// Containers are labeled with the app and process type that they belong to,
+// which allows the Scheduler to find them again later.
 package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/fsouza/go-dockerclient"
+	shellwords "github.com/mattn/go-shellwords"
+	"github.com/remind101/empire/pkg/dockerutil"
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/runner"
+	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// Labels that are attached to containers so that we can find them later.
+const (
+	AppIDLabel       = "empire.app.id"
+	AppNameLabel     = "empire.app.name"
+	ProcessTypeLabel = "empire.app.process"
+
+	// ProcessLabel holds the JSON encoded definition of the process, so
+	// that the process can be rebuilt from the container exactly as it
+	// was submitted.
+	ProcessLabel = "empire.app.process.definition"
+
+	// OneOffLabel is set to "true" on the containers for one off
+	// processes started with Run, which are never replaced or removed
+	// when the app is submitted.
+	OneOffLabel = "empire.app.oneoff"
+)
+
+// ErrNoProcess is returned when trying to scale a process that the Scheduler
+// doesn't know about.
+var ErrNoProcess = errors.New("docker: process has not been submitted")
+
+var _ scheduler.Scheduler = &Scheduler{}
+
+// Scheduler is an implementation of the scheduler.Scheduler interface that
+// runs processes as containers against a single Docker daemon.
+type Scheduler struct {
+	docker *dockerutil.Client
+	runner *runner.Runner
+
+	// Holds the last submitted definition of each process, so that we can
+	// create new containers when scaling up.
+	mu        sync.Mutex
+	processes map[string]map[string]*scheduler.Process
+}
+
+// NewScheduler returns a new Scheduler instance backed by the given Docker
+// client.
+func NewScheduler(c *dockerutil.Client) *Scheduler {
+	return &Scheduler{
+		docker:    c,
+		runner:    runner.NewRunner(c),
+		processes: make(map[string]map[string]*scheduler.Process),
+	}
+}
+
+// Submit replaces the containers for each process in the app with new
+// containers. Any process types that are no longer present in the app will
+// have their containers removed.
+func (s *Scheduler) Submit(ctx context.Context, app *scheduler.App) error {
+	existing, err := s.containers(ctx, app.ID, "")
+	if err != nil {
+		return err
+	}
+	existing = withoutOneOffs(existing)
+
+	for _, p := range app.Processes {
+		if err := s.submitProcess(ctx, app, p, existing); err != nil {
+			return err
+		}
+	}
+
+	types := make(map[string]bool)
+	for _, p := range app.Processes {
+		types[p.Type] = true
+	}
+
+	var toRemove []*docker.Container
+	for _, c := range existing {
+		if !types[c.Config.Labels[ProcessTypeLabel]] {
+			toRemove = append(toRemove, c)
+		}
+	}
+
+	return s.removeContainers(ctx, toRemove)
+}
+
+// SubmitCanary replaces the containers for each canary process in the app,
+// without touching the containers for any other processes.
+func (s *Scheduler) SubmitCanary(ctx context.Context, app *scheduler.App) error {
+	existing, err := s.containers(ctx, app.ID, "")
+	if err != nil {
+		return err
+	}
+	existing = withoutOneOffs(existing)
+
+	for _, p := range app.Processes {
+		if err := s.submitProcess(ctx, app, p, existing); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// submitProcess replaces the existing containers for the process with new
+// containers.
+func (s *Scheduler) submitProcess(ctx context.Context, app *scheduler.App, p *scheduler.Process, existing []*docker.Container) error {
+	s.setProcess(app, p)
+
+	if err := s.pull(ctx, p.Image); err != nil {
+		return err
+	}
+
+	// Tear down the old containers for the process before starting the
+	// new ones.
+	if err := s.removeContainers(ctx, filterType(existing, p.Type)); err != nil {
+		return err
+	}
+
+	// Canaries never bind the host port, since it's already bound by the
+	// process that they're a canary of.
+	for i := uint(0); i < p.Instances; i++ {
+		if _, err := s.start(ctx, app, p, i == 0 && p.CanaryOf == ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Scale starts or removes containers until there are the desired number of
+// instances running for the process.
+func (s *Scheduler) Scale(ctx context.Context, app string, ptype string, instances uint) error {
+	containers, err := s.containers(ctx, app, ptype)
+	if err != nil {
+		return err
+	}
+
+	running := uint(len(containers))
+
+	if running > instances {
+		return s.removeContainers(ctx, containers[instances:])
+	}
+
+	if running < instances {
+		a, p, err := s.process(ctx, app, ptype, containers)
+		if err != nil {
+			return err
+		}
+		p.Instances = instances
+
+		for i := running; i < instances; i++ {
+			if _, err := s.start(ctx, a, p, i == 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove removes all of the containers for the app.
+func (s *Scheduler) Remove(ctx context.Context, app string) error {
+	containers, err := s.containers(ctx, app, "")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.processes, app)
+	s.mu.Unlock()
+
+	return s.removeContainers(ctx, containers)
+}
+
+// Instances returns an Instance for each container that belongs to the app.
+func (s *Scheduler) Instances(ctx context.Context, app string) ([]*scheduler.Instance, error) {
+	var instances []*scheduler.Instance
+
+	containers, err := s.containers(ctx, app, "")
+	if err != nil {
+		return instances, err
+	}
+
+	for _, c := range containers {
+		instances = append(instances, &scheduler.Instance{
+			Process:   containerToProcess(c),
+			ID:        shortID(c.ID),
+			State:     state(c.State),
+			UpdatedAt: timex.Now(),
+		})
+	}
+
+	return instances, nil
+}
+
+// Stop removes the container, then starts a new container in its place.
+func (s *Scheduler) Stop(ctx context.Context, instanceID string) error {
+	c, err := s.docker.InspectContainer(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.removeContainers(ctx, []*docker.Container{c}); err != nil {
+		return err
+	}
+
+	app, ptype := c.Config.Labels[AppIDLabel], c.Config.Labels[ProcessTypeLabel]
+
+	// One off processes don't get replaced.
+	if isOneOff(c) {
+		return nil
+	}
+
+	containers, err := s.containers(ctx, app, ptype)
+	if err != nil {
+		return err
+	}
+
+	a, p, err := s.process(ctx, app, ptype, []*docker.Container{c})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.start(ctx, a, p, len(containers) == 0)
+	return err
+}
+
+// Restart replaces the containers for the process one at a time.
+func (s *Scheduler) Restart(ctx context.Context, app string, ptype string) error {
+	containers, err := s.containers(ctx, app, ptype)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if err := s.Stop(ctx, c.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run runs a one off process. If an output stream is provided, the container
+// will be attached to. Otherwise, the container is started in the background.
+func (s *Scheduler) Run(ctx context.Context, app *scheduler.App, p *scheduler.Process, in io.Reader, out io.Writer) (*scheduler.Instance, error) {
+	if out != nil {
+		return nil, s.runner.Run(ctx, runner.RunOpts{
+			Image:   p.Image,
+			Command: p.Command,
+			Env:     p.Env,
+			Input:   in,
+			Output:  out,
+		})
+	}
+
+	if err := s.pull(ctx, p.Image); err != nil {
+		return nil, err
+	}
+
+	opts, err := createContainerOptions(app, p, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.Config.Labels[OneOffLabel] = "true"
+
+	c, err := s.startContainer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Instance{
+		Process:   p,
+		ID:        shortID(c.ID),
+		State:     "pending",
+		UpdatedAt: timex.Now(),
+	}, nil
+}
+
+// Wait waits for the container for a one off process to exit.
+func (s *Scheduler) Wait(ctx context.Context, app string, instanceID string) error {
+	code, err := s.docker.WaitContainer(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return &scheduler.ExitError{Code: code}
+	}
+
+	return nil
+}
+
+// start creates and starts a new container for the process. If bindHost is
+// true, the host ports for the process will be bound to the container ports.
+// Otherwise, Docker will choose a random host port.
+func (s *Scheduler) start(ctx context.Context, app *scheduler.App, p *scheduler.Process, bindHost bool) (*docker.Container, error) {
+	opts, err := createContainerOptions(app, p, bindHost)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startContainer(ctx, opts)
+}
+
+// startContainer creates and starts a new container.
+func (s *Scheduler) startContainer(ctx context.Context, opts docker.CreateContainerOptions) (*docker.Container, error) {
+	c, err := s.docker.CreateContainer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, s.docker.StartContainer(ctx, c.ID, opts.HostConfig)
+}
+
+// pull pulls the image for the process.
+func (s *Scheduler) pull(ctx context.Context, img image.Image) error {
+	return s.docker.PullImage(ctx, docker.PullImageOptions{
+		Registry:     img.Registry,
+		Repository:   img.Repository,
+		Tag:          img.Tag,
+		OutputStream: ioutil.Discard,
+	})
+}
+
+// containers returns the containers that belong to the app. If ptype is
+// provided, only containers for that process type are returned.
+func (s *Scheduler) containers(ctx context.Context, app, ptype string) ([]*docker.Container, error) {
+	labels := []string{fmt.Sprintf("%s=%s", AppIDLabel, app)}
+	if ptype != "" {
+		labels = append(labels, fmt.Sprintf("%s=%s", ProcessTypeLabel, ptype))
+	}
+
+	list, err := s.docker.ListContainers(ctx, docker.ListContainersOptions{
+		All: true,
+		Filters: map[string][]string{
+			"label": labels,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []*docker.Container
+	for _, c := range list {
+		container, err := s.docker.InspectContainer(ctx, c.ID)
+		if err != nil {
+			return containers, err
+		}
+
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+// removeContainers stops and removes the given containers.
+func (s *Scheduler) removeContainers(ctx context.Context, containers []*docker.Container) error {
+	for _, c := range containers {
+		if err := s.docker.RemoveContainer(ctx, docker.RemoveContainerOptions{
+			ID:            c.ID,
+			RemoveVolumes: true,
+			Force:         true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// process returns the last submitted definition of the process. If Empire was
+// restarted since the process was submitted, the definition is rebuilt from
+// one of the existing containers.
+func (s *Scheduler) process(ctx context.Context, app, ptype string, containers []*docker.Container) (*scheduler.App, *scheduler.Process, error) {
+	s.mu.Lock()
+	p, ok := s.processes[app][ptype]
+	s.mu.Unlock()
+
+	if ok {
+		return &scheduler.App{ID: app, Name: p.Env["EMPIRE_APPNAME"]}, p, nil
+	}
+
+	if len(containers) == 0 {
+		return nil, nil, ErrNoProcess
+	}
+
+	c := containers[0]
+	return &scheduler.App{ID: app, Name: c.Config.Labels[AppNameLabel]}, containerToProcess(c), nil
+}
+
+func (s *Scheduler) setProcess(app *scheduler.App, p *scheduler.Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.processes[app.ID] == nil {
+		s.processes[app.ID] = make(map[string]*scheduler.Process)
+	}
+
+	s.processes[app.ID][p.Type] = p
+}
+
+// createContainerOptions returns the docker.CreateContainerOptions to run an
+// instance of the process.
+func createContainerOptions(app *scheduler.App, p *scheduler.Process, bindHost bool) (docker.CreateContainerOptions, error) {
+	cmd, err := shellwords.Parse(p.Command)
+	if err != nil {
+		return docker.CreateContainerOptions{}, err
+	}
+
+	var env []string
+	for k, v := range p.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	exposed := make(map[docker.Port]struct{})
+	bindings := make(map[docker.Port][]docker.PortBinding)
+	for _, m := range p.Ports {
+		if m.Container == nil {
+			continue
+		}
+
+		port := docker.Port(fmt.Sprintf("%d/tcp", *m.Container))
+		exposed[port] = struct{}{}
+
+		var binding docker.PortBinding
+		if bindHost && m.Host != nil {
+			binding.HostPort = strconv.FormatInt(*m.Host, 10)
+		}
+		bindings[port] = []docker.PortBinding{binding}
+	}
+
+	definition, err := json.Marshal(newProcessDefinition(p))
+	if err != nil {
+		return docker.CreateContainerOptions{}, err
+	}
+
+	return docker.CreateContainerOptions{
+		Name: fmt.Sprintf("%s.%s.%s", app.Name, p.Type, uuid.New()),
+		Config: &docker.Config{
+			Image:        p.Image.String(),
+			Cmd:          cmd,
+			Env:          env,
+			ExposedPorts: exposed,
+			Memory:       int64(p.MemoryLimit),
+			CPUShares:    int64(p.CPUShares),
+			Labels: map[string]string{
+				AppIDLabel:       app.ID,
+				AppNameLabel:     app.Name,
+				ProcessTypeLabel: p.Type,
+				ProcessLabel:     string(definition),
+			},
+		},
+		HostConfig: &docker.HostConfig{
+			PortBindings: bindings,
+			Memory:       int64(p.MemoryLimit),
+			CPUShares:    int64(p.CPUShares),
+		},
+	}, nil
+}
+
+// processDefinition is the part of a scheduler.Process that's stored in the
+// ProcessLabel of its containers. Everything else can be read from the
+// container's config.
+type processDefinition struct {
+	Command      string
+	Ports        []scheduler.PortMap
+	Exposure     scheduler.Exposure
+	LoadBalancer string
+	SSLCert      string
+	HealthCheck  string
+	CanaryOf     string
+}
+
+func newProcessDefinition(p *scheduler.Process) *processDefinition {
+	return &processDefinition{
+		Command:      p.Command,
+		Ports:        p.Ports,
+		Exposure:     p.Exposure,
+		LoadBalancer: p.LoadBalancer,
+		SSLCert:      p.SSLCert,
+		HealthCheck:  p.HealthCheck,
+		CanaryOf:     p.CanaryOf,
+	}
+}
+
+// containerToProcess converts a container back into a scheduler.Process.
+// Containers that were created without the ProcessLabel only have the
+// process type, command, environment and limits.
+func containerToProcess(c *docker.Container) *scheduler.Process {
+	env := make(map[string]string)
+	for _, kv := range c.Config.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	p := &scheduler.Process{
+		Type:        c.Config.Labels[ProcessTypeLabel],
+		Command:     strings.Join(c.Config.Cmd, " "),
+		Env:         env,
+		MemoryLimit: uint(c.Config.Memory),
+		CPUShares:   uint(c.Config.CPUShares),
+	}
+
+	if img, err := image.Decode(c.Config.Image); err == nil {
+		p.Image = img
+	}
+
+	var d processDefinition
+	if err := json.Unmarshal([]byte(c.Config.Labels[ProcessLabel]), &d); err == nil {
+		p.Command = d.Command
+		p.Ports = d.Ports
+		p.Exposure = d.Exposure
+		p.LoadBalancer = d.LoadBalancer
+		p.SSLCert = d.SSLCert
+		p.HealthCheck = d.HealthCheck
+		p.CanaryOf = d.CanaryOf
+	}
+
+	return p
+}
+
+// isOneOff returns true if the container is for a one off process. Containers
+// that were created before the OneOffLabel was added are identified by their
+// process type.
+func isOneOff(c *docker.Container) bool {
+	return c.Config.Labels[OneOffLabel] == "true" || c.Config.Labels[ProcessTypeLabel] == "run"
+}
+
+// withoutOneOffs returns the containers that aren't for one off processes.
+func withoutOneOffs(containers []*docker.Container) []*docker.Container {
+	var filtered []*docker.Container
+	for _, c := range containers {
+		if !isOneOff(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// filterType returns the containers for the given process type.
+func filterType(containers []*docker.Container, ptype string) []*docker.Container {
+	var filtered []*docker.Container
+	for _, c := range containers {
+		if c.Config.Labels[ProcessTypeLabel] == ptype {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// state maps a containers state to a scheduler state.
+func state(s docker.State) string {
+	switch {
+	case s.Running:
+		return "running"
+	case s.StartedAt.IsZero():
+		return "pending"
+	default:
+		return "stopped"
+	}
+}
+
+// shortID truncates the container id like the docker cli does.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
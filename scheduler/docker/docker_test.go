@@ -0,0 +1,302 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/remind101/empire/pkg/dockerutil"
+	"github.com/remind101/empire/pkg/httpmock"
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+func TestScheduler_Submit(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[]`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /images/create",
+		200, ``,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/create",
+		200, `{ "Id": "abc" }`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/abc/start",
+		204, ``,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	if err := s.Submit(context.Background(), fakeApp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Submit_RemoveOldProcesses(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[{ "Id": "def" }]`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/def/json",
+		200, `{ "Id": "def", "Config": { "Labels": { "empire.app.id": "1234", "empire.app.process": "worker" } } }`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /images/create",
+		200, ``,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/create",
+		200, `{ "Id": "abc" }`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/abc/start",
+		204, ``,
+	)).Add(httpmock.PathHandler(t,
+		"DELETE /containers/def",
+		204, ``,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	if err := s.Submit(context.Background(), fakeApp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Submit_KeepOneOffs(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[{ "Id": "def" }]`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/def/json",
+		200, `{ "Id": "def", "Config": { "Labels": { "empire.app.id": "1234", "empire.app.process": "release", "empire.app.oneoff": "true" } } }`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /images/create",
+		200, ``,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/create",
+		200, `{ "Id": "abc" }`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/abc/start",
+		204, ``,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	if err := s.Submit(context.Background(), fakeApp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Scale(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[{ "Id": "abc" }, { "Id": "def" }]`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/abc/json",
+		200, `{ "Id": "abc", "Config": { "Labels": { "empire.app.id": "1234", "empire.app.process": "web" } } }`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/def/json",
+		200, `{ "Id": "def", "Config": { "Labels": { "empire.app.id": "1234", "empire.app.process": "web" } } }`,
+	)).Add(httpmock.PathHandler(t,
+		"DELETE /containers/def",
+		204, ``,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	if err := s.Scale(context.Background(), "1234", "web", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Scale_NotSubmitted(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[]`,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	if err := s.Scale(context.Background(), "1234", "web", 1); err != ErrNoProcess {
+		t.Fatalf("err => %v; want %v", err, ErrNoProcess)
+	}
+}
+
+func TestScheduler_Restart(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[{ "Id": "abc" }]`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/abc/json",
+		200, `{ "Id": "abc", "Config": { "Image": "remind101/acme-inc:latest", "Labels": { "empire.app.id": "1234", "empire.app.process": "web" } } }`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/abc/json",
+		200, `{ "Id": "abc", "Config": { "Image": "remind101/acme-inc:latest", "Labels": { "empire.app.id": "1234", "empire.app.process": "web" } } }`,
+	)).Add(httpmock.PathHandler(t,
+		"DELETE /containers/abc",
+		204, ``,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[]`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/create",
+		200, `{ "Id": "def" }`,
+	)).Add(httpmock.PathHandler(t,
+		"POST /containers/def/start",
+		204, ``,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	if err := s.Restart(context.Background(), "1234", "web"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Instances(t *testing.T) {
+	api := httpmock.NewServeReplay(t).Add(httpmock.PathHandler(t,
+		"GET /containers/json",
+		200, `[{ "Id": "4fa6e0f0c6786287e131c3852c58a2e01cc697a68231826813597e4994f1d6e2" }]`,
+	)).Add(httpmock.PathHandler(t,
+		"GET /containers/4fa6e0f0c6786287e131c3852c58a2e01cc697a68231826813597e4994f1d6e2/json",
+		200, `{
+			"Id": "4fa6e0f0c6786287e131c3852c58a2e01cc697a68231826813597e4994f1d6e2",
+			"Config": {
+				"Image": "remind101/acme-inc:latest",
+				"Cmd": ["acme-inc", "web"],
+				"Env": ["EMPIRE_RELEASE=v1"],
+				"Memory": 134217728,
+				"CpuShares": 128,
+				"Labels": { "empire.app.id": "1234", "empire.app.process": "web" }
+			},
+			"State": { "Running": true }
+		}`,
+	))
+
+	s, srv := newTestScheduler(t, api)
+	defer srv.Close()
+
+	instances, err := s.Instances(context.Background(), "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 1 {
+		t.Fatal("expected 1 instance")
+	}
+
+	i := instances[0]
+
+	if got, want := i.ID, "4fa6e0f0c678"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if got, want := i.State, "running"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+
+	if got, want := i.Process.Type, "web"; got != want {
+		t.Fatalf("Type => %s; want %s", got, want)
+	}
+
+	if got, want := i.Process.Command, "acme-inc web"; got != want {
+		t.Fatalf("Command => %s; want %s", got, want)
+	}
+
+	if got, want := i.Process.Env["EMPIRE_RELEASE"], "v1"; got != want {
+		t.Fatalf("Env[EMPIRE_RELEASE] => %s; want %s", got, want)
+	}
+}
+
+func TestCreateContainerOptions(t *testing.T) {
+	opts, err := createContainerOptions(fakeApp, fakeApp.Processes[0], true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := opts.Config.Labels[ProcessTypeLabel], "web"; got != want {
+		t.Fatalf("Labels[%s] => %s; want %s", ProcessTypeLabel, got, want)
+	}
+
+	if got, want := len(opts.Config.Cmd), 3; got != want {
+		t.Fatalf("len(Cmd) => %d; want %d", got, want)
+	}
+
+	if got, want := opts.HostConfig.PortBindings["8080/tcp"][0].HostPort, "9000"; got != want {
+		t.Fatalf("HostPort => %s; want %s", got, want)
+	}
+
+	opts, err = createContainerOptions(fakeApp, fakeApp.Processes[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := opts.HostConfig.PortBindings["8080/tcp"][0].HostPort, ""; got != want {
+		t.Fatalf("HostPort => %s; want %s", got, want)
+	}
+}
+
+func TestContainerToProcess(t *testing.T) {
+	p := fakeApp.Processes[0]
+
+	opts, err := createContainerOptions(fakeApp, p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := containerToProcess(&docker.Container{Config: opts.Config})
+
+	if got, want := got.Command, p.Command; got != want {
+		t.Fatalf("Command => %s; want %s", got, want)
+	}
+
+	if got, want := got.Ports, p.Ports; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Ports => %v; want %v", got, want)
+	}
+
+	if got, want := got.Env, p.Env; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Env => %v; want %v", got, want)
+	}
+}
+
+// fake app for testing.
+var fakeApp = &scheduler.App{
+	ID:   "1234",
+	Name: "acme-inc",
+	Processes: []*scheduler.Process{
+		&scheduler.Process{
+			Type:    "web",
+			Image:   image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+			Command: "acme-inc web '--port 80'",
+			Env: map[string]string{
+				"USER": "foo",
+			},
+			MemoryLimit: 134217728, // 128
+			CPUShares:   128,
+			Instances:   1,
+			Ports: []scheduler.PortMap{
+				{Host: aws.Int64(9000), Container: aws.Int64(8080)},
+			},
+		},
+	},
+}
+
+func newTestScheduler(t *testing.T, fakeDockerAPI http.Handler) (*Scheduler, *httptest.Server) {
+	s := httptest.NewServer(fakeDockerAPI)
+
+	c, err := dockerutil.NewClient(nil, s.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewScheduler(c), s
+}
@@ -6,7 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -23,6 +27,18 @@ import (
 
 var DefaultDelimiter = "-"
 
+// DefaultPollInterval is the default amount of time to wait between checks on
+// the status of services when waiting for them to stabilize.
+var DefaultPollInterval = 10 * time.Second
+
+// DefaultMaxFailures is the default number of failures (tasks that had to be
+// replaced or instances that failed ELB health checks) that a service can
+// have in Stabilize before it's considered unhealthy.
+var DefaultMaxFailures = 3
+
+// startedTasksPattern matches service events for tasks that were started.
+var startedTasksPattern = regexp.MustCompile(`has started (\d+) tasks`)
+
 // ProcessManager is a lower level interface than Scheduler, that provides direct
 // control over individual processes.
 type ProcessManager interface {
@@ -44,6 +60,15 @@ type ProcessManager interface {
 type Scheduler struct {
 	ProcessManager
 
+	// The amount of time to wait between checks on the status of services
+	// in Stabilize. The zero value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// The number of failures that a service can have in Stabilize before
+	// an UnhealthyError is returned. The zero value is
+	// DefaultMaxFailures.
+	MaxFailures int
+
 	cluster string
 	ecs     *ecsutil.Client
 }
@@ -206,6 +231,114 @@ func (m *Scheduler) Submit(ctx context.Context, app *scheduler.App) error {
 	return nil
 }
 
+// Plan implements the scheduler.Planner interface. It compares the processes in
+// the app with the ECS services that currently exist for it, using the same
+// rules as Submit, without making any changes.
+func (m *Scheduler) Plan(ctx context.Context, app *scheduler.App) (*scheduler.Plan, error) {
+	processes, err := m.Processes(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*scheduler.Process)
+	for _, p := range processes {
+		existing[p.Type] = p
+	}
+
+	plan := new(scheduler.Plan)
+
+	for _, p := range app.Processes {
+		pp := planProcess(existing[p.Type], p)
+
+		if lp, ok := m.ProcessManager.(loadBalancerPlanner); ok {
+			if err := lp.planLoadBalancer(ctx, app, p, pp); err != nil {
+				return nil, err
+			}
+		}
+
+		plan.Processes = append(plan.Processes, pp)
+	}
+
+	toRemove := diffProcessTypes(processes, app.Processes)
+	sort.Strings(toRemove)
+	for _, t := range toRemove {
+		plan.Processes = append(plan.Processes, &scheduler.ProcessPlan{
+			Type:   t,
+			Action: scheduler.ActionRemove,
+		})
+	}
+
+	return plan, nil
+}
+
+// planProcess returns the changes that would be made to the existing
+// process, which is nil if there isn't one.
+func planProcess(existing, p *scheduler.Process) *scheduler.ProcessPlan {
+	if existing == nil {
+		return &scheduler.ProcessPlan{
+			Type:   p.Type,
+			Action: scheduler.ActionCreate,
+		}
+	}
+
+	pp := &scheduler.ProcessPlan{
+		Type:   p.Type,
+		Action: scheduler.ActionUpdate,
+		Env:    diffEnv(existing.Env, p.Env),
+	}
+
+	if existing.Command != p.Command {
+		pp.Command = &scheduler.CommandChange{From: existing.Command, To: p.Command}
+	}
+
+	return pp
+}
+
+// diffEnv returns the names of the environment variables that changed,
+// sorted by name.
+func diffEnv(old, new map[string]string) []*scheduler.EnvChange {
+	var names []string
+	for k := range old {
+		names = append(names, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []*scheduler.EnvChange
+	for _, name := range names {
+		a, inOld := old[name]
+		b, inNew := new[name]
+
+		switch {
+		case !inOld:
+			changes = append(changes, &scheduler.EnvChange{Name: name, Change: scheduler.EnvAdded})
+		case !inNew:
+			changes = append(changes, &scheduler.EnvChange{Name: name, Change: scheduler.EnvRemoved})
+		case a != b:
+			changes = append(changes, &scheduler.EnvChange{Name: name, Change: scheduler.EnvChanged})
+		}
+	}
+
+	return changes
+}
+
+// SubmitCanary creates or updates the ECS services for the canary processes,
+// leaving the app's other services untouched. The canary services are removed
+// by the next call to Submit, since their process types won't be present.
+func (m *Scheduler) SubmitCanary(ctx context.Context, app *scheduler.App) error {
+	for _, p := range app.Processes {
+		if err := m.CreateProcess(ctx, app, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Remove removes any ECS services that belong to this app.
 func (m *Scheduler) Remove(ctx context.Context, appID string) error {
 	processes, err := m.Processes(ctx, appID)
@@ -288,6 +421,378 @@ func (m *Scheduler) Stop(ctx context.Context, instanceID string) error {
 	return err
 }
 
+// Wait polls the task for a one off process until it has stopped, then
+// returns an error if the container exited with a non-zero exit code.
+func (m *Scheduler) Wait(ctx context.Context, appID string, instanceID string) error {
+	interval := m.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		resp, err := m.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(m.cluster),
+			Tasks:   []*string{aws.String(instanceID)},
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(resp.Failures) > 0 {
+			return fmt.Errorf("unable to describe task: %s", safeString(resp.Failures[0].Reason))
+		}
+
+		if len(resp.Tasks) == 0 {
+			return fmt.Errorf("task %s not found", instanceID)
+		}
+
+		if t := resp.Tasks[0]; safeString(t.LastStatus) == "STOPPED" {
+			return taskExitError(t)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// taskExitError returns an ExitError if any of the containers in the stopped
+// task exited with a non-zero exit code, or never ran.
+func taskExitError(t *ecs.Task) error {
+	for _, c := range t.Containers {
+		if c.ExitCode == nil {
+			return &scheduler.ExitError{Code: -1, Reason: safeString(c.Reason)}
+		}
+
+		if code := int(*c.ExitCode); code != 0 {
+			return &scheduler.ExitError{Code: code, Reason: safeString(c.Reason)}
+		}
+	}
+
+	return nil
+}
+
+// Stabilize waits for the ECS services for the app to reach a steady state,
+// where each service has a single deployment that is running the desired
+// number of tasks. New service events (tasks starting and stopping, instances
+// registering with or failing ELB health checks, etc) and changes in task
+// counts are published to ss while waiting.
+//
+// If the tasks for a service keep getting replaced, or keep failing ELB health
+// checks, a scheduler.UnhealthyError is returned.
+func (m *Scheduler) Stabilize(ctx context.Context, appID string, ss scheduler.StatusStream) error {
+	interval := m.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	maxFailures := m.MaxFailures
+	if maxFailures == 0 {
+		maxFailures = DefaultMaxFailures
+	}
+
+	since := timex.Now()
+	seen := make(map[string]bool)
+	counts := make(map[string]string)
+	health := make(map[string]*serviceHealth)
+
+	for {
+		services, err := m.describeAppServices(ctx, appID)
+		if err != nil {
+			return err
+		}
+
+		stable := true
+		for _, s := range services {
+			name := strings.TrimPrefix(safeString(s.ServiceName), appID+ecsutil.DefaultDelimiter)
+
+			h := health[name]
+			if h == nil {
+				h = new(serviceHealth)
+				health[name] = h
+			}
+
+			// Events are returned newest first.
+			for i := len(s.Events) - 1; i >= 0; i-- {
+				e := s.Events[i]
+				if e.Id == nil || seen[*e.Id] {
+					continue
+				}
+				seen[*e.Id] = true
+
+				if e.CreatedAt != nil && e.CreatedAt.Before(since) {
+					continue
+				}
+
+				h.observe(safeString(e.Message))
+
+				if err := ss.Publish(scheduler.Status{Message: safeString(e.Message)}); err != nil {
+					return err
+				}
+			}
+
+			if err := h.check(name, s, maxFailures); err != nil {
+				return err
+			}
+
+			status := serviceStatus(s)
+			if counts[name] != status {
+				counts[name] = status
+				if err := ss.Publish(scheduler.Status{Message: fmt.Sprintf("%s: %s", name, status)}); err != nil {
+					return err
+				}
+			}
+
+			if !serviceStable(s) {
+				stable = false
+			}
+		}
+
+		if stable {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// describeAppServices returns the ECS services for the app.
+func (m *Scheduler) describeAppServices(ctx context.Context, appID string) ([]*ecs.Service, error) {
+	list, err := m.ecs.ListAppServices(ctx, appID, &ecs.ListServicesInput{
+		Cluster: aws.String(m.cluster),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list.ServiceArns) == 0 {
+		return []*ecs.Service{}, nil
+	}
+
+	desc, err := m.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(m.cluster),
+		Services: list.ServiceArns,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return desc.Services, nil
+}
+
+// serviceStatus returns a human readable summary of the tasks for the primary
+// deployment of the service.
+func serviceStatus(s *ecs.Service) string {
+	d := primaryDeployment(s)
+	if d == nil {
+		return "no primary deployment"
+	}
+
+	status := fmt.Sprintf("%d/%d running, %d pending", safeInt64(d.RunningCount), safeInt64(d.DesiredCount), safeInt64(d.PendingCount))
+	if n := len(s.Deployments) - 1; n > 0 {
+		status += fmt.Sprintf(", %d old deployment(s) draining", n)
+	}
+
+	return status
+}
+
+// serviceHealth tracks failures for a service from its events while
+// stabilizing.
+type serviceHealth struct {
+	// The number of tasks that were started.
+	started int
+
+	// The number of times that an instance failed ELB health checks.
+	unhealthy int
+
+	// The most recent ELB health check failure.
+	lastUnhealthy string
+}
+
+// observe records the service event.
+func (h *serviceHealth) observe(message string) {
+	if m := startedTasksPattern.FindStringSubmatch(message); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		h.started += n
+	}
+
+	if strings.Contains(message, "is unhealthy in") {
+		h.unhealthy++
+		h.lastUnhealthy = message
+	}
+}
+
+// check returns a scheduler.UnhealthyError if the service has had at least max
+// failures. Tasks that were started beyond the desired count of the primary
+// deployment are assumed to have replaced tasks that failed.
+func (h *serviceHealth) check(name string, s *ecs.Service, max int) error {
+	var replaced int
+	if d := primaryDeployment(s); d != nil {
+		replaced = h.started - int(safeInt64(d.DesiredCount))
+	}
+
+	if replaced < 0 {
+		replaced = 0
+	}
+
+	if replaced+h.unhealthy < max {
+		return nil
+	}
+
+	reason := fmt.Sprintf("%d tasks were replaced, %d failed health checks", replaced, h.unhealthy)
+	if h.lastUnhealthy != "" {
+		reason += fmt.Sprintf(" (%s)", h.lastUnhealthy)
+	}
+
+	return &scheduler.UnhealthyError{Process: name, Reason: reason}
+}
+
+// serviceStable returns true if the service only has the primary deployment,
+// and that deployment is running the desired number of tasks.
+func serviceStable(s *ecs.Service) bool {
+	if len(s.Deployments) != 1 {
+		return false
+	}
+
+	d := primaryDeployment(s)
+	if d == nil {
+		return false
+	}
+
+	return safeInt64(d.RunningCount) == safeInt64(d.DesiredCount) && safeInt64(d.PendingCount) == 0
+}
+
+// primaryDeployment returns the PRIMARY deployment for the service, which is
+// the deployment for the most recent task definition.
+func primaryDeployment(s *ecs.Service) *ecs.Deployment {
+	for _, d := range s.Deployments {
+		if safeString(d.Status) == "PRIMARY" {
+			return d
+		}
+	}
+	return nil
+}
+
+// Prune deregisters the task definition revisions that were registered for
+// the given releases of the app, as long as they aren't used by any of the
+// app's services or running tasks. The release of a revision is read from the
+// EMPIRE_RELEASE environment variable of its containers.
+func (m *Scheduler) Prune(ctx context.Context, appID string, releases []string) error {
+	if len(releases) == 0 {
+		return nil
+	}
+
+	pruned := make(map[string]bool)
+	for _, r := range releases {
+		pruned[r] = true
+	}
+
+	inUse := make(map[string]bool)
+
+	services, err := m.describeAppServices(ctx, appID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range services {
+		for _, d := range s.Deployments {
+			inUse[safeString(d.TaskDefinition)] = true
+		}
+	}
+
+	tasks, err := m.describeAppTasks(ctx, appID)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		inUse[safeString(t.TaskDefinitionArn)] = true
+	}
+
+	resp, err := m.ecs.ListAppTaskDefinitions(ctx, appID)
+	if err != nil {
+		return err
+	}
+
+	for _, arn := range resp.TaskDefinitionArns {
+		if inUse[*arn] {
+			continue
+		}
+
+		td, err := m.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: arn,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !pruned[taskDefinitionRelease(td.TaskDefinition)] {
+			continue
+		}
+
+		if _, err := m.ecs.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{
+			TaskDefinition: arn,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// taskDefinitionRelease returns the release that the task definition was
+// registered for, from the EMPIRE_RELEASE environment variable of its
+// containers.
+func taskDefinitionRelease(td *ecs.TaskDefinition) string {
+	if td == nil {
+		return ""
+	}
+
+	for _, c := range td.ContainerDefinitions {
+		for _, kv := range c.Environment {
+			if safeString(kv.Name) == "EMPIRE_RELEASE" {
+				return safeString(kv.Value)
+			}
+		}
+	}
+
+	return ""
+}
+
+// Restart performs a rolling restart of the ECS service for the process, by
+// registering a new revision of the current task definition and updating the
+// service to use it. ECS then replaces the running tasks, respecting the
+// minimum healthy percent of the service.
+func (m *Scheduler) Restart(ctx context.Context, appID string, process string) error {
+	resp, err := m.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(appID + ecsutil.DefaultDelimiter + process),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.ecs.RegisterAppTaskDefinition(ctx, appID, &ecs.RegisterTaskDefinitionInput{
+		Family:               aws.String(process),
+		ContainerDefinitions: resp.TaskDefinition.ContainerDefinitions,
+		Volumes:              resp.TaskDefinition.Volumes,
+	}); err != nil {
+		return err
+	}
+
+	_, err = m.ecs.UpdateAppService(ctx, appID, &ecs.UpdateServiceInput{
+		Cluster:        aws.String(m.cluster),
+		Service:        aws.String(process),
+		TaskDefinition: aws.String(process),
+	})
+	return err
+}
+
 var _ ProcessManager = &ecsProcessManager{}
 
 // ecsProcessManager is an implementation of the ProcessManager interface that
@@ -308,17 +813,51 @@ func (m *ecsProcessManager) CreateProcess(ctx context.Context, app *scheduler.Ap
 	return err
 }
 
-func (m *ecsProcessManager) Run(ctx context.Context, app *scheduler.App, process *scheduler.Process, in io.Reader, out io.Writer) error {
-	attachment := "detached"
+// Run registers a task definition for the process, then runs it as a one off
+// ECS task. Only detached processes are supported, since ECS provides no way
+// to attach to the task's stdin and stdout.
+func (m *ecsProcessManager) Run(ctx context.Context, app *scheduler.App, process *scheduler.Process, in io.Reader, out io.Writer) (*scheduler.Instance, error) {
 	if out != nil {
-		attachment = "attached"
+		// TODO(ejholmes): It would be nice if we can eventually remove
+		// the "runner" package and have both attached and detached
+		// processes run via ECS.
+		return nil, errors.New("running an attached process is not implemented by the ECS manager.")
+	}
+
+	if _, err := m.createTaskDefinition(ctx, app, process); err != nil {
+		return nil, err
 	}
-	// TODO(ejholmes): Actually implement this. We could have the ECS
-	// manager handle the lifecycle of "detached" processes which don't have
-	// their stdin, stdout and stderr attached. It would be nice if we can
-	// eventually remove the "runner" package and have both attached and
-	// detached processes run via ECS.
-	return fmt.Errorf("running a %s process is not implemented by the ECS manager.", attachment)
+
+	resp, err := m.ecs.RunAppTask(ctx, app.ID, &ecs.RunTaskInput{
+		Cluster:        aws.String(m.cluster),
+		Count:          aws.Int64(1),
+		TaskDefinition: aws.String(process.Type),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Failures) > 0 {
+		return nil, fmt.Errorf("unable to run task: %s", safeString(resp.Failures[0].Reason))
+	}
+
+	if len(resp.Tasks) == 0 {
+		return nil, errors.New("no task was started")
+	}
+
+	t := resp.Tasks[0]
+
+	id, err := arn.ResourceID(*t.TaskArn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Instance{
+		Process:   process,
+		State:     safeString(t.LastStatus),
+		ID:        id,
+		UpdatedAt: timex.Now(),
+	}, nil
 }
 
 // createTaskDefinition creates a Task Definition in ECS for the service.
@@ -515,6 +1054,14 @@ func safeString(s *string) string {
 	return *s
 }
 
+func safeInt64(i *int64) int64 {
+	if i == nil {
+		return 0
+	}
+
+	return *i
+}
+
 func noService(err error) bool {
 	if err, ok := err.(awserr.Error); ok {
 		if err.Message() == "Service was not ACTIVE." {
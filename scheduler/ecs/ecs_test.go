@@ -1,6 +1,7 @@
 package ecs
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -10,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/remind101/empire/pkg/awsutil"
 	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/pkg/lb"
 	"github.com/remind101/empire/scheduler"
 	"golang.org/x/net/context"
 )
@@ -132,15 +134,27 @@ func TestScheduler_Instances(t *testing.T) {
 			},
 		},
 
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTasks",
+				Body:       `{"cluster":"empire","startedBy":"1234"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskArns":["arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"]}`,
+			},
+		},
+
 		awsutil.Cycle{
 			Request: awsutil.Request{
 				RequestURI: "/",
 				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
-				Body:       `{"cluster":"empire","tasks":["arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
+				Body:       `{"cluster":"empire","tasks":["arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"]}`,
 			},
 			Response: awsutil.Response{
 				StatusCode: 200,
-				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","taskDefinitionArn":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web","lastStatus":"RUNNING"}]}`,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","taskDefinitionArn":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web","lastStatus":"RUNNING"},{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55","taskDefinitionArn":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--run","lastStatus":"PENDING"}]}`,
 			},
 		},
 
@@ -155,6 +169,18 @@ func TestScheduler_Instances(t *testing.T) {
 				Body:       `{"taskDefinition":{"containerDefinitions":[{"name":"web","cpu":256,"memory":256,"command":["acme-inc", "web", "--port 80"]}]}}`,
 			},
 		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTaskDefinition",
+				Body:       `{"taskDefinition":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--run"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinition":{"containerDefinitions":[{"name":"run","cpu":256,"memory":256,"command":["rake", "db:migrate"]}]}}`,
+			},
+		},
 	})
 	m, s := newTestScheduler(h)
 	defer s.Close()
@@ -164,8 +190,8 @@ func TestScheduler_Instances(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if len(instances) != 1 {
-		t.Fatal("expected 1 instance")
+	if len(instances) != 2 {
+		t.Fatal("expected 2 instances")
 	}
 
 	i := instances[0]
@@ -181,6 +207,474 @@ func TestScheduler_Instances(t *testing.T) {
 	if got, want := i.Process.Type, "web"; got != want {
 		t.Fatalf("Type => %s; want %s", got, want)
 	}
+
+	i = instances[1]
+
+	if got, want := i.ID, "c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if got, want := i.Process.Type, "run"; got != want {
+		t.Fatalf("Type => %s; want %s", got, want)
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.RegisterTaskDefinition",
+				Body:       `{"containerDefinitions":[{"cpu":128,"command":["rake","db:migrate"],"environment":[{"name":"USER","value":"foo"}],"essential":true,"image":"remind101/acme-inc:latest","memory":128,"name":"run"}],"family":"1234--run"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       "",
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.RunTask",
+				Body:       `{"cluster":"empire","count":1,"startedBy":"1234","taskDefinition":"1234--run"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55","lastStatus":"PENDING"}]}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	defer s.Close()
+
+	p := &scheduler.Process{
+		Type:    "run",
+		Image:   image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+		Command: "rake db:migrate",
+		Env: map[string]string{
+			"USER": "foo",
+		},
+		MemoryLimit: 134217728, // 128
+		CPUShares:   128,
+	}
+
+	instance, err := m.Run(context.Background(), fakeApp, p, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := instance.ID, "c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if got, want := instance.State, "PENDING"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+}
+
+func TestScheduler_Run_Attached(t *testing.T) {
+	m, s := newTestScheduler(awsutil.NewHandler(nil))
+	defer s.Close()
+
+	if _, err := m.Run(context.Background(), fakeApp, &scheduler.Process{Type: "run"}, nil, new(bytes.Buffer)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestScheduler_Stabilize(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeServices",
+				Body:       `{"cluster":"empire","services":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"services":[{"serviceName":"1234--web","deployments":[{"status":"PRIMARY","desiredCount":2,"runningCount":1,"pendingCount":1},{"status":"ACTIVE","desiredCount":2,"runningCount":2,"pendingCount":0}],"events":[{"id":"2","createdAt":4102444800,"message":"(service 1234--web) has started 1 tasks: (task abcd)."},{"id":"1","createdAt":1443657600,"message":"(service 1234--web) has reached a steady state."}]}]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeServices",
+				Body:       `{"cluster":"empire","services":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"services":[{"serviceName":"1234--web","deployments":[{"status":"PRIMARY","desiredCount":2,"runningCount":2,"pendingCount":0}],"events":[{"id":"2","createdAt":4102444800,"message":"(service 1234--web) has started 1 tasks: (task abcd)."}]}]}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	m.PollInterval = 1
+	defer s.Close()
+
+	var messages []string
+	ss := scheduler.StatusStreamFunc(func(status scheduler.Status) error {
+		messages = append(messages, status.Message)
+		return nil
+	})
+
+	if err := m.Stabilize(context.Background(), "1234", ss); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"(service 1234--web) has started 1 tasks: (task abcd).",
+		"web: 1/2 running, 1 pending, 1 old deployment(s) draining",
+		"web: 2/2 running, 0 pending",
+	}
+
+	if got, want := messages, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("messages => %v; want %v", got, want)
+	}
+}
+
+func TestScheduler_Stabilize_Timeout(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeServices",
+				Body:       `{"cluster":"empire","services":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"services":[{"serviceName":"1234--web","deployments":[{"status":"PRIMARY","desiredCount":2,"runningCount":0,"pendingCount":2}]}]}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ss := scheduler.StatusStreamFunc(func(status scheduler.Status) error {
+		return nil
+	})
+
+	if err := m.Stabilize(ctx, "1234", ss); err != context.Canceled {
+		t.Fatalf("err => %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestScheduler_Stabilize_Unhealthy(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeServices",
+				Body:       `{"cluster":"empire","services":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"services":[{"serviceName":"1234--web","deployments":[{"status":"PRIMARY","desiredCount":1,"runningCount":0,"pendingCount":1},{"status":"ACTIVE","desiredCount":1,"runningCount":1,"pendingCount":0}],"events":[{"id":"2","createdAt":4102444800,"message":"(service 1234--web) has started 1 tasks: (task abcd)."}]}]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeServices",
+				Body:       `{"cluster":"empire","services":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"services":[{"serviceName":"1234--web","deployments":[{"status":"PRIMARY","desiredCount":1,"runningCount":0,"pendingCount":1},{"status":"ACTIVE","desiredCount":1,"runningCount":1,"pendingCount":0}],"events":[{"id":"4","createdAt":4102444802,"message":"(service 1234--web) has started 1 tasks: (task ghij)."},{"id":"3","createdAt":4102444801,"message":"(service 1234--web) (instance i-1234) (port 9000) is unhealthy in (elb lb-web) due to (reason Instance has failed at least the UnhealthyThreshold number of health checks consecutively.)"},{"id":"2","createdAt":4102444800,"message":"(service 1234--web) has started 1 tasks: (task abcd)."}]}]}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	m.PollInterval = 1
+	m.MaxFailures = 2
+	defer s.Close()
+
+	ss := scheduler.StatusStreamFunc(func(status scheduler.Status) error {
+		return nil
+	})
+
+	err := m.Stabilize(context.Background(), "1234", ss)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	uerr, ok := err.(*scheduler.UnhealthyError)
+	if !ok {
+		t.Fatalf("err => %v; want an UnhealthyError", err)
+	}
+
+	if got, want := uerr.Process, "web"; got != want {
+		t.Fatalf("Process => %s; want %s", got, want)
+	}
+
+	if got, want := uerr.Reason, "1 tasks were replaced, 1 failed health checks ((service 1234--web) (instance i-1234) (port 9000) is unhealthy in (elb lb-web) due to (reason Instance has failed at least the UnhealthyThreshold number of health checks consecutively.))"; got != want {
+		t.Fatalf("Reason => %s; want %s", got, want)
+	}
+}
+
+func TestScheduler_Prune(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeServices",
+				Body:       `{"cluster":"empire","services":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"services":[{"serviceName":"1234--web","deployments":[{"status":"PRIMARY","taskDefinition":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:3"},{"status":"ACTIVE","taskDefinition":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:2"}]}]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListServices",
+				Body:       `{"cluster":"empire"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"serviceArns":["arn:aws:ecs:us-east-1:249285743859:service/1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTasks",
+				Body:       `{"cluster":"empire","serviceName":"1234--web"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskArns":[]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTasks",
+				Body:       `{"cluster":"empire","startedBy":"1234"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskArns":["arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
+				Body:       `{"cluster":"empire","tasks":["arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/c9b6e1a9-1b41-4a4d-9e8b-8d0d6a1c6b55","taskDefinitionArn":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--run:1","lastStatus":"RUNNING"}]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTaskDefinitionFamilies",
+				Body:       `{"familyPrefix":"1234--"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"families":["1234--run","1234--web"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTaskDefinitions",
+				Body:       `{"familyPrefix":"1234--run","status":"ACTIVE"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinitionArns":["arn:aws:ecs:us-east-1:249285743859:task-definition/1234--run:1"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.ListTaskDefinitions",
+				Body:       `{"familyPrefix":"1234--web","status":"ACTIVE"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinitionArns":["arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:1","arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:2","arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:3","arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:4"]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTaskDefinition",
+				Body:       `{"taskDefinition":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:1"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinition":{"containerDefinitions":[{"name":"web","environment":[{"name":"EMPIRE_RELEASE","value":"v1"}]}]}}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DeregisterTaskDefinition",
+				Body:       `{"taskDefinition":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:1"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinition":{}}`,
+			},
+		},
+
+		// A release that's retained, so the revision is kept.
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTaskDefinition",
+				Body:       `{"taskDefinition":"arn:aws:ecs:us-east-1:249285743859:task-definition/1234--web:4"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinition":{"containerDefinitions":[{"name":"web","environment":[{"name":"EMPIRE_RELEASE","value":"v4"}]}]}}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	defer s.Close()
+
+	if err := m.Prune(context.Background(), "1234", []string{"v1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduler_Restart(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTaskDefinition",
+				Body:       `{"taskDefinition":"1234--web"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinition":{"family":"1234--web","containerDefinitions":[{"cpu":128,"command":["acme-inc", "web"],"essential":true,"image":"remind101/acme-inc:latest","memory":128,"name":"web"}]}}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.RegisterTaskDefinition",
+				Body:       `{"containerDefinitions":[{"cpu":128,"command":["acme-inc","web"],"essential":true,"image":"remind101/acme-inc:latest","memory":128,"name":"web"}],"family":"1234--web"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       "",
+			},
+		},
+
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.UpdateService",
+				Body:       `{"cluster":"empire","service":"1234--web","taskDefinition":"1234--web"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"service": {}}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	defer s.Close()
+
+	if err := m.Restart(context.Background(), "1234", "web"); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestScheduler_Remove(t *testing.T) {
@@ -417,6 +911,76 @@ func TestDiffProcessTypes(t *testing.T) {
 	}
 }
 
+func TestScheduler_Plan(t *testing.T) {
+	pm := &fakeProcessManager{
+		processes: []*scheduler.Process{
+			{Type: "web", Command: "acme-inc web", Env: map[string]string{"USER": "foo", "OLD": "1"}},
+			{Type: "worker", Command: "acme-inc worker"},
+		},
+	}
+	l := &fakeLBManager{
+		existing: []*lb.LoadBalancer{
+			{Name: "lb-web", External: true, InstancePort: 9000, Tags: map[string]string{"AppID": "1234", "ProcessType": "web"}},
+		},
+	}
+	m := &Scheduler{
+		ProcessManager: &LBProcessManager{ProcessManager: pm, lb: l},
+	}
+
+	plan, err := m.Plan(context.Background(), &scheduler.App{
+		ID:   "1234",
+		Name: "acme-inc",
+		Processes: []*scheduler.Process{
+			{
+				Type:     "web",
+				Command:  "acme-inc server",
+				Env:      map[string]string{"USER": "bar", "NEW": "1"},
+				Exposure: scheduler.ExposePrivate,
+				Ports:    []scheduler.PortMap{{Host: aws.Int64(9000), Container: aws.Int64(8080)}},
+			},
+			{
+				Type:     "admin",
+				Command:  "acme-inc admin",
+				Exposure: scheduler.ExposePrivate,
+				Ports:    []scheduler.PortMap{{Host: aws.Int64(9001), Container: aws.Int64(9001)}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &scheduler.Plan{
+		Processes: []*scheduler.ProcessPlan{
+			{
+				Type:    "web",
+				Action:  scheduler.ActionUpdate,
+				Command: &scheduler.CommandChange{From: "acme-inc web", To: "acme-inc server"},
+				Env: []*scheduler.EnvChange{
+					{Name: "NEW", Change: scheduler.EnvAdded},
+					{Name: "OLD", Change: scheduler.EnvRemoved},
+					{Name: "USER", Change: scheduler.EnvChanged},
+				},
+				LoadBalancer: "use existing load balancer lb-web",
+				Errors:       []string{"Process web is private, but load balancer is public."},
+			},
+			{
+				Type:         "admin",
+				Action:       scheduler.ActionCreate,
+				LoadBalancer: "create private load balancer",
+			},
+			{
+				Type:   "worker",
+				Action: scheduler.ActionRemove,
+			},
+		},
+	}
+
+	if got, want := plan, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Plan => %#v; want %#v", got, want)
+	}
+}
+
 // fake app for testing.
 var fakeApp = &scheduler.App{
 	ID: "1234",
@@ -438,6 +1002,64 @@ var fakeApp = &scheduler.App{
 	},
 }
 
+func TestScheduler_Wait(t *testing.T) {
+	describe := awsutil.Request{
+		RequestURI: "/",
+		Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
+		Body:       `{"cluster":"empire","tasks":["ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
+	}
+
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: describe,
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"RUNNING","containers":[{"name":"release"}]}]}`,
+			},
+		},
+
+		awsutil.Cycle{
+			Request: describe,
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"STOPPED","containers":[{"name":"release","exitCode":1}]}]}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	m.PollInterval = 1
+	defer s.Close()
+
+	err := m.Wait(context.Background(), "1234", "ae69bb4c-3903-4844-82fe-548ac5b74570")
+	if err, ok := err.(*scheduler.ExitError); !ok {
+		t.Fatalf("err => %v; want an ExitError", err)
+	} else if got, want := err.Code, 1; got != want {
+		t.Fatalf("Code => %d; want %d", got, want)
+	}
+}
+
+func TestScheduler_Wait_Success(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
+				Body:       `{"cluster":"empire","tasks":["ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"STOPPED","containers":[{"name":"release","exitCode":0}]}]}`,
+			},
+		},
+	})
+	m, s := newTestScheduler(h)
+	defer s.Close()
+
+	if err := m.Wait(context.Background(), "1234", "ae69bb4c-3903-4844-82fe-548ac5b74570"); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func newTestScheduler(h http.Handler) (*Scheduler, *httptest.Server) {
 	s := httptest.NewServer(h)
 
@@ -8,6 +8,10 @@ import (
 	"golang.org/x/net/context"
 )
 
+// WebProcessType is the process type that gets a CNAME record matching the app
+// name.
+const WebProcessType = "web"
+
 // LBProcessManager is an implementation of the ProcessManager interface that creates
 // LoadBalancers when a Process is created.
 type LBProcessManager struct {
@@ -24,6 +28,25 @@ type LBProcessManager struct {
 // * Create the load balancer
 // * Attach it to the process.
 func (m *LBProcessManager) CreateProcess(ctx context.Context, app *scheduler.App, p *scheduler.Process) error {
+	// Canaries are attached to the load balancer of the process that
+	// they're a canary of.
+	if p.CanaryOf != "" {
+		if p.Exposure > scheduler.ExposeNone {
+			l, err := m.findLoadBalancer(ctx, app.ID, p.CanaryOf)
+			if err != nil {
+				return err
+			}
+
+			if l == nil {
+				return fmt.Errorf("no load balancer found for the %s process", p.CanaryOf)
+			}
+
+			p.LoadBalancer = l.Name
+		}
+
+		return m.ProcessManager.CreateProcess(ctx, app, p)
+	}
+
 	if p.Exposure > scheduler.ExposeNone {
 		// Attempt to find an existing load balancer for this app.
 		l, err := m.findLoadBalancer(ctx, app.ID, p.Type)
@@ -47,10 +70,17 @@ func (m *LBProcessManager) CreateProcess(ctx context.Context, app *scheduler.App
 			// Add "App" tag so that a CNAME can be created.
 			tags[lb.AppTag] = app.Name
 
+			// The web process gets a CNAME of the app name. Any other
+			// exposed processes are namespaced under the app.
+			if p.Type != WebProcessType {
+				tags[lb.CNAMETag] = fmt.Sprintf("%s.%s", p.Type, app.Name)
+			}
+
 			l, err = m.lb.CreateLoadBalancer(ctx, lb.CreateLoadBalancerOpts{
 				InstancePort: *p.Ports[0].Host, // TODO: Check that the process has ports.
 				External:     p.Exposure == scheduler.ExposePublic,
 				SSLCert:      p.SSLCert,
+				HealthCheck:  p.HealthCheck,
 				Tags:         tags,
 			})
 			if err != nil {
@@ -66,6 +96,51 @@ func (m *LBProcessManager) CreateProcess(ctx context.Context, app *scheduler.App
 	return m.ProcessManager.CreateProcess(ctx, app, p)
 }
 
+// loadBalancerPlanner is implemented by ProcessManagers that manage load
+// balancers, so that Plan can describe what would happen to them.
+type loadBalancerPlanner interface {
+	planLoadBalancer(ctx context.Context, app *scheduler.App, p *scheduler.Process, pp *scheduler.ProcessPlan) error
+}
+
+// planLoadBalancer describes what CreateProcess would do with the load
+// balancer for the process, adding any problems with an existing load
+// balancer (see lbOk) to the plan's errors.
+func (m *LBProcessManager) planLoadBalancer(ctx context.Context, app *scheduler.App, p *scheduler.Process, pp *scheduler.ProcessPlan) error {
+	if p.Exposure <= scheduler.ExposeNone {
+		return nil
+	}
+
+	process := p.Type
+	if p.CanaryOf != "" {
+		process = p.CanaryOf
+	}
+
+	l, err := m.findLoadBalancer(ctx, app.ID, process)
+	if err != nil {
+		return err
+	}
+
+	if l == nil {
+		if p.CanaryOf != "" {
+			pp.Errors = append(pp.Errors, fmt.Sprintf("no load balancer found for the %s process", p.CanaryOf))
+			return nil
+		}
+
+		pp.LoadBalancer = fmt.Sprintf("create %s load balancer", p.Exposure)
+		return nil
+	}
+
+	pp.LoadBalancer = fmt.Sprintf("use existing load balancer %s", l.Name)
+
+	if p.CanaryOf == "" {
+		if err := lbOk(p, l); err != nil {
+			pp.Errors = append(pp.Errors, err.Error())
+		}
+	}
+
+	return nil
+}
+
 // RemoveProcess removes the process then removes the associated LoadBalancer.
 func (m *LBProcessManager) RemoveProcess(ctx context.Context, app string, p string) error {
 	if err := m.ProcessManager.RemoveProcess(ctx, app, p); err != nil {
@@ -131,7 +206,7 @@ type LoadBalancerPortMismatchError struct {
 }
 
 func (e *LoadBalancerPortMismatchError) Error() string {
-	return fmt.Sprintf("Process %s instance port is %d, but load balancer instance port is %d.", e.proc.Type, e.proc.Ports[0].Host, e.lb.InstancePort)
+	return fmt.Sprintf("Process %s instance port is %d, but load balancer instance port is %d.", e.proc.Type, *e.proc.Ports[0].Host, e.lb.InstancePort)
 }
 
 // SslCertMismatchError is returned when the ssl cert in the data store does not match the ssl cert on the ELB
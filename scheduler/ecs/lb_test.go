@@ -0,0 +1,154 @@
+package ecs
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/remind101/empire/pkg/lb"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+func TestLBProcessManager_CreateProcess(t *testing.T) {
+	tests := []struct {
+		process string
+		cname   string
+	}{
+		{"web", ""},
+		{"admin", "admin.acme-inc"},
+	}
+
+	for _, tt := range tests {
+		l := new(fakeLBManager)
+		m := &LBProcessManager{
+			ProcessManager: new(fakeProcessManager),
+			lb:             l,
+		}
+
+		p := &scheduler.Process{
+			Type:        tt.process,
+			Exposure:    scheduler.ExposePrivate,
+			HealthCheck: "/health",
+			Ports: []scheduler.PortMap{
+				{Host: aws.Int64(9000), Container: aws.Int64(8080)},
+			},
+		}
+
+		if err := m.CreateProcess(context.Background(), &scheduler.App{ID: "1234", Name: "acme-inc"}, p); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := l.created.Tags[lb.AppTag], "acme-inc"; got != want {
+			t.Errorf("%s: App => %s; want %s", tt.process, got, want)
+		}
+
+		if got, want := l.created.Tags[lb.CNAMETag], tt.cname; got != want {
+			t.Errorf("%s: CNAME => %s; want %s", tt.process, got, want)
+		}
+
+		if got, want := l.created.Tags["ProcessType"], tt.process; got != want {
+			t.Errorf("%s: ProcessType => %s; want %s", tt.process, got, want)
+		}
+
+		if got, want := l.created.HealthCheck, "/health"; got != want {
+			t.Errorf("%s: HealthCheck => %s; want %s", tt.process, got, want)
+		}
+
+		if got, want := p.LoadBalancer, "lb-"+tt.process; got != want {
+			t.Errorf("%s: LoadBalancer => %s; want %s", tt.process, got, want)
+		}
+	}
+}
+
+func TestLBProcessManager_CreateProcess_Canary(t *testing.T) {
+	l := &fakeLBManager{
+		existing: []*lb.LoadBalancer{
+			{Name: "lb-web", InstancePort: 9000, Tags: map[string]string{"AppID": "1234", "ProcessType": "web"}},
+		},
+	}
+	m := &LBProcessManager{
+		ProcessManager: new(fakeProcessManager),
+		lb:             l,
+	}
+
+	p := &scheduler.Process{
+		Type:     "web-canary",
+		CanaryOf: "web",
+		Exposure: scheduler.ExposePrivate,
+		Ports: []scheduler.PortMap{
+			{Host: aws.Int64(9000), Container: aws.Int64(8080)},
+		},
+	}
+
+	if err := m.CreateProcess(context.Background(), &scheduler.App{ID: "1234", Name: "acme-inc"}, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if l.created.Tags != nil {
+		t.Fatal("expected no load balancer to be created for the canary")
+	}
+
+	if got, want := p.LoadBalancer, "lb-web"; got != want {
+		t.Fatalf("LoadBalancer => %s; want %s", got, want)
+	}
+
+	// The process that the canary is for must already have a load
+	// balancer.
+	p = &scheduler.Process{
+		Type:     "admin-canary",
+		CanaryOf: "admin",
+		Exposure: scheduler.ExposePrivate,
+		Ports: []scheduler.PortMap{
+			{Host: aws.Int64(9001), Container: aws.Int64(9001)},
+		},
+	}
+
+	if err := m.CreateProcess(context.Background(), &scheduler.App{ID: "1234", Name: "acme-inc"}, p); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// fakeLBManager is a fake implementation of the lb.Manager interface that
+// records the load balancer that was created.
+type fakeLBManager struct {
+	created  lb.CreateLoadBalancerOpts
+	existing []*lb.LoadBalancer
+}
+
+func (m *fakeLBManager) CreateLoadBalancer(ctx context.Context, o lb.CreateLoadBalancerOpts) (*lb.LoadBalancer, error) {
+	m.created = o
+	return &lb.LoadBalancer{
+		Name:         "lb-" + o.Tags["ProcessType"],
+		InstancePort: o.InstancePort,
+		Tags:         o.Tags,
+	}, nil
+}
+
+func (m *fakeLBManager) DestroyLoadBalancer(ctx context.Context, l *lb.LoadBalancer) error {
+	return nil
+}
+
+func (m *fakeLBManager) LoadBalancers(ctx context.Context, tags map[string]string) ([]*lb.LoadBalancer, error) {
+	var lbs []*lb.LoadBalancer
+	for _, l := range m.existing {
+		if l.Tags["AppID"] == tags["AppID"] && l.Tags["ProcessType"] == tags["ProcessType"] {
+			lbs = append(lbs, l)
+		}
+	}
+	return lbs, nil
+}
+
+// fakeProcessManager is a ProcessManager that does nothing, except return
+// the processes that it was given.
+type fakeProcessManager struct {
+	ProcessManager
+	processes []*scheduler.Process
+}
+
+func (m *fakeProcessManager) Processes(ctx context.Context, app string) ([]*scheduler.Process, error) {
+	return m.processes, nil
+}
+
+func (m *fakeProcessManager) CreateProcess(ctx context.Context, app *scheduler.App, p *scheduler.Process) error {
+	return nil
+}
@@ -23,6 +23,35 @@ func (m *FakeScheduler) Submit(ctx context.Context, app *App) error {
 	return nil
 }
 
+// SubmitCanary adds the canary processes to the app, replacing any existing
+// canaries.
+func (m *FakeScheduler) SubmitCanary(ctx context.Context, app *App) error {
+	a, ok := m.apps[app.ID]
+	if !ok {
+		return fmt.Errorf("app %s has not been submitted", app.ID)
+	}
+
+	canaries := make(map[string]bool)
+	for _, p := range app.Processes {
+		canaries[p.Type] = true
+	}
+
+	var processes []*Process
+	for _, p := range a.Processes {
+		if !canaries[p.Type] {
+			processes = append(processes, p)
+		}
+	}
+
+	m.apps[app.ID] = &App{
+		ID:        a.ID,
+		Name:      a.Name,
+		Processes: append(processes, app.Processes...),
+	}
+
+	return nil
+}
+
 func (m *FakeScheduler) Scale(ctx context.Context, app string, ptype string, instances uint) error {
 	if a, ok := m.apps[app]; ok {
 		var process *Process
@@ -65,9 +94,32 @@ func (m *FakeScheduler) Stop(ctx context.Context, instanceID string) error {
 	return nil
 }
 
-func (m *FakeScheduler) Run(ctx context.Context, app *App, p *Process, in io.Reader, out io.Writer) error {
+func (m *FakeScheduler) Restart(ctx context.Context, app string, ptype string) error {
+	return nil
+}
+
+func (m *FakeScheduler) Run(ctx context.Context, app *App, p *Process, in io.Reader, out io.Writer) (*Instance, error) {
 	if out != nil {
 		fmt.Fprintf(out, "Fake output for `%s` on %s\n", p.Command, app.Name)
+		return nil, nil
 	}
+
+	return &Instance{
+		ID:        "1",
+		State:     "running",
+		Process:   p,
+		UpdatedAt: timex.Now(),
+	}, nil
+}
+
+// Stabilize returns immediately, since processes in the FakeScheduler are
+// always stable.
+func (m *FakeScheduler) Stabilize(ctx context.Context, appID string, ss StatusStream) error {
+	return nil
+}
+
+// Wait returns immediately, since processes in the FakeScheduler always exit
+// successfully.
+func (m *FakeScheduler) Wait(ctx context.Context, appID string, instanceID string) error {
 	return nil
 }
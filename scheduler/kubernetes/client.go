@@ -0,0 +1,384 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultNamespace is the namespace that resources will be created in when
+// one is not provided.
+const DefaultNamespace = "default"
+
+// ObjectMeta is metadata that all persisted resources must have.
+type ObjectMeta struct {
+	Name              string            `json:"name,omitempty"`
+	GenerateName      string            `json:"generateName,omitempty"`
+	Namespace         string            `json:"namespace,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	CreationTimestamp *time.Time        `json:"creationTimestamp,omitempty"`
+}
+
+// LabelSelector is used to select resources by their labels.
+type LabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+// Deployment represents an apps/v1 Deployment.
+type Deployment struct {
+	APIVersion string           `json:"apiVersion,omitempty"`
+	Kind       string           `json:"kind,omitempty"`
+	Metadata   ObjectMeta       `json:"metadata"`
+	Spec       DeploymentSpec   `json:"spec"`
+	Status     DeploymentStatus `json:"status,omitempty"`
+}
+
+// DeploymentSpec is the desired state of a Deployment.
+type DeploymentSpec struct {
+	Replicas *int32          `json:"replicas,omitempty"`
+	Selector *LabelSelector  `json:"selector,omitempty"`
+	Template PodTemplateSpec `json:"template"`
+}
+
+// DeploymentStatus is the most recently observed state of a Deployment.
+type DeploymentStatus struct {
+	Replicas          int32 `json:"replicas,omitempty"`
+	UpdatedReplicas   int32 `json:"updatedReplicas,omitempty"`
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+}
+
+// PodTemplateSpec describes the pods that a Deployment will create.
+type PodTemplateSpec struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+}
+
+// Pod represents a v1 Pod.
+type Pod struct {
+	APIVersion string     `json:"apiVersion,omitempty"`
+	Kind       string     `json:"kind,omitempty"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       PodSpec    `json:"spec"`
+	Status     PodStatus  `json:"status,omitempty"`
+}
+
+// PodSpec is the specification of a Pod.
+type PodSpec struct {
+	Containers    []Container `json:"containers"`
+	RestartPolicy string      `json:"restartPolicy,omitempty"`
+}
+
+// PodStatus is the most recently observed state of a Pod.
+type PodStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	Reason            string            `json:"reason,omitempty"`
+	StartTime         *time.Time        `json:"startTime,omitempty"`
+	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// ContainerStatus is the most recently observed state of a container in a
+// Pod.
+type ContainerStatus struct {
+	Name  string         `json:"name"`
+	State ContainerState `json:"state"`
+}
+
+// ContainerState is the state of a container. Only the terminated state is
+// used.
+type ContainerState struct {
+	Terminated *ContainerStateTerminated `json:"terminated,omitempty"`
+}
+
+// ContainerStateTerminated describes a container that has exited.
+type ContainerStateTerminated struct {
+	ExitCode int    `json:"exitCode"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Container is a single container within a Pod.
+type Container struct {
+	Name      string               `json:"name"`
+	Image     string               `json:"image"`
+	Args      []string             `json:"args,omitempty"`
+	Env       []EnvVar             `json:"env,omitempty"`
+	Ports     []ContainerPort      `json:"ports,omitempty"`
+	Resources ResourceRequirements `json:"resources,omitempty"`
+}
+
+// EnvVar is an environment variable to set in a Container.
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ContainerPort is a port to expose from a Container.
+type ContainerPort struct {
+	ContainerPort int64  `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// ResourceRequirements describes the compute resources for a Container.
+// Values are Kubernetes resource quantities (e.g. "128Mi", "500m").
+type ResourceRequirements struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+// Service represents a v1 Service.
+type Service struct {
+	APIVersion string      `json:"apiVersion,omitempty"`
+	Kind       string      `json:"kind,omitempty"`
+	Metadata   ObjectMeta  `json:"metadata"`
+	Spec       ServiceSpec `json:"spec"`
+}
+
+// ServiceSpec is the specification of a Service.
+type ServiceSpec struct {
+	Type      string            `json:"type,omitempty"`
+	ClusterIP string            `json:"clusterIP,omitempty"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	Ports     []ServicePort     `json:"ports,omitempty"`
+}
+
+// ServicePort is a port that a Service exposes.
+type ServicePort struct {
+	Name       string `json:"name,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Port       int64  `json:"port"`
+	TargetPort int64  `json:"targetPort,omitempty"`
+}
+
+// Error is returned when the Kubernetes API responds with a failure Status.
+type Error struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("kubernetes: %s (%d)", e.Message, e.Code)
+}
+
+// IsNotFound returns true if the error is a Kubernetes API 404.
+func IsNotFound(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return e.Code == http.StatusNotFound
+	}
+	return false
+}
+
+// Client is a minimal client for the parts of the Kubernetes API that the
+// Scheduler uses.
+type Client struct {
+	// URL is the location of the Kubernetes API server.
+	URL string
+
+	// Namespace is the namespace that all resources are created within.
+	// The zero value is DefaultNamespace.
+	Namespace string
+
+	// Token is a bearer token used to authenticate with the API server.
+	Token string
+
+	// HTTPClient is the http.Client used to make requests. The zero value
+	// is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a new Client for the Kubernetes API at url.
+func NewClient(url string) *Client {
+	return &Client{URL: url}
+}
+
+// GetDeployment returns the named Deployment.
+func (c *Client) GetDeployment(ctx context.Context, name string) (*Deployment, error) {
+	var d Deployment
+	return &d, c.do(ctx, "GET", c.deploymentsPath(name), nil, &d)
+}
+
+// ListDeployments returns the Deployments that match the given labels.
+func (c *Client) ListDeployments(ctx context.Context, labels map[string]string) ([]Deployment, error) {
+	var list struct {
+		Items []Deployment `json:"items"`
+	}
+	err := c.do(ctx, "GET", c.deploymentsPath("")+selector(labels), nil, &list)
+	return list.Items, err
+}
+
+// CreateDeployment creates a new Deployment.
+func (c *Client) CreateDeployment(ctx context.Context, d *Deployment) (*Deployment, error) {
+	d.APIVersion, d.Kind = "apps/v1", "Deployment"
+	var created Deployment
+	return &created, c.do(ctx, "POST", c.deploymentsPath(""), d, &created)
+}
+
+// UpdateDeployment replaces an existing Deployment.
+func (c *Client) UpdateDeployment(ctx context.Context, d *Deployment) (*Deployment, error) {
+	d.APIVersion, d.Kind = "apps/v1", "Deployment"
+	var updated Deployment
+	return &updated, c.do(ctx, "PUT", c.deploymentsPath(d.Metadata.Name), d, &updated)
+}
+
+// DeleteDeployment deletes the named Deployment, along with its pods.
+func (c *Client) DeleteDeployment(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", c.deploymentsPath(name)+"?propagationPolicy=Foreground", nil, nil)
+}
+
+// GetService returns the named Service.
+func (c *Client) GetService(ctx context.Context, name string) (*Service, error) {
+	var s Service
+	return &s, c.do(ctx, "GET", c.corePath("services", name), nil, &s)
+}
+
+// ListServices returns the Services that match the given labels.
+func (c *Client) ListServices(ctx context.Context, labels map[string]string) ([]Service, error) {
+	var list struct {
+		Items []Service `json:"items"`
+	}
+	err := c.do(ctx, "GET", c.corePath("services", "")+selector(labels), nil, &list)
+	return list.Items, err
+}
+
+// CreateService creates a new Service.
+func (c *Client) CreateService(ctx context.Context, s *Service) (*Service, error) {
+	s.APIVersion, s.Kind = "v1", "Service"
+	var created Service
+	return &created, c.do(ctx, "POST", c.corePath("services", ""), s, &created)
+}
+
+// UpdateService replaces an existing Service.
+func (c *Client) UpdateService(ctx context.Context, s *Service) (*Service, error) {
+	s.APIVersion, s.Kind = "v1", "Service"
+	var updated Service
+	return &updated, c.do(ctx, "PUT", c.corePath("services", s.Metadata.Name), s, &updated)
+}
+
+// DeleteService deletes the named Service.
+func (c *Client) DeleteService(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", c.corePath("services", name), nil, nil)
+}
+
+// ListPods returns the Pods that match the given labels.
+func (c *Client) ListPods(ctx context.Context, labels map[string]string) ([]Pod, error) {
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	err := c.do(ctx, "GET", c.corePath("pods", "")+selector(labels), nil, &list)
+	return list.Items, err
+}
+
+// GetPod returns the named Pod.
+func (c *Client) GetPod(ctx context.Context, name string) (*Pod, error) {
+	var p Pod
+	return &p, c.do(ctx, "GET", c.corePath("pods", name), nil, &p)
+}
+
+// CreatePod creates a new Pod.
+func (c *Client) CreatePod(ctx context.Context, p *Pod) (*Pod, error) {
+	p.APIVersion, p.Kind = "v1", "Pod"
+	var created Pod
+	return &created, c.do(ctx, "POST", c.corePath("pods", ""), p, &created)
+}
+
+// DeletePod deletes the named Pod.
+func (c *Client) DeletePod(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", c.corePath("pods", name), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		e := &Error{Code: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Message == "" {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) namespace() string {
+	if c.Namespace == "" {
+		return DefaultNamespace
+	}
+	return c.Namespace
+}
+
+func (c *Client) deploymentsPath(name string) string {
+	return resourcePath(fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments", c.namespace()), name)
+}
+
+func (c *Client) corePath(resource, name string) string {
+	return resourcePath(fmt.Sprintf("/api/v1/namespaces/%s/%s", c.namespace(), resource), name)
+}
+
+func resourcePath(collection, name string) string {
+	if name == "" {
+		return collection
+	}
+	return collection + "/" + name
+}
+
+// selector returns a query string that selects resources with the given
+// labels.
+func selector(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for k, v := range labels {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(parts)
+
+	return "?" + url.Values{"labelSelector": []string{strings.Join(parts, ",")}}.Encode()
+}
@@ -1,4 +1,576 @@
 // Package kubernetes implements the Scheduler interface backed by Kubernetes.
 //
-// TODO: Implement this.
+// Each process is run as a Deployment. Processes that are exposed are also
+// given a Service, which load balances across the pods of the Deployment. All
+// resources are labeled with the app and process type that they belong to,
+// which allows the Scheduler to find them again later.
 package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	shellwords "github.com/mattn/go-shellwords"
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/scheduler"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// Labels that are attached to resources so that we can find them later.
+const (
+	AppIDLabel       = "empire.app.id"
+	AppNameLabel     = "empire.app.name"
+	ProcessTypeLabel = "empire.app.process"
+)
+
+// RestartedAtAnnotation is set on the pod template of a Deployment when the
+// process is restarted, which causes Kubernetes to replace the pods.
+const RestartedAtAnnotation = "empire.restartedAt"
+
+// ErrNoProcess is returned when trying to scale a process that does not have
+// a Deployment.
+var ErrNoProcess = errors.New("kubernetes: process has not been submitted")
+
+// DefaultPollInterval is the default amount of time to wait between checks on
+// the status of a one off process in Wait.
+var DefaultPollInterval = 5 * time.Second
+
+var (
+	_ scheduler.Scheduler = &Scheduler{}
+	_ scheduler.Waiter    = &Scheduler{}
+	_ scheduler.Restarter = &Scheduler{}
+)
+
+// Scheduler is an implementation of the scheduler.Scheduler interface backed
+// by Kubernetes.
+type Scheduler struct {
+	// The amount of time to wait between checks on the status of a one
+	// off process in Wait. The zero value is DefaultPollInterval.
+	PollInterval time.Duration
+
+	client *Client
+}
+
+// NewScheduler returns a new Scheduler instance that uses the given Client.
+func NewScheduler(c *Client) *Scheduler {
+	return &Scheduler{client: c}
+}
+
+// Submit creates or updates a Deployment, and optionally a Service, for each
+// process in the app. Resources for process types that are no longer present
+// in the app are removed.
+func (s *Scheduler) Submit(ctx context.Context, app *scheduler.App) error {
+	types := make(map[string]bool)
+
+	for _, p := range app.Processes {
+		types[p.Type] = true
+
+		if err := s.submitProcess(ctx, app, p); err != nil {
+			return err
+		}
+	}
+
+	deployments, err := s.client.ListDeployments(ctx, appLabels(app.ID))
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deployments {
+		if !types[d.Metadata.Labels[ProcessTypeLabel]] {
+			if err := s.client.DeleteDeployment(ctx, d.Metadata.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	services, err := s.client.ListServices(ctx, appLabels(app.ID))
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range services {
+		if !types[svc.Metadata.Labels[ProcessTypeLabel]] {
+			if err := s.client.DeleteService(ctx, svc.Metadata.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// submitProcess creates or updates the Deployment and Service for a single
+// process.
+func (s *Scheduler) submitProcess(ctx context.Context, app *scheduler.App, p *scheduler.Process) error {
+	d, err := newDeployment(app, p)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.client.GetDeployment(ctx, d.Metadata.Name)
+	switch {
+	case IsNotFound(err):
+		if _, err := s.client.CreateDeployment(ctx, d); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		d.Metadata.ResourceVersion = existing.Metadata.ResourceVersion
+		if _, err := s.client.UpdateDeployment(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	return s.submitService(ctx, app, p)
+}
+
+// submitService creates or updates the Service for the process if it's
+// exposed, or removes the existing Service if it's not.
+func (s *Scheduler) submitService(ctx context.Context, app *scheduler.App, p *scheduler.Process) error {
+	name := resourceName(app.Name, p.Type)
+
+	existing, err := s.client.GetService(ctx, name)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	svc := newService(app, p)
+
+	if svc == nil {
+		if exists {
+			return s.client.DeleteService(ctx, name)
+		}
+		return nil
+	}
+
+	if !exists {
+		_, err = s.client.CreateService(ctx, svc)
+		return err
+	}
+
+	// The cluster ip is immutable, so it needs to be carried over.
+	svc.Metadata.ResourceVersion = existing.Metadata.ResourceVersion
+	svc.Spec.ClusterIP = existing.Spec.ClusterIP
+	_, err = s.client.UpdateService(ctx, svc)
+	return err
+}
+
+// Scale updates the number of replicas for the process's Deployment.
+func (s *Scheduler) Scale(ctx context.Context, app string, ptype string, instances uint) error {
+	deployments, err := s.client.ListDeployments(ctx, processLabels(app, ptype))
+	if err != nil {
+		return err
+	}
+
+	if len(deployments) == 0 {
+		return ErrNoProcess
+	}
+
+	d := deployments[0]
+	d.Spec.Replicas = replicas(instances)
+
+	_, err = s.client.UpdateDeployment(ctx, &d)
+	return err
+}
+
+// Restart triggers a rolling update of the Deployment for the process, by
+// setting an annotation on the pod template.
+func (s *Scheduler) Restart(ctx context.Context, app string, ptype string) error {
+	deployments, err := s.client.ListDeployments(ctx, processLabels(app, ptype))
+	if err != nil {
+		return err
+	}
+
+	if len(deployments) == 0 {
+		return ErrNoProcess
+	}
+
+	d := deployments[0]
+	if d.Spec.Template.Metadata.Annotations == nil {
+		d.Spec.Template.Metadata.Annotations = make(map[string]string)
+	}
+	d.Spec.Template.Metadata.Annotations[RestartedAtAnnotation] = timex.Now().Format(time.RFC3339)
+
+	_, err = s.client.UpdateDeployment(ctx, &d)
+	return err
+}
+
+// Remove removes all of the Deployments, Services and one off Pods for the
+// app.
+func (s *Scheduler) Remove(ctx context.Context, app string) error {
+	deployments, err := s.client.ListDeployments(ctx, appLabels(app))
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deployments {
+		if err := s.client.DeleteDeployment(ctx, d.Metadata.Name); err != nil {
+			return err
+		}
+	}
+
+	services, err := s.client.ListServices(ctx, appLabels(app))
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range services {
+		if err := s.client.DeleteService(ctx, svc.Metadata.Name); err != nil {
+			return err
+		}
+	}
+
+	pods, err := s.client.ListPods(ctx, processLabels(app, "run"))
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods {
+		if err := s.client.DeletePod(ctx, pod.Metadata.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Instances returns an Instance for each Pod that belongs to the app.
+func (s *Scheduler) Instances(ctx context.Context, app string) ([]*scheduler.Instance, error) {
+	var instances []*scheduler.Instance
+
+	pods, err := s.client.ListPods(ctx, appLabels(app))
+	if err != nil {
+		return instances, err
+	}
+
+	for _, pod := range pods {
+		updatedAt := timex.Now()
+		if t := pod.Status.StartTime; t != nil {
+			updatedAt = *t
+		}
+
+		instances = append(instances, &scheduler.Instance{
+			Process:   podToProcess(pod),
+			ID:        pod.Metadata.Name,
+			State:     strings.ToLower(pod.Status.Phase),
+			UpdatedAt: updatedAt,
+		})
+	}
+
+	return instances, nil
+}
+
+// Stop deletes the Pod. If the Pod belongs to a Deployment, Kubernetes will
+// start a new one in its place.
+func (s *Scheduler) Stop(ctx context.Context, instanceID string) error {
+	return s.client.DeletePod(ctx, instanceID)
+}
+
+// Run runs a one off process as a Pod that is never restarted. Attaching to
+// the process is not supported, so out must be nil.
+func (s *Scheduler) Run(ctx context.Context, app *scheduler.App, p *scheduler.Process, in io.Reader, out io.Writer) (*scheduler.Instance, error) {
+	if out != nil {
+		return nil, errors.New("kubernetes: attached processes are not supported")
+	}
+
+	c, err := newContainer(p)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := processLabels(app.ID, p.Type)
+	labels[AppNameLabel] = app.Name
+
+	pod, err := s.client.CreatePod(ctx, &Pod{
+		Metadata: ObjectMeta{
+			GenerateName: resourceName(app.Name, p.Type) + "-",
+			Labels:       labels,
+		},
+		Spec: PodSpec{
+			Containers:    []Container{c},
+			RestartPolicy: "Never",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Instance{
+		Process:   p,
+		ID:        pod.Metadata.Name,
+		State:     "pending",
+		UpdatedAt: timex.Now(),
+	}, nil
+}
+
+// Wait polls the Pod for a one off process until it has stopped, then returns
+// an ExitError if its container exited with a non-zero exit code.
+func (s *Scheduler) Wait(ctx context.Context, app string, instanceID string) error {
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		pod, err := s.client.GetPod(ctx, instanceID)
+		if err != nil {
+			return err
+		}
+
+		switch pod.Status.Phase {
+		case "Succeeded":
+			return nil
+		case "Failed":
+			return podExitError(pod)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// podExitError returns an ExitError for a failed Pod, from the first container
+// that exited with a non-zero exit code.
+func podExitError(pod *Pod) error {
+	for _, c := range pod.Status.ContainerStatuses {
+		if t := c.State.Terminated; t != nil && t.ExitCode != 0 {
+			return &scheduler.ExitError{Code: t.ExitCode, Reason: t.Reason}
+		}
+	}
+
+	return &scheduler.ExitError{Code: -1, Reason: pod.Status.Reason}
+}
+
+// newDeployment returns the Deployment that will run the process.
+func newDeployment(app *scheduler.App, p *scheduler.Process) (*Deployment, error) {
+	c, err := newContainer(p)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := processLabels(app.ID, p.Type)
+	labels[AppNameLabel] = app.Name
+
+	return &Deployment{
+		Metadata: ObjectMeta{
+			Name:   resourceName(app.Name, p.Type),
+			Labels: labels,
+		},
+		Spec: DeploymentSpec{
+			Replicas: replicas(p.Instances),
+			Selector: &LabelSelector{
+				MatchLabels: processLabels(app.ID, p.Type),
+			},
+			Template: PodTemplateSpec{
+				Metadata: ObjectMeta{
+					Labels: labels,
+				},
+				Spec: PodSpec{
+					Containers: []Container{c},
+				},
+			},
+		},
+	}, nil
+}
+
+// newService returns the Service that will expose the process, or nil if the
+// process is not exposed.
+func newService(app *scheduler.App, p *scheduler.Process) *Service {
+	if p.Exposure <= scheduler.ExposeNone || len(p.Ports) == 0 {
+		return nil
+	}
+
+	// Private processes are only reachable from within the cluster.
+	typ := "ClusterIP"
+	if p.Exposure == scheduler.ExposePublic {
+		typ = "LoadBalancer"
+	}
+
+	var ports []ServicePort
+	for _, m := range p.Ports {
+		if m.Container == nil {
+			continue
+		}
+
+		port := ServicePort{
+			Name:       "http",
+			Protocol:   "TCP",
+			Port:       80,
+			TargetPort: *m.Container,
+		}
+		if len(ports) > 0 {
+			port.Name = fmt.Sprintf("http-%d", *m.Container)
+			port.Port = *m.Container
+		}
+		ports = append(ports, port)
+	}
+
+	labels := processLabels(app.ID, p.Type)
+	labels[AppNameLabel] = app.Name
+
+	return &Service{
+		Metadata: ObjectMeta{
+			Name:   resourceName(app.Name, p.Type),
+			Labels: labels,
+		},
+		Spec: ServiceSpec{
+			Type:     typ,
+			Selector: processLabels(app.ID, p.Type),
+			Ports:    ports,
+		},
+	}
+}
+
+// newContainer returns the Container that will run the process.
+func newContainer(p *scheduler.Process) (Container, error) {
+	args, err := shellwords.Parse(p.Command)
+	if err != nil {
+		return Container{}, err
+	}
+
+	var env []EnvVar
+	for k, v := range p.Env {
+		env = append(env, EnvVar{Name: k, Value: v})
+	}
+
+	var ports []ContainerPort
+	for _, m := range p.Ports {
+		if m.Container == nil {
+			continue
+		}
+
+		ports = append(ports, ContainerPort{
+			ContainerPort: *m.Container,
+			Protocol:      "TCP",
+		})
+	}
+
+	resources := ResourceRequirements{
+		Limits:   make(map[string]string),
+		Requests: make(map[string]string),
+	}
+	if p.MemoryLimit > 0 {
+		resources.Limits["memory"] = strconv.FormatUint(uint64(p.MemoryLimit), 10)
+	}
+	if p.CPUShares > 0 {
+		// Kubernetes expresses cpu in thousandths of a core, where ECS
+		// and Docker use 1024 shares per core.
+		resources.Requests["cpu"] = fmt.Sprintf("%dm", p.CPUShares*1000/1024)
+	}
+
+	return Container{
+		Name:      containerName(p.Type),
+		Image:     p.Image.String(),
+		Args:      args,
+		Env:       env,
+		Ports:     ports,
+		Resources: resources,
+	}, nil
+}
+
+// podToProcess converts a Pod back into a scheduler.Process.
+func podToProcess(pod Pod) *scheduler.Process {
+	p := &scheduler.Process{
+		Type: pod.Metadata.Labels[ProcessTypeLabel],
+		Env:  make(map[string]string),
+	}
+
+	if len(pod.Spec.Containers) == 0 {
+		return p
+	}
+
+	c := pod.Spec.Containers[0]
+
+	p.Command = strings.Join(c.Args, " ")
+	for _, e := range c.Env {
+		p.Env[e.Name] = e.Value
+	}
+	p.MemoryLimit = uint(parseQuantity(c.Resources.Limits["memory"]))
+	p.CPUShares = uint(parseQuantity(c.Resources.Requests["cpu"]) * 1024)
+
+	if img, err := image.Decode(c.Image); err == nil {
+		p.Image = img
+	}
+
+	return p
+}
+
+// Suffixes for Kubernetes resource quantities, and the multiplier to apply.
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"k", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"m", 1e-3},
+}
+
+// parseQuantity parses a Kubernetes resource quantity into its base unit (cores
+// for cpu, bytes for memory).
+func parseQuantity(q string) float64 {
+	if q == "" {
+		return 0
+	}
+
+	multiplier := float64(1)
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(q, s.suffix) {
+			q = strings.TrimSuffix(q, s.suffix)
+			multiplier = s.multiplier
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return 0
+	}
+
+	return v * multiplier
+}
+
+func appLabels(app string) map[string]string {
+	return map[string]string{
+		AppIDLabel: app,
+	}
+}
+
+func processLabels(app, ptype string) map[string]string {
+	return map[string]string{
+		AppIDLabel:       app,
+		ProcessTypeLabel: ptype,
+	}
+}
+
+func replicas(instances uint) *int32 {
+	n := int32(instances)
+	return &n
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// resourceName returns a valid Kubernetes resource name for the process.
+func resourceName(app, ptype string) string {
+	return fmt.Sprintf("%s-%s", app, containerName(ptype))
+}
+
+// containerName returns a valid Kubernetes container name for the process
+// type.
+func containerName(ptype string) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(ptype), "-"), "-")
+}
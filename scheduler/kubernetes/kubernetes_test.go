@@ -0,0 +1,625 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/empire/scheduler"
+	"golang.org/x/net/context"
+)
+
+func TestScheduler_Submit(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	if err := s.Submit(ctx, fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.GetDeployment(ctx, "acme-inc-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := *d.Spec.Replicas, int32(2); got != want {
+		t.Fatalf("Replicas => %d; want %d", got, want)
+	}
+
+	if got, want := d.Spec.Selector.MatchLabels[ProcessTypeLabel], "web"; got != want {
+		t.Fatalf("Selector => %s; want %s", got, want)
+	}
+
+	container := d.Spec.Template.Spec.Containers[0]
+
+	if got, want := container.Image, "remind101/acme-inc:latest"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+
+	if got, want := strings.Join(container.Args, "|"), "acme-inc|web|--port 80"; got != want {
+		t.Fatalf("Args => %s; want %s", got, want)
+	}
+
+	if got, want := container.Env, []EnvVar{{Name: "USER", Value: "foo"}}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("Env => %v; want %v", got, want)
+	}
+
+	if got, want := container.Ports[0].ContainerPort, int64(8080); got != want {
+		t.Fatalf("ContainerPort => %d; want %d", got, want)
+	}
+
+	if got, want := container.Resources.Limits["memory"], "134217728"; got != want {
+		t.Fatalf("Limits[memory] => %s; want %s", got, want)
+	}
+
+	if got, want := container.Resources.Requests["cpu"], "125m"; got != want {
+		t.Fatalf("Requests[cpu] => %s; want %s", got, want)
+	}
+
+	svc, err := c.GetService(ctx, "acme-inc-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := svc.Spec.Type, "LoadBalancer"; got != want {
+		t.Fatalf("Type => %s; want %s", got, want)
+	}
+
+	if got, want := svc.Spec.Ports, []ServicePort{{Name: "http", Protocol: "TCP", Port: 80, TargetPort: 8080}}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("Ports => %v; want %v", got, want)
+	}
+
+	if _, err := c.GetService(ctx, "acme-inc-worker"); !IsNotFound(err) {
+		t.Fatalf("expected worker to not have a service; got %v", err)
+	}
+}
+
+func TestScheduler_Submit_Update(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	if err := s.Submit(ctx, fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fakeApp()
+	app.Processes = app.Processes[:1]
+	app.Processes[0].Exposure = scheduler.ExposePrivate
+	app.Processes[0].Image.Tag = "v2"
+
+	if err := s.Submit(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.GetDeployment(ctx, "acme-inc-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := d.Spec.Template.Spec.Containers[0].Image, "remind101/acme-inc:v2"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+
+	svc, err := c.GetService(ctx, "acme-inc-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := svc.Spec.Type, "ClusterIP"; got != want {
+		t.Fatalf("Type => %s; want %s", got, want)
+	}
+
+	if _, err := c.GetDeployment(ctx, "acme-inc-worker"); !IsNotFound(err) {
+		t.Fatalf("expected worker deployment to be removed; got %v", err)
+	}
+}
+
+func TestScheduler_Scale(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	if err := s.Submit(ctx, fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Scale(ctx, "1234", "worker", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.GetDeployment(ctx, "acme-inc-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := *d.Spec.Replicas, int32(5); got != want {
+		t.Fatalf("Replicas => %d; want %d", got, want)
+	}
+
+	if err := s.Scale(ctx, "1234", "scheduler", 1); err != ErrNoProcess {
+		t.Fatalf("err => %v; want %v", err, ErrNoProcess)
+	}
+}
+
+func TestScheduler_Restart(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	if err := s.Submit(ctx, fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Restart(ctx, "1234", "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.GetDeployment(ctx, "acme-inc-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := d.Spec.Template.Metadata.Annotations[RestartedAtAnnotation]; !ok {
+		t.Fatal("expected the pod template to be annotated")
+	}
+
+	if err := s.Restart(ctx, "1234", "scheduler"); err != ErrNoProcess {
+		t.Fatalf("err => %v; want %v", err, ErrNoProcess)
+	}
+}
+
+func TestScheduler_Instances(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	app := fakeApp()
+	container, err := newContainer(app.Processes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startedAt := time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := c.CreatePod(ctx, &Pod{
+		Metadata: ObjectMeta{
+			Name:   "acme-inc-web-abcd",
+			Labels: processLabels("1234", "web"),
+		},
+		Spec: PodSpec{
+			Containers: []Container{container},
+		},
+		Status: PodStatus{
+			Phase:     "Running",
+			StartTime: &startedAt,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := s.Instances(ctx, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 1 {
+		t.Fatal("expected 1 instance")
+	}
+
+	i := instances[0]
+
+	if got, want := i.ID, "acme-inc-web-abcd"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if got, want := i.State, "running"; got != want {
+		t.Fatalf("State => %s; want %s", got, want)
+	}
+
+	if got, want := i.UpdatedAt, startedAt; !got.Equal(want) {
+		t.Fatalf("UpdatedAt => %s; want %s", got, want)
+	}
+
+	if got, want := i.Process.Type, "web"; got != want {
+		t.Fatalf("Type => %s; want %s", got, want)
+	}
+
+	if got, want := i.Process.MemoryLimit, uint(134217728); got != want {
+		t.Fatalf("MemoryLimit => %d; want %d", got, want)
+	}
+
+	if got, want := i.Process.CPUShares, uint(128); got != want {
+		t.Fatalf("CPUShares => %d; want %d", got, want)
+	}
+
+	if got, want := i.Process.Image.String(), "remind101/acme-inc:latest"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+
+	if err := s.Stop(ctx, "acme-inc-web-abcd"); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err = s.Instances(ctx, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 0 {
+		t.Fatal("expected pod to be deleted")
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	app := fakeApp()
+	p := &scheduler.Process{
+		Type:    "run",
+		Image:   image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+		Command: "rake db:migrate",
+	}
+
+	if _, err := s.Run(ctx, app, p, nil, new(bytes.Buffer)); err == nil {
+		t.Fatal("expected attached runs to fail")
+	}
+
+	instance, err := s.Run(ctx, app, p, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pods, err := c.ListPods(ctx, processLabels("1234", "run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 1 {
+		t.Fatal("expected a pod to be created")
+	}
+
+	if got, want := pods[0].Spec.RestartPolicy, "Never"; got != want {
+		t.Fatalf("RestartPolicy => %s; want %s", got, want)
+	}
+
+	if got := pods[0].Metadata.Name; !strings.HasPrefix(got, "acme-inc-run-") {
+		t.Fatalf("Name => %s; want acme-inc-run-*", got)
+	}
+
+	if got, want := instance.ID, pods[0].Metadata.Name; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if err := s.Remove(ctx, "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	pods, err = c.ListPods(ctx, appLabels("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pods) != 0 {
+		t.Fatal("expected pods to be removed")
+	}
+}
+
+func TestScheduler_Wait(t *testing.T) {
+	api := newFakeAPIServer()
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	s := NewScheduler(c)
+	s.PollInterval = time.Millisecond
+
+	ctx := context.Background()
+
+	p := &scheduler.Process{
+		Type:    "release",
+		Image:   image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+		Command: "rake db:migrate",
+	}
+
+	tests := []struct {
+		status map[string]interface{}
+		err    error
+	}{
+		{map[string]interface{}{"phase": "Succeeded"}, nil},
+		{
+			map[string]interface{}{
+				"phase": "Failed",
+				"containerStatuses": []interface{}{
+					map[string]interface{}{"name": "release", "state": map[string]interface{}{"terminated": map[string]interface{}{"exitCode": 2, "reason": "Error"}}},
+				},
+			},
+			&scheduler.ExitError{Code: 2, Reason: "Error"},
+		},
+	}
+
+	for _, tt := range tests {
+		instance, err := s.Run(ctx, fakeApp(), p, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Finish the pod after the first check.
+		go func(status map[string]interface{}) {
+			time.Sleep(10 * time.Millisecond)
+			api.Lock()
+			defer api.Unlock()
+			api.collections[c.corePath("pods", "")][instance.ID]["status"] = status
+		}(tt.status)
+
+		if err := s.Wait(ctx, "1234", instance.ID); !reflect.DeepEqual(err, tt.err) {
+			t.Fatalf("Wait() => %v; want %v", err, tt.err)
+		}
+	}
+}
+
+func TestScheduler_Remove(t *testing.T) {
+	s, c, srv := newTestScheduler(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	if err := s.Submit(ctx, fakeApp()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Remove(ctx, "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	deployments, err := c.ListDeployments(ctx, appLabels("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := c.ListServices(ctx, appLabels("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deployments) != 0 || len(services) != 0 {
+		t.Fatal("expected all resources to be removed")
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in  string
+		out float64
+	}{
+		{"", 0},
+		{"134217728", 134217728},
+		{"128Mi", 134217728},
+		{"1Gi", 1073741824},
+		{"1G", 1000000000},
+		{"500m", 0.5},
+		{"2", 2},
+		{"foo", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseQuantity(tt.in); got != tt.out {
+			t.Errorf("parseQuantity(%q) => %v; want %v", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	tests := []struct {
+		app, ptype string
+		out        string
+	}{
+		{"acme-inc", "web", "acme-inc-web"},
+		{"acme-inc", "Worker_High", "acme-inc-worker-high"},
+	}
+
+	for _, tt := range tests {
+		if got := resourceName(tt.app, tt.ptype); got != tt.out {
+			t.Errorf("resourceName(%q, %q) => %s; want %s", tt.app, tt.ptype, got, tt.out)
+		}
+	}
+}
+
+// fakeApp returns a fake app for testing.
+func fakeApp() *scheduler.App {
+	return &scheduler.App{
+		ID:   "1234",
+		Name: "acme-inc",
+		Processes: []*scheduler.Process{
+			&scheduler.Process{
+				Type:    "web",
+				Image:   image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+				Command: "acme-inc web '--port 80'",
+				Env: map[string]string{
+					"USER": "foo",
+				},
+				MemoryLimit: 134217728, // 128
+				CPUShares:   128,
+				Instances:   2,
+				Exposure:    scheduler.ExposePublic,
+				Ports: []scheduler.PortMap{
+					{Host: aws.Int64(9000), Container: aws.Int64(8080)},
+				},
+			},
+			&scheduler.Process{
+				Type:      "worker",
+				Image:     image.Image{Repository: "remind101/acme-inc", Tag: "latest"},
+				Command:   "acme-inc worker",
+				Instances: 1,
+			},
+		},
+	}
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *Client, *httptest.Server) {
+	s := httptest.NewServer(newFakeAPIServer())
+	c := NewClient(s.URL)
+	return NewScheduler(c), c, s
+}
+
+// fakeAPIServer is an in memory implementation of the parts of the Kubernetes
+// API that the Scheduler uses.
+type fakeAPIServer struct {
+	sync.Mutex
+
+	// Maps a collection path (e.g. /api/v1/namespaces/default/pods) to
+	// the objects within it, by name.
+	collections map[string]map[string]map[string]interface{}
+
+	version int
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	return &fakeAPIServer{
+		collections: make(map[string]map[string]map[string]interface{}),
+	}
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	collection, name := r.URL.Path, ""
+	if !isCollection(collection) {
+		i := strings.LastIndex(collection, "/")
+		collection, name = collection[:i], collection[i+1:]
+	}
+
+	if s.collections[collection] == nil {
+		s.collections[collection] = make(map[string]map[string]interface{})
+	}
+	objects := s.collections[collection]
+
+	switch {
+	case r.Method == "GET" && name == "":
+		items := []interface{}{}
+		for _, o := range objects {
+			if matchLabels(o, r.URL.Query().Get("labelSelector")) {
+				items = append(items, o)
+			}
+		}
+		writeJSON(w, 200, map[string]interface{}{"items": items})
+	case r.Method == "GET":
+		o, ok := objects[name]
+		if !ok {
+			writeStatus(w, 404, "not found")
+			return
+		}
+		writeJSON(w, 200, o)
+	case r.Method == "POST":
+		var o map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			writeStatus(w, 400, err.Error())
+			return
+		}
+		meta := metadata(o)
+		if meta["name"] == nil {
+			meta["name"] = fmt.Sprintf("%s%d", meta["generateName"], s.version)
+		}
+		name := meta["name"].(string)
+		if _, ok := objects[name]; ok {
+			writeStatus(w, 409, "already exists")
+			return
+		}
+		s.store(objects, name, o)
+		writeJSON(w, 201, o)
+	case r.Method == "PUT":
+		var o map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			writeStatus(w, 400, err.Error())
+			return
+		}
+		existing, ok := objects[name]
+		if !ok {
+			writeStatus(w, 404, "not found")
+			return
+		}
+		if metadata(o)["resourceVersion"] != metadata(existing)["resourceVersion"] {
+			writeStatus(w, 409, "conflict")
+			return
+		}
+		s.store(objects, name, o)
+		writeJSON(w, 200, o)
+	case r.Method == "DELETE":
+		if _, ok := objects[name]; !ok {
+			writeStatus(w, 404, "not found")
+			return
+		}
+		delete(objects, name)
+		writeJSON(w, 200, map[string]interface{}{"kind": "Status", "status": "Success"})
+	default:
+		writeStatus(w, 405, "method not allowed")
+	}
+}
+
+func (s *fakeAPIServer) store(objects map[string]map[string]interface{}, name string, o map[string]interface{}) {
+	s.version++
+	metadata(o)["resourceVersion"] = fmt.Sprintf("%d", s.version)
+	objects[name] = o
+}
+
+func isCollection(path string) bool {
+	for _, r := range []string{"/deployments", "/services", "/pods"} {
+		if strings.HasSuffix(path, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func metadata(o map[string]interface{}) map[string]interface{} {
+	if o["metadata"] == nil {
+		o["metadata"] = make(map[string]interface{})
+	}
+	return o["metadata"].(map[string]interface{})
+}
+
+func matchLabels(o map[string]interface{}, selector string) bool {
+	labels, _ := metadata(o)["labels"].(map[string]interface{})
+	for _, l := range strings.Split(selector, ",") {
+		if l == "" {
+			continue
+		}
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) != 2 || labels[parts[0]] != parts[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]interface{}{
+		"kind":    "Status",
+		"code":    code,
+		"message": message,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
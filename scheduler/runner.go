@@ -14,10 +14,10 @@ type AttachedRunner struct {
 	Runner *runner.Runner
 }
 
-func (m *AttachedRunner) Run(ctx context.Context, app *App, p *Process, in io.Reader, out io.Writer) error {
+func (m *AttachedRunner) Run(ctx context.Context, app *App, p *Process, in io.Reader, out io.Writer) (*Instance, error) {
 	// If an output stream is provided, run using the docker runner.
 	if out != nil {
-		return m.Runner.Run(ctx, runner.RunOpts{
+		return nil, m.Runner.Run(ctx, runner.RunOpts{
 			Image:   p.Image,
 			Command: p.Command,
 			Env:     p.Env,
@@ -28,3 +28,55 @@ func (m *AttachedRunner) Run(ctx context.Context, app *App, p *Process, in io.Re
 
 	return m.Scheduler.Run(ctx, app, p, in, out)
 }
+
+// Stabilize waits for the app to stabilize if the wrapped Scheduler
+// implements the Stabilizer interface.
+func (m *AttachedRunner) Stabilize(ctx context.Context, app string, ss StatusStream) error {
+	if s, ok := m.Scheduler.(Stabilizer); ok {
+		return s.Stabilize(ctx, app, ss)
+	}
+	return nil
+}
+
+// Wait waits for the instance to exit if the wrapped Scheduler implements the
+// Waiter interface.
+func (m *AttachedRunner) Wait(ctx context.Context, app string, instanceID string) error {
+	if w, ok := m.Scheduler.(Waiter); ok {
+		return w.Wait(ctx, app, instanceID)
+	}
+	return ErrWaitNotSupported
+}
+
+// Restart restarts the process type using the wrapped Scheduler, falling back
+// to stopping each instance if it doesn't implement the Restarter interface.
+func (m *AttachedRunner) Restart(ctx context.Context, app string, process string) error {
+	return Restart(ctx, m.Scheduler, app, process)
+}
+
+// Prune prunes old resources for the app if the wrapped Scheduler implements
+// the Pruner interface.
+func (m *AttachedRunner) Prune(ctx context.Context, app string, releases []string) error {
+	if p, ok := m.Scheduler.(Pruner); ok {
+		return p.Prune(ctx, app, releases)
+	}
+	return nil
+}
+
+// Plan returns the changes that submitting the app would make if the wrapped
+// Scheduler implements the Planner interface. Otherwise, a nil Plan is
+// returned.
+func (m *AttachedRunner) Plan(ctx context.Context, app *App) (*Plan, error) {
+	if p, ok := m.Scheduler.(Planner); ok {
+		return p.Plan(ctx, app)
+	}
+	return nil, nil
+}
+
+// SubmitCanary submits the canary processes if the wrapped Scheduler
+// implements the CanarySubmitter interface.
+func (m *AttachedRunner) SubmitCanary(ctx context.Context, app *App) error {
+	if s, ok := m.Scheduler.(CanarySubmitter); ok {
+		return s.SubmitCanary(ctx, app)
+	}
+	return ErrCanaryNotSupported
+}
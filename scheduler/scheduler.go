@@ -3,6 +3,8 @@
 package scheduler
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -84,6 +86,15 @@ type Process struct {
 
 	// An SSL Cert associated with this process.
 	SSLCert string
+
+	// If provided, the HTTP path that the load balancer uses to check the
+	// health of instances.
+	HealthCheck string
+
+	// If this process is a canary, the process type that it's a canary of.
+	// Canaries share the load balancer of the process that they're a
+	// canary of.
+	CanaryOf string
 }
 
 // Instance represents an Instance of a Process.
@@ -106,8 +117,10 @@ type Scaler interface {
 }
 
 type Runner interface {
-	// Run runs a process.
-	Run(ctx context.Context, app *App, process *Process, in io.Reader, out io.Writer) error
+	// Run runs a process. If an output stream is provided, the process is
+	// attached to, and Run returns when it exits. Otherwise, the process is
+	// run detached, and the Instance that was started is returned.
+	Run(ctx context.Context, app *App, process *Process, in io.Reader, out io.Writer) (*Instance, error)
 }
 
 // Scheduler is an interface for interfacing with Services.
@@ -128,3 +141,224 @@ type Scheduler interface {
 	// instance.
 	Stop(ctx context.Context, instanceID string) error
 }
+
+// Restarter is an optional interface that a Scheduler can implement to replace
+// all of the instances of a process type in a way that's specific to the
+// Scheduler (e.g. a rolling restart).
+type Restarter interface {
+	// Restart replaces all of the instances of a process type with new
+	// instances. Where possible, instances should be replaced gradually
+	// so that the process remains available.
+	Restart(ctx context.Context, app string, process string) error
+}
+
+// Restart restarts a process type using s if it implements the Restarter
+// interface. Otherwise, every instance of the process type is stopped, and
+// replaced by the Scheduler.
+func Restart(ctx context.Context, s Scheduler, app string, process string) error {
+	if r, ok := s.(Restarter); ok {
+		return r.Restart(ctx, app, process)
+	}
+
+	instances, err := s.Instances(ctx, app)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range instances {
+		if i.Process == nil || i.Process.Type != process {
+			continue
+		}
+
+		if err := s.Stop(ctx, i.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status represents a status update for an app that was submitted.
+type Status struct {
+	// A friendly human readable message about the status change.
+	Message string
+}
+
+// StatusStream is an interface for publishing status updates.
+type StatusStream interface {
+	Publish(Status) error
+}
+
+// StatusStreamFunc is a function that implements the StatusStream interface.
+type StatusStreamFunc func(Status) error
+
+// Publish calls fn.
+func (fn StatusStreamFunc) Publish(status Status) error {
+	return fn(status)
+}
+
+// Stabilizer is an optional interface that a Scheduler can implement to wait
+// for a submitted app to become stable.
+type Stabilizer interface {
+	// Stabilize blocks until every process in the app is running the
+	// desired number of instances of the latest version, publishing status
+	// updates to ss along the way. Callers should provide a context with
+	// a deadline to limit how long to wait.
+	//
+	// If the new version of a process keeps failing, and isn't expected
+	// to ever become stable, an *UnhealthyError should be returned.
+	Stabilize(ctx context.Context, app string, ss StatusStream) error
+}
+
+// UnhealthyError is returned from Stabilize when the new version of a process
+// keeps failing (e.g. instances crash or fail load balancer health checks).
+type UnhealthyError struct {
+	// The process type that is failing.
+	Process string
+
+	// The most recent failure.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *UnhealthyError) Error() string {
+	return fmt.Sprintf("%s is unhealthy: %s", e.Process, e.Reason)
+}
+
+// ErrCanaryNotSupported is returned when submitting a canary isn't supported
+// by the Scheduler.
+var ErrCanaryNotSupported = errors.New("scheduler: canaries are not supported")
+
+// CanarySubmitter is an optional interface that a Scheduler can implement to
+// run canaries of a new release alongside the existing processes.
+type CanarySubmitter interface {
+	// SubmitCanary creates or updates the processes in the app, which
+	// should all be canaries, without changing or removing any of the
+	// app's other processes. Canaries are removed when the app is next
+	// submitted with Submit.
+	SubmitCanary(ctx context.Context, app *App) error
+}
+
+// CanariesSupported returns true if s implements the CanarySubmitter
+// interface. Schedulers wrapped by an AttachedRunner are checked directly,
+// since the AttachedRunner always forwards SubmitCanary.
+func CanariesSupported(s Scheduler) bool {
+	for {
+		r, ok := s.(*AttachedRunner)
+		if !ok {
+			break
+		}
+		s = r.Scheduler
+	}
+
+	_, ok := s.(CanarySubmitter)
+	return ok
+}
+
+// Pruner is an optional interface that a Scheduler can implement to remove
+// resources that were created for old releases of an app, and are no longer
+// in use.
+type Pruner interface {
+	// Prune removes resources that were created for the given releases
+	// of the app, which have been deleted and won't be run again.
+	// Releases are identified by the EMPIRE_RELEASE environment variable
+	// of their processes (e.g. v1).
+	Prune(ctx context.Context, app string, releases []string) error
+}
+
+// Actions that submitting an app can take on a process.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionRemove = "remove"
+)
+
+// Types of changes to an environment variable.
+const (
+	EnvAdded   = "added"
+	EnvRemoved = "removed"
+	EnvChanged = "changed"
+)
+
+// Plan describes the changes that submitting an app would make.
+type Plan struct {
+	// The changes to each process, including processes that would be
+	// removed.
+	Processes []*ProcessPlan
+}
+
+// ProcessPlan describes the changes that submitting an app would make to a
+// single process.
+type ProcessPlan struct {
+	// The type of process.
+	Type string
+
+	// What would happen to the process. See the Action constants.
+	Action string
+
+	// If the command would change, the existing command and the new
+	// command.
+	Command *CommandChange
+
+	// The environment variables that would be added, removed or changed.
+	// Values are never included, since they may be secret.
+	Env []*EnvChange
+
+	// If the process is exposed, what would happen to its load balancer
+	// (e.g. "create public load balancer").
+	LoadBalancer string
+
+	// Problems that would cause submitting the app to fail, such as an
+	// existing load balancer that doesn't match the process.
+	Errors []string
+}
+
+// CommandChange represents a change to the command of a process.
+type CommandChange struct {
+	From, To string
+}
+
+// EnvChange represents a change to an environment variable.
+type EnvChange struct {
+	Name   string
+	Change string
+}
+
+// Planner is an optional interface that a Scheduler can implement to describe
+// the changes that Submit would make, without making them.
+type Planner interface {
+	// Plan compares the app with what's currently running, and returns
+	// the changes that submitting it would make. It must not change
+	// anything.
+	Plan(ctx context.Context, app *App) (*Plan, error)
+}
+
+// ErrWaitNotSupported is returned when waiting for an instance to exit isn't
+// supported by the Scheduler.
+var ErrWaitNotSupported = errors.New("scheduler: waiting for a process to exit is not supported")
+
+// ExitError is returned from Wait when a process exits with a non-zero exit
+// status.
+type ExitError struct {
+	// The exit status of the process.
+	Code int
+
+	// An optional reason that the process exited.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ExitError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("process exited with status %d: %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("process exited with status %d", e.Code)
+}
+
+// Waiter is an optional interface that a Scheduler can implement to wait for
+// a detached process, started with Run, to exit.
+type Waiter interface {
+	// Wait blocks until the instance exits. If the instance exits with a
+	// non-zero exit status, an ExitError is returned.
+	Wait(ctx context.Context, app string, instanceID string) error
+}
@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// stopScheduler is a Scheduler that doesn't implement the Restarter
+// interface, and records the instances that are stopped.
+type stopScheduler struct {
+	Scheduler
+	instances []*Instance
+	stopped   []string
+}
+
+func (s *stopScheduler) Instances(ctx context.Context, app string) ([]*Instance, error) {
+	return s.instances, nil
+}
+
+func (s *stopScheduler) Stop(ctx context.Context, instanceID string) error {
+	s.stopped = append(s.stopped, instanceID)
+	return nil
+}
+
+func TestRestart_StopsInstances(t *testing.T) {
+	s := &stopScheduler{
+		instances: []*Instance{
+			{ID: "a", Process: &Process{Type: "web"}},
+			{ID: "b", Process: &Process{Type: "worker"}},
+			{ID: "c", Process: &Process{Type: "web"}},
+		},
+	}
+
+	if err := Restart(context.Background(), s, "1234", "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.stopped, []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stopped => %v; want %v", got, want)
+	}
+}
+
+func TestCanariesSupported(t *testing.T) {
+	tests := []struct {
+		scheduler Scheduler
+		out       bool
+	}{
+		{&stopScheduler{}, false},
+		{NewFakeScheduler(), true},
+		{&AttachedRunner{Scheduler: &stopScheduler{}}, false},
+		{&AttachedRunner{Scheduler: &canaryScheduler{}}, true},
+		{&canaryScheduler{}, true},
+	}
+
+	for _, tt := range tests {
+		if got := CanariesSupported(tt.scheduler); got != tt.out {
+			t.Errorf("CanariesSupported(%T) => %v; want %v", tt.scheduler, got, tt.out)
+		}
+	}
+}
+
+// canaryScheduler is a Scheduler that implements the CanarySubmitter
+// interface.
+type canaryScheduler struct {
+	Scheduler
+}
+
+func (s *canaryScheduler) SubmitCanary(ctx context.Context, app *App) error {
+	return nil
+}
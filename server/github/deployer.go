@@ -85,6 +85,7 @@ func (d *empireDeployer) Deploy(ctx context.Context, p events.Deployment, w io.W
 		Image:  img,
 		Output: w,
 		User:   &empire.User{Name: p.Deployment.Creator.Login},
+		Source: empire.SourceGitHub,
 	})
 
 	return err
@@ -0,0 +1,154 @@
+package heroku
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/remind101/empire"
+	"github.com/remind101/empire/pkg/image"
+	"github.com/remind101/pkg/httpx"
+	"golang.org/x/net/context"
+)
+
+// AppSetup represents the setup of an app from an image's app.json manifest.
+// Its ID is the ID of the app's first deployment.
+type AppSetup struct {
+	ID  string `json:"id"`
+	App struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"app"`
+	Status         string     `json:"status"`
+	FailureMessage *string    `json:"failure_message"`
+	CreatedAt      *time.Time `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+}
+
+func newAppSetup(d *empire.Deployment) *AppSetup {
+	s := &AppSetup{
+		ID:             d.ID,
+		Status:         "pending",
+		FailureMessage: d.Error,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.CreatedAt,
+	}
+
+	switch d.Status {
+	case empire.StatusSuccess:
+		s.Status = "succeeded"
+	case empire.StatusFailed:
+		s.Status = "failed"
+	}
+
+	if d.FinishedAt != nil {
+		s.UpdatedAt = d.FinishedAt
+	}
+
+	if d.App != nil {
+		s.App.ID = d.App.ID
+		s.App.Name = d.App.Name
+	}
+
+	return s
+}
+
+// PostAppSetupsForm is the form object that represents the POST body, which
+// is compatible with the Heroku Platform API.
+type PostAppSetupsForm struct {
+	App struct {
+		Name string `json:"name"`
+	} `json:"app"`
+
+	// The URL of the source blob is the docker image to deploy (e.g.
+	// remind101/acme-inc:latest).
+	SourceBlob struct {
+		URL string `json:"url"`
+	} `json:"source_blob"`
+
+	Overrides struct {
+		Env map[string]string `json:"env"`
+	} `json:"overrides"`
+}
+
+// AppSetupOpts returns the empire.AppSetupOpts for the form.
+func (f *PostAppSetupsForm) AppSetupOpts(ctx context.Context) (*empire.AppSetupOpts, error) {
+	img, err := image.Decode(strings.TrimPrefix(f.SourceBlob.URL, "docker://"))
+	if err != nil {
+		return nil, &empire.ValidationError{Err: fmt.Errorf("source_blob: invalid image %q: %v", f.SourceBlob.URL, err)}
+	}
+
+	if img.Tag == "" && img.Digest == "" {
+		img.Tag = "latest"
+	}
+
+	user, _ := empire.UserFromContext(ctx)
+
+	opts := empire.AppSetupOpts{
+		Name:  f.App.Name,
+		Image: img,
+		User:  user,
+	}
+
+	if len(f.Overrides.Env) > 0 {
+		opts.Vars = make(empire.Vars)
+		for k, v := range f.Overrides.Env {
+			v := v
+			opts.Vars[empire.Variable(k)] = &v
+		}
+	}
+
+	return &opts, nil
+}
+
+// PostAppSetups is a Handler for the POST /app-setups endpoint, which creates
+// an app and deploys an image to it, using the image's app.json manifest to
+// set up the app.
+type PostAppSetups struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *PostAppSetups) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var form PostAppSetupsForm
+
+	if err := Decode(r, &form); err != nil {
+		return err
+	}
+
+	opts, err := form.AppSetupOpts(ctx)
+	if err != nil {
+		return err
+	}
+
+	d, err := h.AppSetup(ctx, *opts)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(202)
+	return Encode(w, newAppSetup(d))
+}
+
+// GetAppSetup is a Handler for the GET /app-setups/{id} endpoint.
+type GetAppSetup struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *GetAppSetup) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := httpx.Vars(ctx)["id"]
+
+	d, err := h.DeploymentsFirst(empire.DeploymentsQuery{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	if d.Source != empire.SourceAppSetup {
+		return ErrNotFound
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newAppSetup(d))
+}
@@ -85,13 +85,7 @@ func (h *DeployApp) ServeHTTPContext(ctx context.Context, w http.ResponseWriter,
 		return err
 	}
 
-	opts, err := newDeploymentsCreateOpts(ctx, w, r)
-	opts.App = a
-	if err != nil {
-		return err
-	}
-	h.Deploy(ctx, *opts)
-	return nil
+	return deploy(ctx, h.Empire, a, w, r)
 }
 
 type PostAppsForm struct {
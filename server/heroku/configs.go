@@ -42,6 +42,21 @@ func (h *PatchConfigs) ServeHTTPContext(ctx context.Context, w http.ResponseWrit
 		return err
 	}
 
+	dry, err := dryRun(r)
+	if err != nil {
+		return err
+	}
+
+	if dry {
+		plan, err := h.ConfigsApplyPlan(ctx, a, configVars)
+		if err != nil {
+			return err
+		}
+
+		w.WriteHeader(200)
+		return Encode(w, newPlan(plan))
+	}
+
 	// Update the config
 	c, err := h.ConfigsApply(ctx, a, configVars)
 	if err != nil {
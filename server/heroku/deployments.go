@@ -1,15 +1,122 @@
 package heroku
 
 import (
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/remind101/empire/pkg/image"
 	streamhttp "github.com/remind101/empire/pkg/stream/http"
 
 	"github.com/remind101/empire"
+	"github.com/remind101/pkg/httpx"
 	"golang.org/x/net/context"
 )
 
+// Deployment represents a deployment of an image to an app.
+type Deployment struct {
+	ID  string `json:"id"`
+	App struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"app"`
+	Image   string  `json:"image"`
+	User    string  `json:"user"`
+	Source  string  `json:"source"`
+	Status  string  `json:"status"`
+	Error   *string `json:"error"`
+	Release *struct {
+		ID      string `json:"id"`
+		Version int    `json:"version"`
+	} `json:"release"`
+	CreatedAt  *time.Time `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func newDeployment(d *empire.Deployment) *Deployment {
+	deployment := &Deployment{
+		ID:         d.ID,
+		Image:      d.Image.String(),
+		User:       d.UserName,
+		Source:     d.Source,
+		Status:     d.Status,
+		Error:      d.Error,
+		CreatedAt:  d.CreatedAt,
+		FinishedAt: d.FinishedAt,
+	}
+
+	if d.App != nil {
+		deployment.App.ID = d.App.ID
+		deployment.App.Name = d.App.Name
+	}
+
+	if d.Release != nil {
+		deployment.Release = &struct {
+			ID      string `json:"id"`
+			Version int    `json:"version"`
+		}{
+			ID:      d.Release.ID,
+			Version: d.Release.Version,
+		}
+	}
+
+	return deployment
+}
+
+func newDeployments(ds []*empire.Deployment) []*Deployment {
+	deployments := make([]*Deployment, len(ds))
+
+	for i := 0; i < len(ds); i++ {
+		deployments[i] = newDeployment(ds[i])
+	}
+
+	return deployments
+}
+
+// GetDeployments is a Handler for the GET /apps/{app}/deploys endpoint.
+type GetDeployments struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *GetDeployments) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	a, err := findApp(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	rangeHeader, err := RangeHeader(r)
+	if err != nil {
+		return err
+	}
+
+	ds, err := h.Deployments(empire.DeploymentsQuery{App: a, Range: rangeHeader})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newDeployments(ds))
+}
+
+// GetDeployment is a Handler for the GET /deploys/{id} endpoint.
+type GetDeployment struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *GetDeployment) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := httpx.Vars(ctx)["id"]
+
+	d, err := h.DeploymentsFirst(empire.DeploymentsQuery{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newDeployment(d))
+}
+
 // PostDeploys is a Handler for the POST /v1/deploys endpoint.
 type PostDeploys struct {
 	*empire.Empire
@@ -18,40 +125,220 @@ type PostDeploys struct {
 // PostDeployForm is the form object that represents the POST body.
 type PostDeployForm struct {
 	Image image.Image
+
+	// If true, the response will stream the progress of the deployment
+	// until the new release is stable.
+	Wait bool
+
+	// If true, the deployment is performed in the background, and the
+	// response is the pending deployment. The output can be retrieved
+	// from the GET /deploys/{id}/output endpoint.
+	Async bool
+
+	// If provided, the new release will be run as a canary.
+	Canary *PostDeployCanaryForm
+
+	// If provided, config vars to set (or unset, if null) in the same
+	// release as the new image.
+	Config empire.Vars
+
+	// If provided, formation changes to apply in the same release as the
+	// new image.
+	Formation []struct {
+		Process  empire.ProcessType  `json:"process"`
+		Quantity int                 `json:"quantity"`
+		Size     *empire.Constraints `json:"size"`
+	}
+}
+
+// PostDeployCanaryForm is the form object for running a deployment as a
+// canary. Exactly one of Instances or Percent should be provided.
+type PostDeployCanaryForm struct {
+	Instances int `json:"instances"`
+	Percent   int `json:"percent"`
+
+	// If provided, a duration (e.g. "10m") after which the canary will
+	// be promoted automatically.
+	BakeTime string `json:"bake_time"`
+}
+
+// CanaryOpts returns the empire.CanaryOpts for the form.
+func (f *PostDeployCanaryForm) CanaryOpts() (*empire.CanaryOpts, error) {
+	opts := &empire.CanaryOpts{
+		Instances: f.Instances,
+		Percent:   f.Percent,
+	}
+
+	if f.BakeTime != "" {
+		d, err := time.ParseDuration(f.BakeTime)
+		if err != nil {
+			return nil, &empire.ValidationError{Err: err}
+		}
+		opts.BakeTime = d
+	}
+
+	return opts, nil
 }
 
 // ServeHTTPContext implements the Handler interface.
 func (h *PostDeploys) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
-	opts, err := newDeploymentsCreateOpts(ctx, w, req)
+	return deploy(ctx, h.Empire, nil, w, req)
+}
+
+// deploy deploys the image in the request body to the app, or to the app
+// for the image's repo if app is nil. The output is streamed in the response,
+// unless the deploy is async, or a dry run.
+func deploy(ctx context.Context, e *empire.Empire, app *empire.App, w http.ResponseWriter, req *http.Request) error {
+	var form PostDeployForm
+
+	if err := Decode(req, &form); err != nil {
+		return err
+	}
+
+	opts, err := form.DeploymentsCreateOpts(ctx)
 	if err != nil {
 		return err
 	}
+	opts.App = app
 
-	// We ignore errors here since this is a streaming endpoint,
-	// and the error is handled in the response message
-	_, _ = h.Deploy(ctx, *opts)
-	return nil
-}
+	dry, err := dryRun(req)
+	if err != nil {
+		return err
+	}
 
-func newDeploymentsCreateOpts(ctx context.Context, w http.ResponseWriter, req *http.Request) (*empire.DeploymentsCreateOpts, error) {
-	var form PostDeployForm
+	if dry {
+		plan, err := e.DeployPlan(ctx, *opts)
+		if err != nil {
+			return err
+		}
 
-	if err := Decode(req, &form); err != nil {
-		return nil, err
+		w.WriteHeader(200)
+		return Encode(w, newPlan(plan))
+	}
+
+	if form.Async {
+		d, err := e.DeployAsync(ctx, *opts)
+		if err != nil {
+			return err
+		}
+
+		w.WriteHeader(202)
+		return Encode(w, newDeployment(d))
 	}
 
 	w.Header().Set("Content-Type", "application/json; boundary=NL")
+	opts.Output = streamhttp.StreamingResponseWriter(w)
+
+	// We ignore errors here since this is a streaming endpoint,
+	// and the error is handled in the response message
+	_, _ = e.Deploy(ctx, *opts)
+	return nil
+}
 
-	if form.Image.Tag == "" && form.Image.Digest == "" {
-		form.Image.Tag = "latest"
+// DeploymentsCreateOpts returns the empire.DeploymentsCreateOpts for the
+// form, without an Output.
+func (f *PostDeployForm) DeploymentsCreateOpts(ctx context.Context) (*empire.DeploymentsCreateOpts, error) {
+	if f.Image.Tag == "" && f.Image.Digest == "" {
+		f.Image.Tag = "latest"
 	}
 
 	user, _ := empire.UserFromContext(ctx)
 
 	opts := empire.DeploymentsCreateOpts{
-		Image:  form.Image,
-		Output: streamhttp.StreamingResponseWriter(w),
+		Image:  f.Image,
 		User:   user,
+		Source: empire.SourceAPI,
+		Wait:   f.Wait,
+		Vars:   f.Config,
 	}
+
+	for _, up := range f.Formation {
+		opts.Formation = append(opts.Formation, &empire.FormationUpdate{
+			Process:     up.Process,
+			Quantity:    up.Quantity,
+			Constraints: up.Size,
+		})
+	}
+
+	if f.Canary != nil {
+		canary, err := f.Canary.CanaryOpts()
+		if err != nil {
+			return nil, err
+		}
+		opts.Canary = canary
+	}
+
 	return &opts, nil
 }
+
+// GetDeploymentOutput is a Handler for the GET /deploys/{id}/output endpoint,
+// which returns the jsonmessage output of a deployment so far.
+type GetDeploymentOutput struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *GetDeploymentOutput) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := httpx.Vars(ctx)["id"]
+
+	d, err := h.DeploymentsFirst(empire.DeploymentsQuery{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	output, err := h.DeploymentsOutput(d)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json; boundary=NL")
+	w.WriteHeader(200)
+	_, err = io.WriteString(w, output)
+	return err
+}
+
+// PostDeploymentPromote is a Handler for the POST /deploys/{id}/promote
+// endpoint, which promotes a canary deployment.
+type PostDeploymentPromote struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *PostDeploymentPromote) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := httpx.Vars(ctx)["id"]
+
+	d, err := h.DeploymentsFirst(empire.DeploymentsQuery{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	if err := h.DeploymentsPromote(ctx, d); err != nil {
+		return err
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newDeployment(d))
+}
+
+// PostDeploymentAbort is a Handler for the POST /deploys/{id}/abort endpoint,
+// which aborts a canary deployment.
+type PostDeploymentAbort struct {
+	*empire.Empire
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *PostDeploymentAbort) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := httpx.Vars(ctx)["id"]
+
+	d, err := h.DeploymentsFirst(empire.DeploymentsQuery{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	if err := h.DeploymentsAbort(ctx, d); err != nil {
+		return err
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newDeployment(d))
+}
@@ -30,6 +30,11 @@ var (
 		ID:      "not_found",
 		Message: "Request failed, the specified resource does not exist",
 	}
+	ErrConflict = &ErrorResource{
+		Status:  http.StatusConflict,
+		ID:      "conflict",
+		Message: "Request failed, another operation is in progress for this app. Try again later",
+	}
 	ErrTwoFactor = &ErrorResource{
 		Status:  http.StatusUnauthorized,
 		ID:      "two_factor",
@@ -50,6 +55,10 @@ func newError(err error) *ErrorResource {
 		return ErrNotFound
 	}
 
+	if err == empire.ErrAppLocked {
+		return ErrConflict
+	}
+
 	switch err := err.(type) {
 	case *ErrorResource:
 		return err
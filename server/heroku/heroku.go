@@ -27,18 +27,32 @@ func New(e *empire.Empire, auth authorization.Authorizer) httpx.Handler {
 	r.Handle("/apps", Authenticate(e, &PostApps{e})).Methods("POST")                // hk create
 	r.Handle("/organizations/apps", Authenticate(e, &PostApps{e})).Methods("POST")  // hk create
 
+	// App setups
+	r.Handle("/app-setups", Authenticate(e, &PostAppSetups{e})).Methods("POST")   // Set up an app from an app.json
+	r.Handle("/app-setups/{id}", Authenticate(e, &GetAppSetup{e})).Methods("GET") // App setup status
+
 	// Domains
 	r.Handle("/apps/{app}/domains", Authenticate(e, &GetDomains{e})).Methods("GET")                 // hk domains
 	r.Handle("/apps/{app}/domains", Authenticate(e, &PostDomains{e})).Methods("POST")               // hk domain-add
 	r.Handle("/apps/{app}/domains/{hostname}", Authenticate(e, &DeleteDomain{e})).Methods("DELETE") // hk domain-remove
 
 	// Deploys
-	r.Handle("/deploys", Authenticate(e, &PostDeploys{e})).Methods("POST") // Deploy an app
+	r.Handle("/deploys", Authenticate(e, &PostDeploys{e})).Methods("POST")                        // Deploy an app
+	r.Handle("/apps/{app}/deploys", Authenticate(e, &GetDeployments{e})).Methods("GET")           // Deployment history
+	r.Handle("/deploys/{id}", Authenticate(e, &GetDeployment{e})).Methods("GET")                  // Deployment status
+	r.Handle("/deploys/{id}/output", Authenticate(e, &GetDeploymentOutput{e})).Methods("GET")     // Deployment output
+	r.Handle("/deploys/{id}/promote", Authenticate(e, &PostDeploymentPromote{e})).Methods("POST") // Promote a canary
+	r.Handle("/deploys/{id}/abort", Authenticate(e, &PostDeploymentAbort{e})).Methods("POST")     // Abort a canary
 
 	// Releases
 	r.Handle("/apps/{app}/releases", Authenticate(e, &GetReleases{e})).Methods("GET")          // hk releases
 	r.Handle("/apps/{app}/releases/{version}", Authenticate(e, &GetRelease{e})).Methods("GET") // hk release-info
 	r.Handle("/apps/{app}/releases", Authenticate(e, &PostReleases{e})).Methods("POST")        // hk rollback
+	r.Handle("/apps/{app}/releases/{version}/diff", Authenticate(e, &GetReleaseDiff{e})).Methods("GET")
+	r.Handle("/apps/{app}/releases/{version}", Authenticate(e, &PatchRelease{e})).Methods("PATCH")
+
+	// Promotions
+	r.Handle("/apps/{app}/promotions", Authenticate(e, &PostPromotions{e})).Methods("POST") // Promote a release from another app
 
 	// Configs
 	r.Handle("/apps/{app}/config-vars", Authenticate(e, &GetConfigs{e})).Methods("GET")     // hk env, hk get
@@ -0,0 +1,118 @@
+package heroku
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/remind101/empire"
+	"github.com/remind101/empire/scheduler"
+)
+
+// Plan represents what a deploy, rollback or config change would do, when
+// it's requested as a dry run.
+type Plan struct {
+	// The release that would be created, if any.
+	Release *struct {
+		Version     int    `json:"version"`
+		Description string `json:"description"`
+	} `json:"release"`
+
+	// What would change compared to the current release.
+	Diff *ReleaseDiff `json:"diff"`
+
+	// The changes that the scheduler would make, if it supports planning.
+	Scheduler *SchedulerPlan `json:"scheduler"`
+}
+
+// SchedulerPlan represents the changes that the scheduler would make.
+type SchedulerPlan struct {
+	Processes []*ProcessPlan `json:"processes"`
+}
+
+// ProcessPlan represents the changes that the scheduler would make to a
+// process.
+type ProcessPlan struct {
+	Type    string `json:"type"`
+	Action  string `json:"action"`
+	Command *struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"command,omitempty"`
+	Env          []*EnvChange `json:"env,omitempty"`
+	LoadBalancer string       `json:"load_balancer,omitempty"`
+	Errors       []string     `json:"errors,omitempty"`
+}
+
+// EnvChange represents a change to an environment variable. The value is
+// never included.
+type EnvChange struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+func newPlan(p *empire.Plan) *Plan {
+	plan := &Plan{}
+
+	if p.Release != nil {
+		plan.Release = &struct {
+			Version     int    `json:"version"`
+			Description string `json:"description"`
+		}{p.Release.Version, p.Release.Description}
+	}
+
+	if p.Diff != nil {
+		plan.Diff = newReleaseDiff(p.Diff)
+	}
+
+	if p.Scheduler != nil {
+		plan.Scheduler = newSchedulerPlan(p.Scheduler)
+	}
+
+	return plan
+}
+
+func newSchedulerPlan(p *scheduler.Plan) *SchedulerPlan {
+	plan := &SchedulerPlan{
+		Processes: []*ProcessPlan{},
+	}
+
+	for _, p := range p.Processes {
+		pp := &ProcessPlan{
+			Type:         p.Type,
+			Action:       p.Action,
+			LoadBalancer: p.LoadBalancer,
+			Errors:       p.Errors,
+		}
+
+		if p.Command != nil {
+			pp.Command = &struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			}{p.Command.From, p.Command.To}
+		}
+
+		for _, e := range p.Env {
+			pp.Env = append(pp.Env, &EnvChange{Name: e.Name, Change: e.Change})
+		}
+
+		plan.Processes = append(plan.Processes, pp)
+	}
+
+	return plan
+}
+
+// dryRun returns true if the request has the `dry_run` query parameter set,
+// which means that a plan should be returned instead of making changes.
+func dryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+
+	dry, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &empire.ValidationError{Err: err}
+	}
+
+	return dry, nil
+}
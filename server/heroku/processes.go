@@ -100,12 +100,13 @@ func (h *PostProcess) ServeHTTPContext(ctx context.Context, w http.ResponseWrite
 		opts.Input = inStream
 		opts.Output = outStream
 
-		if err := h.ProcessesRun(ctx, a, opts); err != nil {
+		if _, err := h.ProcessesRun(ctx, a, opts); err != nil {
 			fmt.Fprintf(outStream, "%v", err)
 			return nil
 		}
 	} else {
-		if err := h.ProcessesRun(ctx, a, opts); err != nil {
+		state, err := h.ProcessesRun(ctx, a, opts)
+		if err != nil {
 			return err
 		}
 
@@ -115,6 +116,12 @@ func (h *PostProcess) ServeHTTPContext(ctx context.Context, w http.ResponseWrite
 			CreatedAt: timex.Now(),
 		}
 
+		if state != nil {
+			dyno.Name = state.Name
+			dyno.Type = state.Type
+			dyno.State = state.State
+		}
+
 		w.WriteHeader(201)
 		return Encode(w, dyno)
 	}
@@ -130,8 +137,9 @@ func (h *DeleteProcesses) ServeHTTPContext(ctx context.Context, w http.ResponseW
 	vars := httpx.Vars(ctx)
 	pid := vars["pid"]
 
+	// e.g. `hk restart web.3`
 	if vars["ptype"] != "" {
-		return errNotImplemented("Restarting a process type is currently not implemented.")
+		pid = fmt.Sprintf("%s.%s", vars["ptype"], pid)
 	}
 
 	a, err := findApp(ctx, h)
@@ -0,0 +1,68 @@
+package heroku
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/remind101/empire"
+	"golang.org/x/net/context"
+)
+
+// PostPromotions is a Handler for the POST /apps/{app}/promotions endpoint,
+// which promotes a release from another app to this app.
+type PostPromotions struct {
+	*empire.Empire
+}
+
+// PostPromotionsForm is the form object that represents the POST body.
+type PostPromotionsForm struct {
+	// The name of the app to promote the release from.
+	Source string `json:"source"`
+
+	// If provided, the version of the source app's release to promote.
+	// Defaults to the current release.
+	Version string `json:"release"`
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *PostPromotions) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var form PostPromotionsForm
+
+	if err := Decode(r, &form); err != nil {
+		return err
+	}
+
+	target, err := findApp(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	source, err := h.AppsFirst(empire.AppsQuery{Name: &form.Source})
+	if err != nil {
+		return err
+	}
+
+	user, _ := empire.UserFromContext(ctx)
+
+	opts := empire.PromotionsCreateOpts{
+		Source: source,
+		Target: target,
+		User:   user,
+	}
+
+	if form.Version != "" {
+		version, err := strconv.Atoi(form.Version)
+		if err != nil {
+			return &empire.ValidationError{Err: err}
+		}
+		opts.Version = version
+	}
+
+	release, err := h.Promote(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(201)
+	return Encode(w, newRelease(release))
+}
@@ -10,20 +10,47 @@ import (
 	"golang.org/x/net/context"
 )
 
-type Release heroku.Release
+type Release struct {
+	heroku.Release
+
+	// Slug includes the image that was requested, and the pinned image
+	// that it resolved to.
+	Slug *ReleaseSlug `json:"slug"`
+
+	// Pinned releases are never garbage collected.
+	Pinned bool `json:"pinned"`
+}
+
+// ReleaseSlug represents the slug running in a release.
+type ReleaseSlug struct {
+	Id             string `json:"id"`
+	Image          string `json:"image,omitempty"`
+	RequestedImage string `json:"requested_image,omitempty"`
+}
 
 func newRelease(r *empire.Release) *Release {
-	return &Release{
-		Id:      r.ID,
-		Version: r.Version,
-		Slug: &struct {
-			Id string `json:"id"`
-		}{
+	release := &Release{
+		Release: heroku.Release{
+			Id:          r.ID,
+			Version:     r.Version,
+			Description: r.Description,
+			CreatedAt:   *r.CreatedAt,
+		},
+		Slug: &ReleaseSlug{
 			Id: r.SlugID,
 		},
-		Description: r.Description,
-		CreatedAt:   *r.CreatedAt,
+		Pinned: r.Pinned,
 	}
+
+	if r.Slug != nil {
+		release.Slug.Image = r.Slug.Image.String()
+	}
+
+	if r.RequestedImage.Repository != "" {
+		release.Slug.RequestedImage = r.RequestedImage.String()
+	}
+
+	return release
 }
 
 func newReleases(rs []*empire.Release) []*Release {
@@ -61,6 +88,49 @@ func (h *GetRelease) ServeHTTPContext(ctx context.Context, w http.ResponseWriter
 	return Encode(w, newRelease(rel))
 }
 
+// PatchRelease is a Handler for the PATCH /apps/{app}/releases/{version}
+// endpoint, which pins or unpins a release.
+type PatchRelease struct {
+	*empire.Empire
+}
+
+// PatchReleaseForm is the form object that represents the PATCH body.
+type PatchReleaseForm struct {
+	Pinned bool `json:"pinned"`
+}
+
+// ServeHTTPContext implements the Handler interface.
+func (h *PatchRelease) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var form PatchReleaseForm
+
+	if err := Decode(r, &form); err != nil {
+		return err
+	}
+
+	a, err := findApp(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	vars := httpx.Vars(ctx)
+	vers, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		return err
+	}
+
+	rel, err := h.ReleasesFirst(empire.ReleasesQuery{App: a, Version: &vers})
+	if err != nil {
+		return err
+	}
+
+	if err := h.ReleasesPin(ctx, rel, form.Pinned); err != nil {
+		return err
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newRelease(rel))
+}
+
 type GetReleases struct {
 	*empire.Empire
 }
@@ -85,12 +155,144 @@ func (h *GetReleases) ServeHTTPContext(ctx context.Context, w http.ResponseWrite
 	return Encode(w, newReleases(rels))
 }
 
+// ReleaseDiff represents the changes between two releases.
+type ReleaseDiff struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Image *struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"image"`
+	ConfigVars []*ConfigVarDiff `json:"config_vars"`
+	Processes  []*ProcessDiff   `json:"processes"`
+}
+
+// ConfigVarDiff represents a change to a config var. The value is never
+// included.
+type ConfigVarDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// ProcessDiff represents a change to a process type.
+type ProcessDiff struct {
+	Type    string `json:"type"`
+	Change  string `json:"change"`
+	Command *struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"command,omitempty"`
+	Quantity *struct {
+		From int `json:"from"`
+		To   int `json:"to"`
+	} `json:"quantity,omitempty"`
+	Size *struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"size,omitempty"`
+}
+
+func newReleaseDiff(d *empire.ReleaseDiff) *ReleaseDiff {
+	diff := &ReleaseDiff{
+		From:       d.From,
+		To:         d.To,
+		ConfigVars: []*ConfigVarDiff{},
+		Processes:  []*ProcessDiff{},
+	}
+
+	if d.Image != nil {
+		diff.Image = &struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		}{d.Image.From.String(), d.Image.To.String()}
+	}
+
+	for _, v := range d.Vars {
+		diff.ConfigVars = append(diff.ConfigVars, &ConfigVarDiff{
+			Name:   string(v.Name),
+			Change: v.Change,
+		})
+	}
+
+	for _, p := range d.Processes {
+		pd := &ProcessDiff{
+			Type:   string(p.Type),
+			Change: p.Change,
+		}
+
+		if p.Command != nil {
+			pd.Command = &struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			}{string(p.Command.From), string(p.Command.To)}
+		}
+
+		if p.Quantity != nil {
+			pd.Quantity = &struct {
+				From int `json:"from"`
+				To   int `json:"to"`
+			}{p.Quantity.From, p.Quantity.To}
+		}
+
+		if p.Constraints != nil {
+			pd.Size = &struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			}{p.Constraints.From.String(), p.Constraints.To.String()}
+		}
+
+		diff.Processes = append(diff.Processes, pd)
+	}
+
+	return diff
+}
+
+// GetReleaseDiff is a Handler for the GET /apps/{app}/releases/{version}/diff
+// endpoint. By default, the release is compared to the previous version. The
+// `from` query parameter can be used to compare against a different version.
+type GetReleaseDiff struct {
+	*empire.Empire
+}
+
+func (h *GetReleaseDiff) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	a, err := findApp(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	vars := httpx.Vars(ctx)
+	to, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		return err
+	}
+
+	from := to - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	diff, err := h.ReleasesDiff(a, from, to)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(200)
+	return Encode(w, newReleaseDiff(diff))
+}
+
 type PostReleases struct {
 	*empire.Empire
 }
 
 type PostReleasesForm struct {
 	Version string `json:"release"`
+
+	// If true, the quantity and size of each process are restored from
+	// the release that's being rolled back to.
+	RestoreFormation bool `json:"restore_formation"`
 }
 
 func (p *PostReleasesForm) ReleaseVersion() (int, error) {
@@ -102,6 +304,13 @@ func (p *PostReleasesForm) ReleaseVersion() (int, error) {
 	return vers, nil
 }
 
+// RollbackOpts returns the empire.RollbackOpts for the form.
+func (p *PostReleasesForm) RollbackOpts() empire.RollbackOpts {
+	return empire.RollbackOpts{
+		RestoreFormation: p.RestoreFormation,
+	}
+}
+
 func (h *PostReleases) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	var form PostReleasesForm
 
@@ -119,7 +328,22 @@ func (h *PostReleases) ServeHTTPContext(ctx context.Context, w http.ResponseWrit
 		return err
 	}
 
-	release, err := h.ReleasesRollback(ctx, app, version)
+	dry, err := dryRun(r)
+	if err != nil {
+		return err
+	}
+
+	if dry {
+		plan, err := h.ReleasesRollbackPlan(ctx, app, version, form.RollbackOpts())
+		if err != nil {
+			return err
+		}
+
+		w.WriteHeader(200)
+		return Encode(w, newPlan(plan))
+	}
+
+	release, err := h.ReleasesRollback(ctx, app, version, form.RollbackOpts())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,82 @@
+package empire
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/pkg/image"
+	"golang.org/x/net/context"
+)
+
+// AppSetupOpts represents options that can be passed when setting up a new app
+// from an image.
+type AppSetupOpts struct {
+	// If provided, the name of the app to create. The zero value is the
+	// name of the image's repository.
+	Name string
+
+	// The image to deploy. Its app.json manifest is used to set up the
+	// app.
+	Image image.Image
+
+	// The user that's setting up the app.
+	User *User
+
+	// If provided, config vars to set, which take precedence over the
+	// defaults in the app.json manifest.
+	Vars Vars
+}
+
+// appSetupsService creates an app and deploys an image to it for the first
+// time, which sets the app up from the image's app.json manifest.
+type appSetupsService struct {
+	store    *store
+	slugs    *slugsService
+	deployer deployer
+}
+
+// Setup creates the app, and deploys the image to it in the background. The
+// returned Deployment can be polled to find out when the app is set up.
+//
+// The image's app.json is checked before the app is created, so that an app
+// isn't left behind when required config vars are missing, or the image
+// can't be extracted.
+func (s *appSetupsService) Setup(ctx context.Context, opts AppSetupOpts) (*Deployment, error) {
+	name := opts.Name
+	if name == "" {
+		name = AppNameFromRepo(opts.Image.Repository)
+	}
+
+	if _, err := s.store.AppsFirst(AppsQuery{Name: &name}); err != gorm.RecordNotFound {
+		if err != nil {
+			return nil, err
+		}
+		return nil, &ValidationError{Err: fmt.Errorf("app %s already exists", name)}
+	}
+
+	slug, err := s.slugs.SlugsExtractByImage(ctx, opts.Image, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := setupOpts(&Config{}, slug, DeploymentsCreateOpts{Vars: opts.Vars}); err != nil {
+		return nil, err
+	}
+
+	repo := opts.Image.Repository
+	app, err := s.store.AppsCreate(&App{Name: name, Repo: &repo})
+	if err != nil {
+		return nil, err
+	}
+
+	// Deploy the resolved image, so that the image that was checked is the
+	// one that's deployed.
+	return s.deployer.DeployAsync(ctx, DeploymentsCreateOpts{
+		App:    app,
+		Image:  slug.Image,
+		User:   opts.User,
+		Source: SourceAppSetup,
+		Vars:   opts.Vars,
+	})
+}
@@ -10,9 +10,55 @@ import (
 
 // Slug represents a container image with the extracted ProcessType.
 type Slug struct {
-	ID           string
-	Image        image.Image
+	ID string
+
+	// The image that will be run. This is the image that was requested,
+	// pinned to the canonical digest or id returned by the Resolver, so
+	// that re-pushing a tag doesn't change what's running.
+	Image image.Image
+
 	ProcessTypes CommandMap
+
+	// The process definitions from the Procfile, including any settings
+	// from the extended Procfile format.
+	Procfile Procfile
+
+	// The app.json manifest from the image, which is used to set up the
+	// app when it's first deployed. The zero value if there isn't one.
+	Manifest AppManifest
+}
+
+// slugProcfile returns the process definitions of the slug, or nil if there's
+// no slug.
+func slugProcfile(s *Slug) Procfile {
+	if s == nil {
+		return nil
+	}
+	return s.Procfile
+}
+
+// SlugsQuery is a Scope implementation for common things to filter slugs
+// by.
+type SlugsQuery struct {
+	// If provided, finds the slug for the given image.
+	Image *image.Image
+}
+
+// Scope implements the Scope interface.
+func (q SlugsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.Image != nil {
+		scope = append(scope, FieldEquals("image", q.Image.String()))
+	}
+
+	return scope.Scope(db)
+}
+
+// SlugsFirst returns the first matching slug.
+func (s *store) SlugsFirst(scope Scope) (*Slug, error) {
+	var slug Slug
+	return &slug, s.First(scope, &slug)
 }
 
 // SlugsCreate persists the slug.
@@ -37,21 +83,69 @@ func (s *slugsService) SlugsCreateByImage(ctx context.Context, img image.Image,
 	return slugsCreateByImage(ctx, s.store, s.extractor, s.resolver, img, out)
 }
 
+// SlugsPlanByImage returns the Slug that SlugsCreateByImage would return for
+// the image, without persisting it, or pulling the image.
+func (s *slugsService) SlugsPlanByImage(ctx context.Context, img image.Image, out io.Writer) (*Slug, error) {
+	return slugsFindOrExtract(ctx, s.store, s.extractor, s.resolver, img, out, false)
+}
+
+// SlugsExtractByImage returns the Slug that SlugsCreateByImage would return for
+// the image, without persisting it. Unlike SlugsPlanByImage, the image is
+// pulled.
+func (s *slugsService) SlugsExtractByImage(ctx context.Context, img image.Image, out io.Writer) (*Slug, error) {
+	return slugsFindOrExtract(ctx, s.store, s.extractor, s.resolver, img, out, true)
+}
+
 // SlugsCreateByImage first attempts to find a matching slug for the image. If
 // it's not found, it will fallback to extracting the process types using the
 // provided extractor, then create a slug.
 func slugsCreateByImage(ctx context.Context, store *store, e Extractor, r Resolver, img image.Image, out io.Writer) (*Slug, error) {
-	_, err := r.Resolve(ctx, img, out)
+	slug, err := slugsFindOrExtract(ctx, store, e, r, img, out, true)
+	if err != nil || slug.ID != "" {
+		return slug, err
+	}
+
+	return store.SlugsCreate(slug)
+}
+
+// slugsFindOrExtract resolves the image, and returns the existing slug for it
+// if there is one. Otherwise, the process types are extracted into a new Slug,
+// which isn't persisted. If pull is false, the image is resolved without
+// pulling it.
+func slugsFindOrExtract(ctx context.Context, store *store, e Extractor, r Resolver, img image.Image, out io.Writer, pull bool) (*Slug, error) {
+	var (
+		resolved image.Image
+		err      error
+	)
+	if pull {
+		resolved, err = r.Resolve(ctx, img, out)
+	} else {
+		resolved, err = resolveLocal(ctx, r, img, out)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	slug, err := slugsExtract(e, img)
+	// If the image is pinned to a digest, the contents of the image can't
+	// change, so we can re-use the process types that were already
+	// extracted.
+	if resolved.Digest != "" {
+		slug, err := store.SlugsFirst(SlugsQuery{Image: &resolved})
+		if err == nil {
+			return slug, nil
+		}
+
+		if err != gorm.RecordNotFound {
+			return nil, err
+		}
+	}
+
+	slug, err := slugsExtract(e, resolved)
 	if err != nil {
 		return slug, err
 	}
 
-	return store.SlugsCreate(slug)
+	return slug, nil
 }
 
 // SlugsExtract extracts the process types from the image, then returns a new
@@ -61,12 +155,21 @@ func slugsExtract(e Extractor, img image.Image) (*Slug, error) {
 		Image: img,
 	}
 
-	pt, err := e.Extract(img)
+	pf, err := e.Extract(img)
 	if err != nil {
 		return slug, err
 	}
 
-	slug.ProcessTypes = pt
+	slug.ProcessTypes = pf.Commands()
+	slug.Procfile = pf
+
+	if me, ok := e.(ManifestExtractor); ok {
+		m, err := me.ExtractManifest(img)
+		if err != nil {
+			return slug, err
+		}
+		slug.Manifest = m
+	}
 
 	return slug, nil
 }
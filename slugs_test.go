@@ -0,0 +1,18 @@
+package empire
+
+import (
+	"testing"
+
+	"github.com/remind101/empire/pkg/image"
+)
+
+func TestSlugsQuery(t *testing.T) {
+	img := image.Image{Repository: "remind101/acme-inc", Digest: "sha256:c6f40a0ea8ec"}
+
+	tests := scopeTests{
+		{SlugsQuery{}, "", []interface{}{}},
+		{SlugsQuery{Image: &img}, "WHERE (image = $1)", []interface{}{"remind101/acme-inc@sha256:c6f40a0ea8ec"}},
+	}
+
+	tests.Run(t)
+}
@@ -0,0 +1,66 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	empireheroku "github.com/remind101/empire/server/heroku"
+)
+
+func TestAppSetup(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	var setup empireheroku.AppSetup
+	if err := c.Post(&setup, "/app-setups", map[string]interface{}{
+		"app":         map[string]string{"name": "acme-prod"},
+		"source_blob": map[string]string{"url": DefaultImage},
+		"overrides":   map[string]interface{}{"env": map[string]string{"RAILS_ENV": "production"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := setup.App.Name, "acme-prod"; got != want {
+		t.Fatalf("App => %s; want %s", got, want)
+	}
+
+	for i := 0; setup.Status == "pending"; i++ {
+		if i > 50 {
+			t.Fatal("Timed out waiting for the app setup to finish")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		if err := c.Get(&setup, "/app-setups/"+setup.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := setup.Status, "succeeded"; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	vars, err := c.ConfigVarInfo("acme-prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vars["RAILS_ENV"], "production"; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+}
+
+func TestAppSetup_AlreadyExists(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	var setup empireheroku.AppSetup
+	err := c.Post(&setup, "/app-setups", map[string]interface{}{
+		"source_blob": map[string]string{"url": DefaultImage},
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+}
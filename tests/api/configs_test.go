@@ -1,11 +1,14 @@
 package api_test
 
 import (
+	"database/sql"
 	"reflect"
 	"testing"
 
 	"github.com/bgentry/heroku-go"
+	_ "github.com/lib/pq"
 	"github.com/remind101/empire"
+	"github.com/remind101/empire/empiretest"
 )
 
 func TestConfigVarUpdate(t *testing.T) {
@@ -78,6 +81,41 @@ func TestConfigVarInfo(t *testing.T) {
 	}
 }
 
+func TestConfigVarUpdate_Locked(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	app := mustAppCreate(t, c, empire.App{
+		Name: "acme-inc",
+	})
+
+	// Hold the lock for the app, as if another operation were in
+	// progress.
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`select pg_advisory_xact_lock(3041, hashtext($1))`, app.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	env := "production"
+	_, err = c.ConfigVarUpdate("acme-inc", map[string]*string{
+		"RAILS_ENV": &env,
+	})
+	if err, ok := err.(heroku.Error); !ok || err.Id != "conflict" {
+		t.Fatalf("err => %v; want a conflict", err)
+	}
+}
+
 func mustConfigVarUpdate(t testing.TB, c *heroku.Client, appName string, options map[string]*string) map[string]string {
 	vars, err := c.ConfigVarUpdate(appName, options)
 	if err != nil {
@@ -1,10 +1,14 @@
 package api_test
 
 import (
+	"bytes"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bgentry/heroku-go"
+	empireheroku "github.com/remind101/empire/server/heroku"
 )
 
 type DeployForm struct {
@@ -18,6 +22,229 @@ func TestDeploy(t *testing.T) {
 	mustDeploy(t, c, DefaultImage)
 }
 
+func TestDeploymentsList(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	var deployments []*empireheroku.Deployment
+	if err := c.Get(&deployments, "/apps/acme-inc/deploys"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(deployments), 1; got != want {
+		t.Fatalf("len(deployments) => %d; want %d", got, want)
+	}
+
+	d := deployments[0]
+
+	if got, want := d.Status, "success"; got != want {
+		t.Errorf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := d.Source, "api"; got != want {
+		t.Errorf("Source => %s; want %s", got, want)
+	}
+
+	if d.Release == nil || d.Release.Version != 1 {
+		t.Errorf("Release => %v; want v1", d.Release)
+	}
+
+	var deployment empireheroku.Deployment
+	if err := c.Get(&deployment, "/deploys/"+d.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := deployment.ID, d.ID; got != want {
+		t.Errorf("ID => %s; want %s", got, want)
+	}
+}
+
+func TestDeploy_ReusesSlugForDigest(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	image := "remind101/acme-inc@sha256:c6f40a0ea8ec43ed8e0fc4bc0d4b9f8b7a4ec8c9b31e7a7b6e7e2b4b0f1a7e61"
+	mustDeploy(t, c, image)
+	mustDeploy(t, c, image)
+
+	releases, err := c.ReleaseList("acme-inc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(releases), 2; got != want {
+		t.Fatalf("len(releases) => %d; want %d", got, want)
+	}
+
+	if releases[0].Slug.Id != releases[1].Slug.Id {
+		t.Fatalf("expected both releases to use the same slug, got %s and %s", releases[0].Slug.Id, releases[1].Slug.Id)
+	}
+}
+
+func TestDeploy_WithConfig(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	env := "production"
+	form := map[string]interface{}{
+		"image":  DefaultImage,
+		"config": map[string]*string{"RAILS_ENV": &env},
+		"formation": []map[string]interface{}{
+			{"process": "web", "quantity": 2},
+		},
+	}
+
+	if err := c.Post(ioutil.Discard, "/deploys", &form); err != nil {
+		t.Fatal(err)
+	}
+
+	releases, err := c.ReleaseList("acme-inc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The config and formation changes should be part of the deploy,
+	// rather than separate releases.
+	if got, want := len(releases), 2; got != want {
+		t.Fatalf("len(releases) => %d; want %d", got, want)
+	}
+
+	vars := mustConfigVarInfo(t, c, "acme-inc")
+	if got, want := vars["RAILS_ENV"], "production"; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+
+	dynos, err := c.DynoList("acme-inc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(dynos), 2; got != want {
+		t.Fatalf("DynoList => %d; want %d", got, want)
+	}
+}
+
+func TestDeploy_WithConfig_Failed(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	env := "production"
+	form := map[string]interface{}{
+		"image":  DefaultImage,
+		"config": map[string]*string{"RAILS_ENV": &env},
+		"formation": []map[string]interface{}{
+			{"process": "foo", "quantity": 2},
+		},
+	}
+
+	// The deployment fails, since there's no foo process, but errors are
+	// written to the stream.
+	if err := c.Post(ioutil.Discard, "/deploys", &form); err != nil {
+		t.Fatal(err)
+	}
+
+	releases, err := c.ReleaseList("acme-inc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(releases), 0; got != want {
+		t.Fatalf("len(releases) => %d; want %d", got, want)
+	}
+
+	// The config changes shouldn't be persisted when the release isn't
+	// created.
+	vars := mustConfigVarInfo(t, c, "acme-inc")
+	if got, want := vars["RAILS_ENV"], ""; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+}
+
+func TestDeployAsync(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	var d empireheroku.Deployment
+	if err := c.Post(&d, "/deploys", map[string]interface{}{
+		"image": DefaultImage,
+		"async": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.ID == "" {
+		t.Fatal("Expected a deployment id")
+	}
+
+	for i := 0; d.Status == "pending"; i++ {
+		if i > 50 {
+			t.Fatal("Timed out waiting for the deployment to finish")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		if err := c.Get(&d, "/deploys/"+d.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := d.Status, "success"; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	// The final status message is written just after the deployment
+	// finishes.
+	output := new(bytes.Buffer)
+	for i := 0; !strings.Contains(output.String(), "Created new release v1 for acme-inc"); i++ {
+		if i > 50 {
+			t.Fatalf("Output => %q", output.String())
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		output.Reset()
+		if err := c.Get(output, "/deploys/"+d.ID+"/output"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeploy_DryRun(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	var plan empireheroku.Plan
+	if err := c.Post(&plan, "/deploys?dry_run=true", map[string]interface{}{
+		"image":  DefaultImage,
+		"config": map[string]string{"RAILS_ENV": "production"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Release == nil || plan.Release.Version != 2 {
+		t.Fatalf("Release => %v; want v2", plan.Release)
+	}
+
+	if got, want := len(plan.Diff.ConfigVars), 1; got != want {
+		t.Fatalf("len(ConfigVars) => %d; want %d", got, want)
+	}
+
+	if got, want := *plan.Diff.ConfigVars[0], (empireheroku.ConfigVarDiff{Name: "RAILS_ENV", Change: "added"}); got != want {
+		t.Fatalf("ConfigVars[0] => %v; want %v", got, want)
+	}
+
+	// Nothing should have been released.
+	if got, want := len(mustReleaseList(t, c, "acme-inc")), 1; got != want {
+		t.Fatalf("len(releases) => %d; want %d", got, want)
+	}
+}
+
 func mustDeploy(t testing.TB, c *heroku.Client, image string) {
 	var (
 		f DeployForm
@@ -29,3 +256,47 @@ func mustDeploy(t testing.TB, c *heroku.Client, image string) {
 		t.Fatal(err)
 	}
 }
+
+func TestDeployCanary_RejectsReleases(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	var d empireheroku.Deployment
+	if err := c.Post(&d, "/deploys", map[string]interface{}{
+		"image":  DefaultImage,
+		"async":  true,
+		"canary": map[string]int{"instances": 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; d.Status == "pending"; i++ {
+		if i > 50 {
+			t.Fatal("Timed out waiting for the canary to start")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		if err := c.Get(&d, "/deploys/"+d.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := d.Status, "canary"; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	// Changing the config would release the canary to every process.
+	env := "production"
+	if _, err := c.ConfigVarUpdate("acme-inc", map[string]*string{"RAILS_ENV": &env}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if err := c.Post(&d, "/deploys/"+d.ID+"/abort", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mustConfigVarUpdate(t, c, "acme-inc", map[string]*string{"RAILS_ENV": &env})
+}
@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bgentry/heroku-go"
+	"github.com/remind101/empire"
+)
+
+func TestPromotion(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	mustAppCreate(t, c, empire.App{
+		Name: "acme-prod",
+	})
+
+	env := "production"
+	mustConfigVarUpdate(t, c, "acme-prod", map[string]*string{
+		"RAILS_ENV": &env,
+	})
+
+	release := mustPromote(t, c, "acme-prod", "acme-inc")
+
+	if got, want := release.Version, 1; got != want {
+		t.Fatalf("Version => %v; want %v", got, want)
+	}
+
+	if got, want := release.Description, "Promote acme-inc v1 ("+DefaultImage+")"; got != want {
+		t.Fatalf("Description => %v; want %v", got, want)
+	}
+
+	// The target app keeps its own config.
+	vars, err := c.ConfigVarInfo("acme-prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vars, map[string]string{"RAILS_ENV": "production"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Config => %v; want %v", got, want)
+	}
+}
+
+func TestPromotion_NoReleases(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustAppCreate(t, c, empire.App{
+		Name: "acme-staging",
+	})
+	mustAppCreate(t, c, empire.App{
+		Name: "acme-prod",
+	})
+
+	var release heroku.Release
+	err := c.Post(&release, "/apps/acme-prod/promotions", map[string]string{"source": "acme-staging"})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func mustPromote(t testing.TB, c *heroku.Client, target, source string) *heroku.Release {
+	var release heroku.Release
+
+	if err := c.Post(&release, "/apps/"+target+"/promotions", map[string]string{"source": source}); err != nil {
+		t.Fatal(err)
+	}
+
+	return &release
+}
@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"io/ioutil"
 	"testing"
 
 	"github.com/bgentry/heroku-go"
@@ -48,6 +49,63 @@ func TestReleaseRollback(t *testing.T) {
 	mustReleaseRollback(t, c, "acme-inc", "1")
 }
 
+func TestReleaseRollback_RestoreFormation(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	// Deploy again, scaling up the web process.
+	if err := c.Post(ioutil.Discard, "/deploys", map[string]interface{}{
+		"image": DefaultImage,
+		"formation": []map[string]interface{}{
+			{"process": "web", "quantity": 2},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var release heroku.Release
+	if err := c.Post(&release, "/apps/acme-inc/releases", map[string]interface{}{
+		"release":           "1",
+		"restore_formation": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := release.Description, "Rollback to v1 with its formation"; got != want {
+		t.Fatalf("Description => %q; want %q", got, want)
+	}
+
+	dynos, err := c.DynoList("acme-inc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(dynos), 1; got != want {
+		t.Fatalf("DynoList => %d; want %d", got, want)
+	}
+}
+
+func TestReleasePin(t *testing.T) {
+	c, s := NewTestClient(t)
+	defer s.Close()
+
+	mustDeploy(t, c, DefaultImage)
+
+	var release struct {
+		Version int  `json:"version"`
+		Pinned  bool `json:"pinned"`
+	}
+	if err := c.Patch(&release, "/apps/acme-inc/releases/1", map[string]bool{"pinned": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !release.Pinned {
+		t.Fatal("Expected the release to be pinned")
+	}
+}
+
 func mustReleaseList(t testing.TB, c *heroku.Client, appName string) []heroku.Release {
 	releases, err := c.ReleaseList(appName, nil)
 	if err != nil {
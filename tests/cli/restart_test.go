@@ -28,5 +28,13 @@ v1.web.2  1X  running   5d  "./bin/web"`,
 			"restart 1 -a acme-inc",
 			"Restarted 1 dynos for acme-inc.",
 		},
+		{
+			"restart web -a acme-inc",
+			"Restarted web dynos for acme-inc.",
+		},
+		{
+			"restart web.2 -a acme-inc",
+			"Restarted web.2 dynos for acme-inc.",
+		},
 	})
 }